@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const (
+	diffContext = 3
+
+	colorReset = "\x1b[0m"
+	colorBold  = "\x1b[1m"
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorCyan  = "\x1b[36m"
+)
+
+type diffLine struct {
+	kind    byte // ' ', '-' or '+'
+	text    string
+	oldLine int // 0-based position in before
+	newLine int // 0-based position in after
+}
+
+// unifiedDiff renders a git style diff of the file, it's empty when nothing changed
+func unifiedDiff(path, before, after string, color bool) string {
+	lines := diffLines(splitLines(before), splitLines(after))
+
+	var changes []int
+	for i, l := range lines {
+		if l.kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	paint := func(c, s string) string {
+		if !color {
+			return s
+		}
+		return c + s + colorReset
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(paint(colorBold, fmt.Sprintf("--- a/%s\n+++ b/%s", path, path)) + "\n")
+
+	for i := 0; i < len(changes); {
+		// merge the changes whose contexts overlap into a single hunk
+		j := i
+		for j+1 < len(changes) && changes[j+1]-changes[j] <= 2*diffContext {
+			j++
+		}
+
+		start := max(changes[i]-diffContext, 0)
+		end := min(changes[j]+diffContext+1, len(lines))
+		hunk := lines[start:end]
+
+		var oldCount, newCount int
+		for _, l := range hunk {
+			if l.kind != '+' {
+				oldCount++
+			}
+			if l.kind != '-' {
+				newCount++
+			}
+		}
+
+		header := fmt.Sprintf("@@ -%s +%s @@", hunkRange(hunk[0].oldLine, oldCount), hunkRange(hunk[0].newLine, newCount))
+		buf.WriteString(paint(colorCyan, header) + "\n")
+
+		for _, l := range hunk {
+			s := string(l.kind) + l.text
+			switch l.kind {
+			case '-':
+				s = paint(colorRed, s)
+			case '+':
+				s = paint(colorGreen, s)
+			}
+			buf.WriteString(s + "\n")
+		}
+
+		i = j + 1
+	}
+
+	return buf.String()
+}
+
+func hunkRange(line, count int) string {
+	// an empty range starts at the line before it
+	if count == 0 {
+		return fmt.Sprintf("%d,0", line)
+	}
+	return fmt.Sprintf("%d,%d", line+1, count)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines walks the longest common subsequence of the lines,
+// manifests are small enough for the quadratic table
+func diffLines(a, b []string) []diffLine {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i], i, j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{'-', a[i], i, j})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j], i, j})
+			j++
+		}
+	}
+	return lines
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -2,10 +2,16 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/sakajunquality/flow/flow"
 	"gopkg.in/yaml.v2"
@@ -16,6 +22,17 @@ var f *flow.Flow
 func main() {
 
 	config := flag.String("config", "config.yaml", "config file")
+	once := flag.String("once", "", "process a single event from the file (- for stdin) and exit")
+	dryRun := flag.Bool("dry-run", false, "skip creating PRs and posting notifications")
+	preview := flag.String("preview", "", "preview the file changes of app/env/version and exit")
+	checkRemotes := flag.Bool("check-remotes", false, "check every file of the manifests exists on its base branch and exit")
+	diff := flag.Bool("diff", false, "print the preview as unified diff")
+	noColor := flag.Bool("no-color", false, "disable the colors of the diff")
+	onlyApps := flag.String("only-apps", "", "process only the comma separated apps, overrides FLOW_ONLY_APPS")
+	skipApps := flag.String("skip-apps", "", "ignore the comma separated apps, overrides FLOW_SKIP_APPS")
+	jsonResults := flag.Bool("json", false, "write the result of every event to stdout as JSON")
+	statusAddr := flag.String("status-addr", "", "serve the status of each app on /status at the address (e.g. :8080), and PUT /applications/<name> with FLOW_ADMIN_TOKEN")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "how long to wait for the events being processed on SIGTERM")
 	flag.Parse()
 	yamlFile, err := ioutil.ReadFile(*config)
 	if err != nil {
@@ -35,11 +52,163 @@ func main() {
 		os.Exit(1)
 	}
 
+	restoreLogs, err := f.RedactLogs()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "flow init error:%v.\n", err)
+		os.Exit(1)
+	}
+	defer restoreLogs()
+	// os.Exit skips the deferred flush of the logs
+	exit := func(code int) {
+		restoreLogs()
+		os.Exit(code)
+	}
+
+	f.DryRun = *dryRun
+	f.JSONResults = *jsonResults
+	if *onlyApps != "" {
+		f.OnlyApps = flow.SplitList(*onlyApps)
+	}
+	if *skipApps != "" {
+		f.SkipApps = flow.SplitList(*skipApps)
+	}
+
+	if *preview != "" {
+		if err := previewRelease(*preview, *diff, !*noColor); err != nil {
+			fmt.Fprintf(os.Stderr, "flow error:%v.\n", err)
+			exit(1)
+		}
+		return
+	}
+
+	if *checkRemotes {
+		if !checkRemoteFiles() {
+			exit(1)
+		}
+		return
+	}
+
+	if *once != "" {
+		if err := processOnce(*once, *jsonResults); err != nil {
+			fmt.Fprintf(os.Stderr, "flow error:%v.\n", err)
+			exit(1)
+		}
+		return
+	}
+
 	fmt.Fprintf(os.Stdout, "flow started\n")
 
+	if *statusAddr != "" {
+		go serveStatus(*statusAddr)
+	}
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGTERM, os.Interrupt)
+
 	errCh := make(chan error, 1)
 	ctx := context.TODO()
 	f.Start(ctx, errCh)
-	err = <-errCh
-	f.Stop(ctx)
+
+	select {
+	case err = <-errCh:
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "flow error:%v.\n", err)
+		}
+	case sig := <-sigCh:
+		fmt.Fprintf(os.Stdout, "received %s, draining events\n", sig)
+	}
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	f.Stop(stopCtx)
+
+	fmt.Fprintf(os.Stdout, "flow stopped\n")
+	if err != nil {
+		exit(1)
+	}
+}
+
+func serveStatus(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/status", f.StatusHandler())
+	mux.Handle("/applications/", f.ApplicationHandler())
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		fmt.Fprintf(os.Stderr, "status server error:%v.\n", err)
+	}
+}
+
+func processOnce(path string, jsonResult bool) error {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	e, err := flow.ParseEvent(data)
+	if err != nil {
+		return err
+	}
+
+	if !jsonResult {
+		_, err := f.ProcessOnce(context.Background(), e, os.Stdout)
+		return err
+	}
+
+	result, err := f.ProcessOnce(context.Background(), e, ioutil.Discard)
+	if result != nil {
+		if err := json.NewEncoder(os.Stdout).Encode(result); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// checkRemoteFiles prints the files which can't be read, it returns false when there are any
+func checkRemoteFiles() bool {
+	problems, err := f.CheckRemotes(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "flow error:%v.\n", err)
+		return false
+	}
+
+	for _, p := range problems {
+		fmt.Fprintf(os.Stderr, "%s\n", p.Error())
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "%d of the files could not be read\n", len(problems))
+		return false
+	}
+	fmt.Fprintf(os.Stdout, "every file of the manifests exists\n")
+	return true
+}
+
+func previewRelease(target string, diff, color bool) error {
+	parts := strings.SplitN(target, "/", 3)
+	if len(parts) != 3 {
+		return fmt.Errorf("preview must be app/env/version: %s", target)
+	}
+
+	changes, err := f.PreviewRelease(context.Background(), parts[0], parts[1], parts[2])
+	if err != nil {
+		return err
+	}
+
+	for _, c := range changes {
+		if !diff {
+			status := "unchanged"
+			if c.Changed {
+				status = "changed"
+			}
+			fmt.Fprintf(os.Stdout, "%s: %s\n", c.Path, status)
+			continue
+		}
+
+		fmt.Fprint(os.Stdout, unifiedDiff(c.Path, c.Before, c.After, color))
+	}
+	return nil
 }
@@ -0,0 +1,65 @@
+package flow
+
+import (
+	"fmt"
+	"strings"
+)
+
+// appIndex finds the apps of the events without scanning the config. It's built with the config
+// and swapped with it, so the lookups never mix the apps of two configs.
+type appIndex struct {
+	byTriggerID map[string]int
+	byRepoName  map[string]int
+}
+
+// newAppIndex indexes the apps by the trigger ID and name, and by the Cloud Build repository names of the
+// source and of the build_repos. The first app of the config wins, like the scan it replaced.
+func newAppIndex(apps []Application) *appIndex {
+	idx := &appIndex{
+		byTriggerID: map[string]int{},
+		byRepoName:  map[string]int{},
+	}
+
+	add := func(m map[string]int, key string, i int) {
+		if _, ok := m[key]; !ok {
+			m[key] = i
+		}
+	}
+
+	for i, app := range apps {
+		add(idx.byTriggerID, app.TriggerID, i)
+		if app.TriggerName != "" {
+			add(idx.byTriggerID, app.TriggerName, i)
+		}
+
+		repos := append([]string{app.SourceOwner + "/" + app.SourceName}, app.BuildRepos...)
+		for _, repo := range repos {
+			for _, name := range cloudBuildRepoNames(repo) {
+				add(idx.byRepoName, name, i)
+			}
+		}
+	}
+	return idx
+}
+
+// cloudBuildRepoNames are the names Cloud Build gives to the GitHub repository owner/name
+func cloudBuildRepoNames(repo string) []string {
+	parts := strings.SplitN(repo, "/", 2)
+	if len(parts) != 2 {
+		return nil
+	}
+	return []string{
+		fmt.Sprintf("github-%s-%s", parts[0], parts[1]),
+		fmt.Sprintf("github_%s_%s", parts[0], parts[1]),
+	}
+}
+
+// indexedApp returns a copy of the app of the index, so the callers can't change the config
+func (c *Config) indexedApp(byKey map[string]int, key string) *Application {
+	i, ok := byKey[key]
+	if !ok {
+		return nil
+	}
+	app := c.ApplicationList[i]
+	return &app
+}
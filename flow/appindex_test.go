@@ -0,0 +1,99 @@
+package flow
+
+import (
+	"fmt"
+	"testing"
+)
+
+// testApps are n apps with the triggers trigger-0... of the repos owner/app-0...
+func testApps(n int) []Application {
+	var apps []Application
+	for i := 0; i < n; i++ {
+		apps = append(apps, Application{
+			Name:        fmt.Sprintf("app-%d", i),
+			TriggerID:   fmt.Sprintf("trigger-%d", i),
+			SourceOwner: "owner",
+			SourceName:  fmt.Sprintf("app-%d", i),
+		})
+	}
+	return apps
+}
+
+func TestAppIndex(t *testing.T) {
+	apps := testApps(3)
+	apps[1].TriggerName = "deploy-app-1"
+	apps[2].BuildRepos = []string{"owner/shared"}
+	apps = append(apps, Application{Name: "duplicate", TriggerID: "trigger-0", SourceOwner: "owner", SourceName: "shared"})
+	setConfig(&Config{ApplicationList: apps})
+
+	tests := []struct {
+		name   string
+		lookup func(string) (*Application, error)
+		key    string
+		want   string
+	}{
+		{"trigger ID", getApplicationByEventTriggerID, "trigger-1", "app-1"},
+		{"trigger name", getApplicationByEventTriggerID, "deploy-app-1", "app-1"},
+		{"first app of a trigger", getApplicationByEventTriggerID, "trigger-0", "app-0"},
+		{"unknown trigger", getApplicationByEventTriggerID, "trigger-9", ""},
+		{"repo name with dashes", getApplicationByEventRepoName, "github-owner-app-2", "app-2"},
+		{"repo name with underscores", getApplicationByEventRepoName, "github_owner_app-2", "app-2"},
+		{"first app of a build repo", getApplicationByEventRepoName, "github-owner-shared", "app-2"},
+		{"unknown repo", getApplicationByEventRepoName, "github-owner-app-9", ""},
+	}
+	for _, tt := range tests {
+		app, err := tt.lookup(tt.key)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%s: found %s", tt.name, app.Name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if app.Name != tt.want {
+			t.Errorf("%s: found %s, want %s", tt.name, app.Name, tt.want)
+		}
+	}
+
+	app, _ := getApplicationByEventTriggerID("trigger-1")
+	app.Name = "changed"
+	if currentConfig().ApplicationList[1].Name != "app-1" {
+		t.Error("the lookup returned the app of the config instead of a copy")
+	}
+}
+
+// scanApp is the lookup by trigger the index replaced
+func scanApp(apps []Application, trigger string) *Application {
+	for _, app := range apps {
+		if app.TriggerID == trigger || app.TriggerName == trigger {
+			return &app
+		}
+	}
+	return nil
+}
+
+func BenchmarkAppLookup(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		setConfig(&Config{ApplicationList: testApps(n)})
+		// The last app is the worst case of the scan
+		trigger := fmt.Sprintf("trigger-%d", n-1)
+
+		b.Run(fmt.Sprintf("index/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := getApplicationByEventTriggerID(trigger); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("scan/%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if scanApp(currentConfig().ApplicationList, trigger) == nil {
+					b.Fatal("not found")
+				}
+			}
+		})
+	}
+}
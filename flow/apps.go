@@ -0,0 +1,75 @@
+package flow
+
+// ApplicationView is a read-only copy of the config of an app, see Flow.Applications
+type ApplicationView struct {
+	Name        string `json:"name"`
+	TriggerID   string `json:"trigger_id,omitempty"`
+	TriggerName string `json:"trigger_name,omitempty"`
+	// Source and ManifestRepo are owner/name of the repositories
+	Source       string    `json:"source"`
+	BuildRepos   []string  `json:"build_repos,omitempty"`
+	ManifestRepo string    `json:"manifest_repo"`
+	Image        string    `json:"image"`
+	Envs         []EnvView `json:"envs"`
+}
+
+// EnvView is a manifest of the app, the manifests with base_branches have an env per branch
+type EnvView struct {
+	Env        string `json:"env"`
+	BaseBranch string `json:"base_branch"`
+	// Files are the templates of the paths, as configured
+	Files   []string `json:"files"`
+	Filters Filters  `json:"filters"`
+}
+
+// Applications returns what is released where by the current config, in the order of the config.
+// The view is copied from a single config, changing it doesn't change the config.
+func (f *Flow) Applications() []ApplicationView {
+	c := currentConfig()
+	views := make([]ApplicationView, 0, len(c.ApplicationList))
+	for i := range c.ApplicationList {
+		views = append(views, c.ApplicationList[i].view())
+	}
+	return views
+}
+
+func (a *Application) view() ApplicationView {
+	targets := a.targets()
+	v := ApplicationView{
+		Name:         a.Name,
+		TriggerID:    a.TriggerID,
+		TriggerName:  a.TriggerName,
+		Source:       a.SourceOwner + "/" + a.SourceName,
+		BuildRepos:   copyStrings(a.BuildRepos),
+		ManifestRepo: a.ManifestOwner + "/" + a.ManifestName,
+		Image:        a.ImageName,
+		Envs:         make([]EnvView, 0, len(targets)),
+	}
+
+	for _, m := range targets {
+		files := m.Files
+		if len(files) == 0 {
+			files = a.Files
+		}
+
+		v.Envs = append(v.Envs, EnvView{
+			Env:        m.target(),
+			BaseBranch: a.baseBranch(m),
+			Files:      copyStrings(files),
+			Filters: Filters{
+				IncludePrefixes: copyStrings(m.Filters.IncludePrefixes),
+				ExcludePrefixes: copyStrings(m.Filters.ExcludePrefixes),
+				IncludeBranches: copyStrings(m.Filters.IncludeBranches),
+				ExcludeBranches: copyStrings(m.Filters.ExcludeBranches),
+			},
+		})
+	}
+	return v
+}
+
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append([]string(nil), s...)
+}
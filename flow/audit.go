@@ -0,0 +1,139 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sakajunquality/flow/gitbot"
+)
+
+const (
+	auditLogRetries = 5
+	auditLogBackoff = 2 * time.Second
+)
+
+// auditRecord is a line of the audit log
+type auditRecord struct {
+	app        string
+	env        string
+	version    string
+	url        string
+	releasedAt time.Time
+}
+
+func (r auditRecord) String() string {
+	return strings.Join([]string{r.releasedAt.UTC().Format(time.RFC3339), r.app, r.env, r.version, r.url}, "\t")
+}
+
+// auditLog commits the releases to the audit file in the background, the records
+// queued while a commit is in flight are committed together with the next one
+type auditLog struct {
+	config AuditLog
+	token  TokenProvider
+	author func(ctx context.Context) (GitAuthor, error)
+	repo   *gitbot.Repo
+	// flushing serializes the commits of the background and of flush
+	flushing sync.Mutex
+	mu       sync.Mutex
+	pending  []auditRecord
+	wake     chan struct{}
+	done     chan struct{}
+}
+
+func (f *Flow) newAuditLog(c AuditLog) *auditLog {
+	repo := gitbot.NewRepo(c.Owner, c.Name, c.Branch)
+	repo.SetHTTPClient(f.httpClient)
+
+	l := &auditLog{
+		config: c,
+		token:  f.githubToken,
+		author: func(ctx context.Context) (GitAuthor, error) { return f.author(ctx, nil) },
+		repo:   repo,
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	go l.run()
+	return l
+}
+
+// add queues the record without waiting for the commit
+func (l *auditLog) add(r auditRecord) {
+	l.mu.Lock()
+	l.pending = append(l.pending, r)
+	l.mu.Unlock()
+
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// close commits the queued records and stops the background commits
+func (l *auditLog) close() {
+	close(l.wake)
+	<-l.done
+}
+
+func (l *auditLog) run() {
+	defer close(l.done)
+	for range l.wake {
+		l.flush()
+	}
+	l.flush()
+}
+
+// flush commits the queued records right away
+func (l *auditLog) flush() {
+	l.flushing.Lock()
+	defer l.flushing.Unlock()
+
+	l.mu.Lock()
+	records := l.pending
+	l.pending = nil
+	l.mu.Unlock()
+
+	if len(records) == 0 {
+		return
+	}
+
+	var lines []string
+	for _, r := range records {
+		lines = append(lines, r.String())
+	}
+	message := fmt.Sprintf("Record %d releases", len(records))
+
+	ctx := context.Background()
+	var err error
+	for i := 0; i < auditLogRetries; i++ {
+		var token string
+		if token, err = l.token.Token(ctx); err != nil {
+			break
+		}
+		var author GitAuthor
+		if author, err = l.author(ctx); err != nil {
+			break
+		}
+		err = l.repo.AppendFile(ctx, token, l.config.File, lines, message, author.Name, author.Email)
+		if err == nil || !errors.Is(err, gitbot.ErrConflict) {
+			break
+		}
+		// Someone else committed meanwhile, append on top of it
+		time.Sleep(auditLogBackoff * time.Duration(i+1))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing the audit log, dropping:\n%s\n%s\n", strings.Join(lines, "\n"), err)
+	}
+}
+
+// audit records the release, the audit log never fails nor blocks the release
+func (f *Flow) audit(app, env, version, url string) {
+	if f.auditLog == nil || f.DryRun {
+		return
+	}
+	f.auditLog.add(auditRecord{app: app, env: env, version: version, url: url, releasedAt: time.Now()})
+}
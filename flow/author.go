@@ -0,0 +1,80 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/sakajunquality/flow/gitbot"
+)
+
+// noreplyPattern is the noreply address of a GitHub account, bots have the [bot] suffix
+var noreplyPattern = regexp.MustCompile(`^[0-9]+\+[A-Za-z0-9-]+(\[bot\])?@users\.noreply\.github\.com$`)
+
+// validateGitAuthor checks the noreply address of the configured account
+func validateGitAuthor(a GitAuthor) error {
+	if a.GitHubID == 0 {
+		return nil
+	}
+	if email := a.noreplyEmail(); !noreplyPattern.MatchString(email) {
+		return fmt.Errorf("%s is not a GitHub noreply address", email)
+	}
+	return nil
+}
+
+func (a GitAuthor) noreplyEmail() string {
+	login := a.Login
+	if login == "" {
+		login = a.Name
+	}
+	return fmt.Sprintf("%d+%s@users.noreply.github.com", a.GitHubID, login)
+}
+
+// author resolves the commit author of the app, which overrides the global one
+func (f *Flow) author(ctx context.Context, app *Application) (GitAuthor, error) {
+	a := currentConfig().GitAuthor
+	if app != nil && app.GitAuthor != nil {
+		a = *app.GitAuthor
+	}
+
+	if a.FromToken {
+		u, err := f.githubUser(ctx)
+		if err != nil {
+			return a, err
+		}
+		a.GitHubID, a.Login = u.ID, u.Login
+		if a.Name == "" {
+			a.Name = u.Login
+		}
+	}
+
+	if a.GitHubID == 0 {
+		return a, nil
+	}
+	if err := validateGitAuthor(a); err != nil {
+		return a, err
+	}
+	a.Email = a.noreplyEmail()
+	return a, nil
+}
+
+// githubUser is the account of the GitHub token, which is only looked up once
+func (f *Flow) githubUser(ctx context.Context) (*gitbot.User, error) {
+	f.userMu.Lock()
+	defer f.userMu.Unlock()
+
+	if f.user != nil {
+		return f.user, nil
+	}
+
+	token, err := f.githubToken.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	u, err := gitbot.AuthenticatedUser(ctx, f.httpClient, token)
+	if err != nil {
+		return nil, err
+	}
+	f.user = u
+	return u, nil
+}
@@ -0,0 +1,368 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sakajunquality/flow/gitbot"
+)
+
+// batchedRelease is a manifest release waiting for the window of its group
+type batchedRelease struct {
+	e        Event
+	tag      string
+	version  string
+	app      *Application
+	manifest Manifest
+}
+
+// batcher collects the releases of each app group until the window of the group has passed
+type batcher struct {
+	mu      sync.Mutex
+	pending map[string][]batchedRelease
+	timers  map[string]*time.Timer
+	flush   func(group AppGroup, releases []batchedRelease)
+	// flushing counts the windows which haven't been flushed yet
+	flushing sync.WaitGroup
+	// events are the events with pending releases, by ID
+	events map[string]*batchedEvent
+}
+
+// batchedEvent counts the pending releases of an event, which is acked once they're released
+type batchedEvent struct {
+	pending  int
+	released chan struct{}
+}
+
+func newBatcher(flush func(group AppGroup, releases []batchedRelease)) *batcher {
+	return &batcher{
+		pending: map[string][]batchedRelease{},
+		timers:  map[string]*time.Timer{},
+		flush:   flush,
+		events:  map[string]*batchedEvent{},
+	}
+}
+
+// add queues the release, the window starts with the first release of the group
+func (b *batcher) add(group AppGroup, r batchedRelease) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.pending[group.Name] = append(b.pending[group.Name], r)
+	be, ok := b.events[r.e.ID]
+	if !ok {
+		be = &batchedEvent{released: make(chan struct{})}
+		b.events[r.e.ID] = be
+	}
+	be.pending++
+
+	if _, ok := b.timers[group.Name]; ok {
+		return
+	}
+	b.flushing.Add(1)
+	b.timers[group.Name] = time.AfterFunc(group.Window, func() {
+		defer b.flushing.Done()
+		b.flushGroup(group)
+	})
+}
+
+func (b *batcher) flushGroup(group AppGroup) {
+	b.mu.Lock()
+	releases := b.pending[group.Name]
+	delete(b.pending, group.Name)
+	delete(b.timers, group.Name)
+	b.mu.Unlock()
+
+	if len(releases) == 0 {
+		return
+	}
+	b.flush(group, releases)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, r := range releases {
+		be := b.events[r.e.ID]
+		be.pending--
+		if be.pending == 0 {
+			close(be.released)
+			delete(b.events, r.e.ID)
+		}
+	}
+}
+
+// released is closed once the pending releases of the event have been released
+func (b *batcher) released(eventID string) <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if be, ok := b.events[eventID]; ok {
+		return be.released
+	}
+	released := make(chan struct{})
+	close(released)
+	return released
+}
+
+// flushAll releases every pending group right away and waits for the ones being flushed, e.g. on shutdown
+func (b *batcher) flushAll() {
+	b.mu.Lock()
+	var groups []AppGroup
+	for name, t := range b.timers {
+		if t.Stop() {
+			groups = append(groups, *currentConfig().appGroup(name))
+		}
+	}
+	b.mu.Unlock()
+
+	for _, group := range groups {
+		b.flushGroup(group)
+		b.flushing.Done()
+	}
+	b.flushing.Wait()
+}
+
+// releaseBatch opens a single PR per env for all the releases of the group
+func (f *Flow) releaseBatch(ctx context.Context, group AppGroup, releases []batchedRelease) {
+	defer lock(group.Apps...)()
+
+	var envs []string
+	byEnv := map[string][]batchedRelease{}
+	for _, r := range releases {
+		env := r.manifest.target()
+		if _, ok := byEnv[env]; !ok {
+			envs = append(envs, env)
+		}
+		byEnv[env] = append(byEnv[env], r)
+	}
+
+	var prs PullRequests
+	for _, env := range envs {
+		pr := f.createBatchRelease(ctx, group, env, latestReleases(byEnv[env]))
+		if pr != nil {
+			prs = append(prs, *pr)
+		}
+	}
+
+	f.notifyBatch(ctx, group, releases, prs)
+	if prs.created() {
+		for _, r := range latestReleases(releases) {
+			f.updateStatusMessage(ctx, r.app)
+		}
+	}
+}
+
+// latestReleases keeps the last release of each app, the earlier ones are superseded
+func latestReleases(releases []batchedRelease) []batchedRelease {
+	var latest []batchedRelease
+	index := map[string]int{}
+	for _, r := range releases {
+		if i, ok := index[r.app.Name]; ok {
+			latest[i] = r
+			continue
+		}
+		index[r.app.Name] = len(latest)
+		latest = append(latest, r)
+	}
+	return latest
+}
+
+func (f *Flow) createBatchRelease(ctx context.Context, group AppGroup, env string, releases []batchedRelease) *PullRequest {
+	pr := &PullRequest{env: env, status: prFailed, channel: slackChannel(releases[0].app, &releases[0].manifest)}
+
+	// The releases which are held back, e.g. by a pin, are left out of the PR
+	var released []batchedRelease
+	for _, r := range releases {
+		if held := f.releaseHeld(ctx, r.tag, r.version, r.app, r.manifest); held != nil {
+			if held.status == prFailed {
+				pr.err = held.err
+				return pr
+			}
+			fmt.Fprintf(os.Stdout, "Skipping %s of %s %s: %s\n", r.version, r.app.Name, env, held.skipped)
+			continue
+		}
+		if r.manifest.ForceDryRun {
+			fmt.Fprintf(os.Stdout, "%s %s is dry-run by force_dry_run, skipping %s\n", r.app.Name, env, r.version)
+			continue
+		}
+		released = append(released, r)
+	}
+	if len(released) == 0 {
+		return nil
+	}
+
+	if !f.DryRun {
+		paused, err := f.checkOpenPRs(ctx, released[0].app, released[0].manifest)
+		if err != nil {
+			pr.err = err
+			return pr
+		}
+		if paused != "" {
+			pr.status, pr.skipped = prSkipped, fmt.Sprintf("%s %s", batchVersions(released), paused)
+			return pr
+		}
+	}
+
+	// So are the ones another instance (or a redelivery) already released
+	var claimed []batchedRelease
+	var keys []string
+	for _, r := range released {
+		key := fmt.Sprintf("%s/%s/%s", r.app.Name, env, r.version)
+		if !f.DryRun {
+			ok, err := f.store.Claim(ctx, key, currentConfig().claimTTL())
+			if err != nil {
+				pr.err = err
+				f.unclaim(ctx, keys)
+				return pr
+			}
+			if !ok {
+				fmt.Fprintf(os.Stdout, "%s has already been released\n", key)
+				continue
+			}
+			keys = append(keys, key)
+		}
+		claimed = append(claimed, r)
+	}
+
+	if len(claimed) == 0 {
+		return nil
+	}
+
+	result, err := f.createBatchRelasePR(ctx, group, env, claimed)
+	if errors.Is(err, errUnchanged) {
+		f.completeClaims(ctx, keys)
+		pr.status = prUnchanged
+		pr.skipped = "already at " + batchVersions(claimed)
+		return pr
+	}
+	if err != nil {
+		f.unclaim(ctx, keys)
+		pr.err = err
+		return pr
+	}
+	f.completeClaims(ctx, keys)
+
+	if !f.DryRun {
+		for _, r := range claimed {
+			if err := f.store.SetLastRelease(ctx, r.app.Name, env, r.version, f.now()); err != nil {
+				fmt.Fprintf(os.Stderr, "Error saving the release of %s %s %s: %s\n", r.app.Name, env, r.version, err)
+			}
+			f.audit(r.app.Name, env, r.version, result.URL)
+			f.watchMerge(ctx, r.app, r.manifest, r.version, result)
+		}
+	}
+
+	pr.status = prCreated
+	pr.url = result.URL
+	pr.merge = result.Merge
+	pr.mergeErr = result.MergeError
+	return pr
+}
+
+func (f *Flow) unclaim(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := f.store.Unclaim(ctx, key); err != nil {
+			fmt.Fprintf(os.Stderr, "Error unclaiming %s: %s\n", key, err)
+		}
+	}
+}
+
+// createBatchRelasePR releases the apps of the group to the env with a single PR
+func (f *Flow) createBatchRelasePR(ctx context.Context, group AppGroup, env string, releases []batchedRelease) (*gitbot.Result, error) {
+	var body []string
+	for _, r := range releases {
+		line := fmt.Sprintf("- %s %s", r.app.Name, r.version)
+		if link := f.releaseLink(ctx, *r.app, r.tag); link != "" {
+			line += " " + link
+		}
+		body = append(body, line)
+	}
+
+	branch := fmt.Sprintf("release/%s-%s-%s", env, group.Name, batchVersions(releases))
+	subject := fmt.Sprintf("%s %s Release", env, group.Name)
+	return f.createCombinedPR(ctx, releases, branch, subject, strings.Join(body, "\n"))
+}
+
+// createCombinedPR combines the releases into the PR of the first one, which also decides
+// the reviewers and the auto-merge of the PR
+func (f *Flow) createCombinedPR(ctx context.Context, releases []batchedRelease, branch, subject, body string) (*gitbot.Result, error) {
+	fetchCtx, cancel := withFetchTimeout(ctx)
+	defer cancel()
+
+	var release *gitbot.Release
+	for _, r := range releases {
+		rr, err := f.newRelease(fetchCtx, r.e, r.tag, r.version, *r.app, r.manifest)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %s", r.app.Name, r.manifest.target(), err)
+		}
+		if release == nil {
+			release = rr
+		} else {
+			release.Combine(rr)
+		}
+	}
+	release.SetPullRequest(branch, subject, body)
+
+	changes, err := release.PreviewFrom(func(filePath string) (string, error) {
+		return f.getContent(fetchCtx, &release.Repo, filePath)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !anyChanged(changes) {
+		return nil, errUnchanged
+	}
+
+	if f.DryRun {
+		fmt.Fprintf(os.Stdout, "dry-run: skipping the PR %s\n", subject)
+		return &gitbot.Result{URL: "dry-run"}, nil
+	}
+
+	unlock, err := lockRepo(ctx, release.Repo.FullName())
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return f.releaser.Create(ctx, release, f.token(ctx))
+}
+
+// batchVersions is a stable name of the versions of the batch, a redelivered batch
+// resolves to the same branch
+func batchVersions(releases []batchedRelease) string {
+	var versions []string
+	for _, r := range releases {
+		versions = append(versions, r.version)
+	}
+	sort.Strings(versions)
+	return strings.Join(versions, "-")
+}
+
+func (c *Config) appGroup(name string) *AppGroup {
+	for _, g := range c.AppGroups {
+		if g.Name == name {
+			return &g
+		}
+	}
+	return nil
+}
+
+// groupOf returns the batching group of the app, nil when the app isn't batched
+func (c *Config) groupOf(app *Application) *AppGroup {
+	for _, g := range c.AppGroups {
+		if g.Window <= 0 {
+			continue
+		}
+		for _, name := range g.Apps {
+			if name == app.Name {
+				return &g
+			}
+		}
+	}
+	return nil
+}
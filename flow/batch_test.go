@@ -0,0 +1,233 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sakajunquality/cloud-pubsub-events/cloudbuildevent"
+	"github.com/sakajunquality/flow/gitbot"
+)
+
+func TestBatcherReleased(t *testing.T) {
+	group := AppGroup{Name: "group", Apps: []string{"app-a", "app-b"}, Window: time.Hour}
+	setConfig(&Config{AppGroups: []AppGroup{group}})
+
+	var flushed []batchedRelease
+	b := newBatcher(func(group AppGroup, releases []batchedRelease) {
+		flushed = append(flushed, releases...)
+	})
+	b.add(group, batchedRelease{e: Event{Event: cloudbuildevent.Event{ID: "1"}}, version: "v1.0.0"})
+	b.add(group, batchedRelease{e: Event{Event: cloudbuildevent.Event{ID: "1"}}, version: "v1.0.1"})
+
+	select {
+	case <-b.released("1"):
+		t.Fatal("released the event before its batch")
+	default:
+	}
+	select {
+	case <-b.released("2"):
+	default:
+		t.Error("held an event without batched releases")
+	}
+
+	released := b.released("1")
+	b.flushAll()
+	select {
+	case <-released:
+	default:
+		t.Error("held the event after its batch was released")
+	}
+	if len(flushed) != 2 {
+		t.Errorf("released %d releases, want 2", len(flushed))
+	}
+}
+
+func TestStopReleasesBatches(t *testing.T) {
+	group := AppGroup{Name: "group", Apps: []string{"app"}, Window: time.Hour}
+	setConfig(&Config{AppGroups: []AppGroup{group}})
+
+	processCtx, cancelProcess := context.WithCancel(context.Background())
+	defer cancelProcess()
+	f := &Flow{
+		cancelReceive: func() {},
+		cancelProcess: cancelProcess,
+		stopped:       make(chan struct{}),
+	}
+
+	flushErr := errors.New("not released")
+	f.batcher = newBatcher(func(group AppGroup, releases []batchedRelease) {
+		flushErr = processCtx.Err()
+	})
+	f.batcher.add(group, batchedRelease{e: Event{Event: cloudbuildevent.Event{ID: "1"}}})
+
+	// The event waits for its batch to be acked, as subscribe does
+	go func() {
+		defer close(f.stopped)
+		select {
+		case <-f.batcher.released("1"):
+		case <-processCtx.Done():
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	f.Stop(ctx)
+
+	if flushErr != nil {
+		t.Errorf("released the batch with %v", flushErr)
+	}
+	if ctx.Err() != nil {
+		t.Error("waited for the window of the batch")
+	}
+}
+
+const batchDeployment = `apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    spec:
+      containers:
+      - name: app-a
+        image: gcr.io/project/app-a:v0.9.0
+      - name: app-b
+        image: gcr.io/project/app-b:v0.9.0
+`
+
+// batchApp releases gcr.io/project/<name> to the dev env of owner/manifests
+func batchApp(name string) Application {
+	return Application{
+		Name:               name,
+		TriggerID:          name,
+		ImageName:          "gcr.io/project/" + name,
+		SourceOwner:        "owner",
+		SourceName:         name,
+		ManifestOwner:      "owner",
+		ManifestName:       "manifests",
+		ManifestBaseBranch: "main",
+		Manifests:          []Manifest{{Env: "dev", Files: []string{"dev/deployment.yaml"}}},
+	}
+}
+
+// newBatchFlow releases the batches of app-a and app-b to the fake, the dev env of app-a
+// takes only the promoted versions
+func newBatchFlow(github *githubServer) (*Flow, AppGroup, *fakeReleaser) {
+	group := AppGroup{Name: "bundle", Apps: []string{"app-a", "app-b"}, Window: time.Hour}
+	a, b := batchApp("app-a"), batchApp("app-b")
+	a.Manifests[0].Promotion = &Promotion{}
+	setConfig(&Config{
+		SlackNotifiyChannel: "#deploy",
+		AppGroups:           []AppGroup{group},
+		ApplicationList:     []Application{a, b},
+	})
+
+	releaser := &fakeReleaser{contents: map[string]string{"owner/manifests/dev/deployment.yaml": batchDeployment}}
+	f := newTestFlow()
+	f.releaser = releaser
+	f.httpClient = github.Client()
+	return f, group, releaser
+}
+
+func batchReleases(version string) []batchedRelease {
+	var releases []batchedRelease
+	c := currentConfig()
+	for i := range c.ApplicationList {
+		app := &c.ApplicationList[i]
+		releases = append(releases, batchedRelease{
+			e:        Event{Event: cloudbuildevent.Event{ID: "build-" + app.Name}},
+			tag:      version,
+			version:  version,
+			app:      app,
+			manifest: app.Manifests[0],
+		})
+	}
+	return releases
+}
+
+func TestBatchPromotion(t *testing.T) {
+	tests := []struct {
+		name     string
+		releases map[string]string
+		promoted bool
+	}{
+		{"not promoted", nil, false},
+		{"promoted", map[string]string{"/repos/owner/app-a/releases/tags/v1.0.0": `{"tag_name": "v1.0.0"}`}, true},
+	}
+	for _, tt := range tests {
+		slackAPI := newSlackServer()
+		github := newGitHubServer(tt.releases)
+		f, group, releaser := newBatchFlow(github)
+
+		pr := f.createBatchRelease(context.Background(), group, "dev", batchReleases("v1.0.0"))
+		if pr == nil || pr.status != prCreated {
+			t.Errorf("%s: released %+v, want a PR", tt.name, pr)
+		} else if releases := releaser.Releases(); len(releases) == 1 {
+			deployment := releases[0]["dev/deployment.yaml"]
+			for app, want := range map[string]bool{"app-a": tt.promoted, "app-b": true} {
+				if got := strings.Contains(deployment, "gcr.io/project/"+app+":v1.0.0"); got != want {
+					t.Errorf("%s: released %s: %v, want %v", tt.name, app, got, want)
+				}
+			}
+		} else {
+			t.Errorf("%s: opened %d PRs, want 1", tt.name, len(releases))
+		}
+
+		github.Close()
+		slackAPI.Close()
+	}
+}
+
+func TestBatchPostMerge(t *testing.T) {
+	slackAPI := newSlackServer()
+	defer slackAPI.Close()
+	github := newGitHubServer(nil)
+	defer github.Close()
+
+	f, group, releaser := newBatchFlow(github)
+	releaser.merge = gitbot.MergeMerged
+	// The hooks are requested through the client of the fake too
+	c := currentConfig()
+	c.ApplicationList[0].Manifests[0].Promotion = nil
+	for i := range c.ApplicationList {
+		c.ApplicationList[i].Manifests[0].PostMerge = &PostMerge{URL: "https://hooks.example.com/{{ .App }}"}
+	}
+
+	if pr := f.createBatchRelease(context.Background(), group, "dev", batchReleases("v1.0.0")); pr == nil || pr.status != prCreated {
+		t.Fatalf("released %+v, want a PR", pr)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		called := map[string]bool{}
+		for _, path := range github.Requests() {
+			called[path] = true
+		}
+		if called["/app-a"] && called["/app-b"] {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("requested %q, want the hooks of app-a and app-b", github.Requests())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBatchOpenPRLimit(t *testing.T) {
+	slackAPI := newSlackServer()
+	defer slackAPI.Close()
+	github := newGitHubServer(map[string]string{"/search/issues": `{"total_count": 1}`})
+	defer github.Close()
+
+	f, group, releaser := newBatchFlow(github)
+	currentConfig().OpenPRLimit = OpenPRLimit{Max: 1, Pause: true}
+
+	pr := f.createBatchRelease(context.Background(), group, "dev", batchReleases("v1.0.0")[1:])
+	if pr == nil || pr.status != prSkipped {
+		t.Errorf("released %+v, want it paused", pr)
+	}
+	if releases := releaser.Releases(); len(releases) > 0 {
+		t.Errorf("opened %d PRs over the open_pr_limit", len(releases))
+	}
+}
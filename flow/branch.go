@@ -0,0 +1,99 @@
+package flow
+
+import (
+	"fmt"
+	"os"
+	"path"
+)
+
+// targets expands the manifests with BaseBranches into a manifest per base branch
+func (a *Application) targets() []Manifest {
+	var targets []Manifest
+	for _, m := range a.Manifests {
+		if len(m.BaseBranches) == 0 {
+			targets = append(targets, m)
+			continue
+		}
+		for _, b := range m.BaseBranches {
+			t := m
+			t.BaseBranch = b
+			t.BaseBranches = nil
+			t.multiBranch = true
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
+
+// baseBranch is the branch of the manifest repository the manifest is released to
+func (a *Application) baseBranch(m Manifest) string {
+	if m.BaseBranch != "" {
+		return m.BaseBranch
+	}
+	return a.ManifestBaseBranch
+}
+
+// target is the env the manifest is released and reported as, env@branch for the ones
+// expanded from BaseBranches
+func (m Manifest) target() string {
+	if m.multiBranch {
+		return m.Env + "@" + m.BaseBranch
+	}
+	return m.Env
+}
+
+// location is where the env runs as region/cluster, empty without both
+func (m Manifest) location() string {
+	switch {
+	case m.Region != "" && m.Cluster != "":
+		return m.Region + "/" + m.Cluster
+	case m.Region != "":
+		return m.Region
+	}
+	return m.Cluster
+}
+
+// branchAllowed checks the source branch of the build against Manifest.AllowedSourceBranches.
+// Builds without a branch (tag builds) are gated by the tag filters instead.
+func branchAllowed(m Manifest, branch *string) bool {
+	if len(m.AllowedSourceBranches) == 0 || branch == nil {
+		return true
+	}
+
+	if matchBranch(m.AllowedSourceBranches, *branch) {
+		return true
+	}
+
+	fmt.Fprintf(os.Stdout, "Skipping %s, %s is not an allowed source branch\n", m.Env, *branch)
+	return false
+}
+
+// branchMatches checks the source branch of the build against the branch filters
+func (f Filters) branchMatches(branch *string) bool {
+	if branch == nil {
+		return true
+	}
+	if matchBranch(f.ExcludeBranches, *branch) {
+		return false
+	}
+	return len(f.IncludeBranches) == 0 || matchBranch(f.IncludeBranches, *branch)
+}
+
+// matchBranch matches either the exact branch or a path.Match pattern like release/*
+func matchBranch(patterns []string, branch string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, branch); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func validateBranchPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid branch pattern %s: %s", pattern, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package flow
+
+import "testing"
+
+func TestMatchBranch(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		branch   string
+		want     bool
+	}{
+		{[]string{"main"}, "main", true},
+		{[]string{"main"}, "main2", false},
+		{[]string{"release/*"}, "release/1.4", true},
+		{[]string{"release/*"}, "release/1.4/hotfix", false},
+		{[]string{"develop", "release/*"}, "release/1.4", true},
+		{nil, "main", false},
+	}
+	for _, tt := range tests {
+		if got := matchBranch(tt.patterns, tt.branch); got != tt.want {
+			t.Errorf("matchBranch(%q, %q) = %v, want %v", tt.patterns, tt.branch, got, tt.want)
+		}
+	}
+}
+
+func TestValidateBranchPatterns(t *testing.T) {
+	if err := validateBranchPatterns([]string{"main", "release/*", "hotfix-[0-9]*"}); err != nil {
+		t.Error(err)
+	}
+	if err := validateBranchPatterns([]string{"release/["}); err == nil {
+		t.Error("accepted an invalid pattern")
+	}
+}
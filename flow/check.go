@@ -0,0 +1,52 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sakajunquality/flow/gitbot"
+)
+
+// RemoteError is a file of a manifest which can't be read from its base branch,
+// File is empty when the files of the manifest can't be rendered
+type RemoteError struct {
+	App    string
+	Env    string
+	Branch string
+	File   string
+	Err    error
+}
+
+func (e RemoteError) Error() string {
+	return fmt.Sprintf("%s %s %s/%s: %s", e.App, e.Env, e.Branch, e.File, e.Err)
+}
+
+// CheckRemotes reads every file of every manifest from its base branch, so that the files
+// moved in the manifest repositories are found before a release fails on them
+func (f *Flow) CheckRemotes(ctx context.Context) ([]RemoteError, error) {
+	var problems []RemoteError
+	c := currentConfig()
+	for i := range c.ApplicationList {
+		a := c.ApplicationList[i]
+		for _, m := range a.targets() {
+			branch := a.baseBranch(m)
+			files, err := m.files(a)
+			if err != nil {
+				problems = append(problems, RemoteError{App: a.Name, Env: m.target(), Branch: branch, Err: err})
+				continue
+			}
+
+			repo := gitbot.NewRepo(a.ManifestOwner, a.ManifestName, branch)
+			repo.SetHTTPClient(f.httpClient)
+			for _, file := range files {
+				if _, err := f.getContent(ctx, repo, file); err != nil {
+					if ctx.Err() != nil {
+						return nil, ctx.Err()
+					}
+					problems = append(problems, RemoteError{App: a.Name, Env: m.target(), Branch: branch, File: file, Err: err})
+				}
+			}
+		}
+	}
+	return problems, nil
+}
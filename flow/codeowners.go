@@ -0,0 +1,81 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sakajunquality/flow/gitbot"
+)
+
+const (
+	codeOwnersLog     = "log"
+	codeOwnersRequest = "request"
+)
+
+// codeOwners returns the owners of the paths by the CODEOWNERS of the base branch,
+// none when the repository has no CODEOWNERS
+func (f *Flow) codeOwners(ctx context.Context, repo *gitbot.Repo, paths []string) ([]string, error) {
+	for _, p := range gitbot.CodeOwnersPaths {
+		content, err := f.getContent(ctx, repo, p)
+		if errors.Is(err, gitbot.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return gitbot.ParseCodeOwners(content).Owners(paths), nil
+	}
+	return nil, nil
+}
+
+// addCodeOwners logs the owners of the changed files, and adds them to the reviewers with
+// code_owners: request. The PR can't request a review from its own author, so it's left out.
+func (f *Flow) addCodeOwners(ctx context.Context, repo *gitbot.Repo, release *gitbot.Release, a Application, m Manifest, reviewers, teams []string) ([]string, []string, error) {
+	owners, err := f.codeOwners(ctx, repo, release.Paths())
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(owners) == 0 {
+		fmt.Fprintf(os.Stdout, "No code owners of the files of %s %s\n", a.Name, m.target())
+		return reviewers, teams, nil
+	}
+	fmt.Fprintf(os.Stdout, "Code owners of the files of %s %s: %s\n", a.Name, m.target(), strings.Join(owners, ", "))
+	if m.CodeOwners != codeOwnersRequest {
+		return reviewers, teams, nil
+	}
+
+	users, ownerTeams, others := gitbot.SplitOwners(owners)
+	if len(others) > 0 {
+		fmt.Fprintf(os.Stdout, "Can't request reviews from %s, only from users and teams\n", strings.Join(others, ", "))
+	}
+
+	// The reviewers are of the config, which must not be appended to
+	reviewers, teams = copyStrings(reviewers), copyStrings(teams)
+	var author string
+	if u, err := f.githubUser(ctx); err == nil {
+		author = u.Login
+	}
+	for _, u := range users {
+		if !strings.EqualFold(u, author) && !containsFold(reviewers, u) {
+			reviewers = append(reviewers, u)
+		}
+	}
+	for _, t := range ownerTeams {
+		if !containsFold(teams, t) {
+			teams = append(teams, t)
+		}
+	}
+	return reviewers, teams, nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,16 +1,174 @@
 package flow
 
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const defaultPRLabel = "managed-by/flow"
+
+// defaultAllowedFiles keep the globs and the templates of the files from matching e.g. a README
+var defaultAllowedFiles = []string{"*.yaml", "*.yml"}
+
+// Dates of the release commits, see Config.CommitDate
+const (
+	commitDateNow   = "now"
+	commitDateBuild = "build"
+)
+
+// Defaults of FetchLimits
+const (
+	defaultMaxFileSize  = 1 << 20
+	defaultMaxFiles     = 100
+	defaultFetchTimeout = time.Minute
+)
+
+// defaultMaxPRsPerEvent guards against a misconfiguration opening PRs to every manifest
+const defaultMaxPRsPerEvent = 20
+
+const (
+	updateStrategyRegex = "regex"
+	updateStrategyYAML  = "yaml"
+)
+
+// defaultClaimTTL outlasts the releases waiting for the required checks of their auto-merge
+const defaultClaimTTL = time.Hour
+
+const (
+	sourceStatusTarget   = "status"
+	sourceStatusCheckRun = "check_run"
+
+	defaultSourceStatusContext = "flow/release"
+)
+
+const (
+	imageMatchFull  = "full"
+	imageMatchShort = "short"
+)
+
+const (
+	replaceAll   = "all"
+	replaceFirst = "first"
+)
+
+const (
+	noImagesFail   = "fail"
+	noImagesIgnore = "ignore"
+)
+
+const (
+	openPRSupersede = "supersede"
+	openPRAmend     = "amend"
+)
+
+const (
+	pinByTag    = "tag"
+	pinByDigest = "digest"
+)
+
 type Config struct {
 	ApplicationList []Application `yaml:"applications"`
 	GitAuthor       GitAuthor     `yaml:"git_author"`
 
 	SlackNotifiyChannel string `yaml:"slack_notify_channel"`
+
+	// SlackWorkspaces are named Slack credentials the apps can notify instead of FLOW_SLACK_BOT_TOKEN
+	SlackWorkspaces []SlackWorkspace `yaml:"slack_workspaces"`
+
+	MessageTemplates MessageTemplates `yaml:"message_templates"`
+
+	// StateStore is either memory (default) or firestore, which is required for multiple instances
+	StateStore string `yaml:"state_store"`
+
+	// ClaimTTL frees the claims of the releases an instance stopped in the middle of,
+	// so that a redelivery of the event releases them again. Defaults to 1h.
+	ClaimTTL time.Duration `yaml:"claim_ttl"`
+
+	FailureDedup FailureDedup `yaml:"failure_dedup"`
+
+	// Registry authenticates the reads of the version_label of the apps
+	Registry RegistryAuth `yaml:"registry"`
+
+	// FailureLog adds the tail of the build log to the notifications of the failed builds
+	FailureLog FailureLog `yaml:"failure_log"`
+
+	// BuildDedupTTL ignores the redelivered events of the builds processed within the TTL (0 disables it)
+	BuildDedupTTL time.Duration `yaml:"build_dedup_ttl"`
+
+	// VersionTransform is applied to the image tag of every app before filtering and writing
+	VersionTransform VersionTransform `yaml:"version_transform"`
+
+	// PRLabel marks the PRs created by Flow, defaults to managed-by/flow
+	PRLabel string `yaml:"pr_label"`
+
+	// Notifiers are all notified of every message, defaults to slack only
+	Notifiers []NotifierConfig `yaml:"notifiers"`
+
+	// AppGroups batch the releases of their apps into a single PR per env
+	AppGroups []AppGroup `yaml:"app_groups"`
+
+	Subscriber Subscriber `yaml:"subscriber"`
+
+	// ResultTopic receives the EventResult of every event received from Pub/Sub as JSON,
+	// with the build_id and the schema (v1) attributes
+	ResultTopic string `yaml:"result_topic"`
+
+	// AppLease serializes the releases of each app across the instances, see AppLease
+	AppLease AppLease `yaml:"app_lease"`
+
+	// MaxPRsPerEvent aborts the events of an app which would release more envs, defaults to 20
+	MaxPRsPerEvent int `yaml:"max_prs_per_event"`
+
+	// ReopenClosedWithin reopens the PR of the same release closed without being merged within
+	// the duration, instead of opening another one. Disabled when 0.
+	ReopenClosedWithin time.Duration `yaml:"reopen_closed_within"`
+
+	// OpenPRLimit warns when the open PRs of Flow in a manifest repo pile up, see OpenPRLimit
+	OpenPRLimit OpenPRLimit `yaml:"open_pr_limit"`
+
+	// PRBody is the first section of the body of every PR, followed by the ones of the app and the manifest
+	PRBody string `yaml:"pr_body"`
+
+	// ManifestRepoConcurrency is the number of the releases written to a manifest repository at once, defaults to 1
+	ManifestRepoConcurrency int `yaml:"manifest_repo_concurrency"`
+
+	// AllowedFiles are the patterns of the files Flow may edit, matched against the path
+	// and the base name, defaults to *.yaml and *.yml
+	AllowedFiles []string `yaml:"allowed_files"`
+
+	// CommitDate is the date of the release commits, either now (default) or build, the finish time
+	// of the build, which falls back to now for the builds without it
+	CommitDate string `yaml:"commit_date"`
+
+	// RedactPatterns mask their matches in the logs besides the shapes of the GitHub, Slack and bearer tokens
+	RedactPatterns []string `yaml:"redact_patterns"`
+
+	// Fetch limits the reads of the files of the manifests
+	Fetch FetchLimits `yaml:"fetch"`
+
+	// NotifyOnlyOnChange skips the release message when no PR was created nor failed
+	NotifyOnlyOnChange bool `yaml:"notify_only_on_change"`
+
+	// Digest posts the releases of every day or week
+	Digest Digest `yaml:"digest"`
+
+	// AuditLog appends every release to a file of a repository, disabled when empty
+	AuditLog AuditLog `yaml:"audit_log"`
+
+	// index is built by New, see appIndex
+	index *appIndex
 }
 
 type Application struct {
 	Name string `yaml:"name"`
 
 	TriggerID string `yaml:"trigger_id"`
+	// TriggerName matches the events which carry the name of the trigger instead of its ID
+	TriggerName string `yaml:"trigger_name"`
 
 	SourceOwner        string `yaml:"source_owner"`
 	SourceName         string `yaml:"source_name"`
@@ -20,22 +178,780 @@ type Application struct {
 
 	ImageName string     `yaml:"image_tag"`
 	Manifests []Manifest `yaml:"manifests"`
+
+	// ImageMatch is either full (default), which only matches the image by its full name, or short,
+	// which also matches it without the registry host and by the repository alone, e.g. app:v1.0.0
+	ImageMatch string `yaml:"image_match"`
+
+	// Files are used by the manifests without files, see Manifest.Files
+	Files []string `yaml:"files"`
+
+	// DeployOnly apps publish no images, successful builds are notified as deploys
+	DeployOnly bool `yaml:"deploy_only"`
+
+	// NoImages is either fail (default), which notifies the successful builds without images
+	// as failures, or ignore, which only records them, e.g. for infra-only builds
+	NoImages string `yaml:"no_images"`
+
+	// BuildSuccess decides by the steps whether the builds succeeded, instead of by their status alone
+	BuildSuccess *BuildSuccess `yaml:"build_success"`
+
+	// DeployNotify restricts the deploy notifications to some envs, all of them are notified by default
+	DeployNotify DeployNotify `yaml:"deploy_notify"`
+
+	// ReleaseMessageOf is the app whose last release messages the deploys of this app
+	// are shown on, instead of posting new messages
+	ReleaseMessageOf string `yaml:"release_message_of"`
+
+	// SlackChannel overrides the global channel, and is overridden by the one of the manifest
+	SlackChannel string `yaml:"slack_channel"`
+
+	// GitAuthor overrides the global one
+	GitAuthor *GitAuthor `yaml:"git_author"`
+
+	// MaxPRsPerEvent overrides the global one
+	MaxPRsPerEvent int `yaml:"max_prs_per_event"`
+
+	// NotifyOnlyOnChange overrides the global one
+	NotifyOnlyOnChange *bool `yaml:"notify_only_on_change"`
+
+	// StatusChannel keeps a message of the versions of every env of the app up to date in the channel,
+	// which is edited on every release instead of posting new ones
+	StatusChannel string `yaml:"status_channel"`
+
+	// SlackWorkspace is the name of the SlackWorkspace notified, defaults to FLOW_SLACK_BOT_TOKEN
+	SlackWorkspace string `yaml:"slack_workspace"`
+
+	// VersionTransform overrides the global one
+	VersionTransform *VersionTransform `yaml:"version_transform"`
+
+	// VersionSource is where the version comes from, either image (default), the tag of the image,
+	// tag, the git tag of the build, or image_or_tag, the git tag when there are no tagged images
+	VersionSource string `yaml:"version_source"`
+
+	// VersionLabel reads the version from the label of the pushed image, e.g. org.opencontainers.image.version,
+	// for the images tagged with a commit. The images are then written by their tags instead of the versions.
+	// Only with the image version_source, the tag is used when the label is missing.
+	VersionLabel string `yaml:"version_label"`
+
+	// VersionPattern extracts the version from the tag with the named group (?P<version>...),
+	// the version transform is applied to the extracted version
+	VersionPattern string `yaml:"version_pattern"`
+
+	// AtomicRelease closes the PRs of the other envs when any env fails to be released,
+	// by default the other envs are released anyway
+	AtomicRelease bool `yaml:"atomic_release"`
+
+	// PRMode is either per_env (default), a PR per env, or single, which releases the envs of a build
+	// with a single PR on their common base branch. The first env decides the reviewers and the auto-merge.
+	PRMode string `yaml:"pr_mode"`
+
+	// VersionValidation is either semver or a pattern the version must match to be released
+	VersionValidation string `yaml:"version_validation"`
+
+	// PRBody is the section of the body of the PRs of the app, between the global and the manifest ones
+	PRBody string `yaml:"pr_body"`
+
+	// VerifySource fails the builds of other repositories than the source, defaults to true
+	VerifySource *bool `yaml:"verify_source"`
+
+	// SourceStatus posts the outcome of the releases to the source commit of the build
+	SourceStatus *SourceStatus `yaml:"source_status"`
+
+	// Marker also writes a file of the released version of the env in the PRs, opt-in
+	Marker *Marker `yaml:"marker"`
+
+	// BuildRepos are the owner/name of the repositories the trigger builds from when it isn't the
+	// source, e.g. a build config repository. The release links keep using the source.
+	BuildRepos []string `yaml:"build_repos"`
+
+	// IncludeReleaseLink links the GitHub release of the tag from the PRs, defaults to true.
+	// CheckReleaseLink only links the releases which exist, e.g. of the sources without releases.
+	IncludeReleaseLink *bool `yaml:"include_release_link"`
+	CheckReleaseLink   bool  `yaml:"check_release_link"`
+
+	// FailureIssue opens an issue of the failed build in the manifest repository besides the notification
+	FailureIssue bool `yaml:"failure_issue"`
+
+	// ImageRefTemplate is a Go template with .Image, .Tag and .Digest of the reference written
+	// to the manifests, e.g. {{ .Image }}:{{ .Tag }}@{{ .Digest }}. Defaults to image:tag.
+	ImageRefTemplate string `yaml:"image_ref_template"`
 }
 
 type Manifest struct {
-	Env        string   `yaml:"env"`
-	Files      []string `yaml:"files"`
-	Filters    Filters  `yaml:"filters"`
-	PRBody     string   `yaml:"pr_body"`
-	BaseBranch string   `yaml:"base_branch"`
+	Env string `yaml:"env"`
+	// Files are Go templates with .App and .Env, e.g. overlays/{{ .Env }}/kustomization.yaml
+	Files   []string `yaml:"files"`
+	Filters Filters  `yaml:"filters"`
+	// PRBody is a Go template with .App, .Env, .Version and the build .Substitutions,
+	// the last section of the body of the PRs of the env
+	PRBody     string `yaml:"pr_body"`
+	BaseBranch string `yaml:"base_branch"`
+	// BaseBranches release the env to each of the branches instead of BaseBranch, e.g. to
+	// parallel release lines, with a PR per branch reported as env@branch
+	BaseBranches []string `yaml:"base_branches"`
+	// multiBranch marks the manifests expanded from BaseBranches
+	multiBranch bool
+
+	// SlackChannel receives the result of this env only
+	SlackChannel string `yaml:"slack_channel"`
+
+	// Cluster and Region are shown next to the env in the messages, they are informational only
+	Cluster string `yaml:"cluster"`
+	Region  string `yaml:"region"`
+
+	// TagPrefix selects the image tagged for this env (e.g. prod-1.4.0)
+	// and is stripped from the version which is filtered and written
+	TagPrefix string `yaml:"tag_prefix"`
+
+	// PinnedVersion holds this env at the version, see also Flow.Pin
+	PinnedVersion string `yaml:"pinned_version"`
+
+	// UpdateStrategy is either regex (default), which replaces every "image:tag",
+	// or yaml, which only rewrites the image values of `image` keys keeping anchors as is
+	UpdateStrategy string `yaml:"update_strategy"`
+
+	// ImagePattern replaces the generated pattern of the regex update_strategy, see ImagePattern
+	ImagePattern *ImagePattern `yaml:"image_pattern"`
+
+	// Replace is either all (default), which updates every reference to the image of a file,
+	// e.g. of the init containers too, or first, which only updates the first one
+	Replace string `yaml:"replace"`
+
+	// ReleaseTag is a Go template with .App, .Env and .Version of a tag created on the
+	// release commit, e.g. deployed/{{ .Env }}/{{ .Version }}. An existing tag is kept
+	// unless MoveReleaseTag.
+	ReleaseTag     string `yaml:"release_tag"`
+	MoveReleaseTag bool   `yaml:"move_release_tag"`
+
+	// PinBy is either tag (default) or digest, which writes image@sha256:... pushed by the build.
+	// The tag is still filtered and linked from the PR.
+	PinBy string `yaml:"pin_by"`
+
+	// AllowedSourceBranches are exact branches or patterns like release/* allowed to release to this env
+	AllowedSourceBranches []string `yaml:"allowed_source_branches"`
+
+	// OpenPR is either supersede (default), which opens a PR per version, or amend, which
+	// pushes a newer version onto the open PR of the env and updates its title and body
+	OpenPR string `yaml:"open_pr"`
+
+	// Cooldown is the minimum interval since the last release of the env,
+	// the releases within it are skipped (0 disables it)
+	Cooldown time.Duration `yaml:"cooldown"`
+
+	// PostMerge calls a hook once the PR of the release is merged, e.g. to sync Argo CD
+	PostMerge *PostMerge `yaml:"post_merge"`
+
+	// ForceDryRun computes the releases of the env without opening their PRs, e.g. during an incident,
+	// while the other envs are released. Toggle it at runtime with Flow.ApplicationHandler.
+	ForceDryRun bool `yaml:"force_dry_run"`
+
+	// Promotion releases to the env only the versions whose GitHub release promotes them
+	Promotion *Promotion `yaml:"promotion"`
+
+	// Bootstrap inserts a block into the files which don't reference the image yet,
+	// instead of skipping them, e.g. for the first release of a new app
+	Bootstrap *Bootstrap `yaml:"bootstrap"`
+
+	// Reviewers are requested up to ReviewerCount (0 requests all of them)
+	Reviewers     []string `yaml:"reviewers"`
+	ReviewerCount int      `yaml:"reviewer_count"`
+	TeamReviewers []string `yaml:"team_reviewers"`
+	// CodeOwners looks up the owners of the changed files in the CODEOWNERS of the manifest repo,
+	// log only logs them and request also requests their reviews (the default is neither)
+	CodeOwners string `yaml:"code_owners"`
+
+	// AutoMerge merges the PR once it's opened, RequiredChecks must be
+	// required by the base branch protection and ChecksTimeout waits for them to be reported
+	AutoMerge      bool          `yaml:"auto_merge"`
+	RequiredChecks []string      `yaml:"required_checks"`
+	ChecksTimeout  time.Duration `yaml:"checks_timeout"`
+
+	// MergeCommitTitle and MergeCommitBody are Go templates of the commit of the auto-merge,
+	// rendered from the same data as PRBody, GitHub's default when empty
+	MergeCommitTitle string `yaml:"merge_commit_title"`
+	MergeCommitBody  string `yaml:"merge_commit_body"`
 }
 
 type Filters struct {
-	IncludePrefixes []string `yaml:"include_prefixes"`
-	ExcludePrefixes []string `yaml:"exclude_prefixes"`
+	// IncludePrefixes and ExcludePrefixes match the start of the version, the build metadata
+	// of semantic versions (1.4.0+build.27) is a suffix and never changes the result
+	IncludePrefixes []string `yaml:"include_prefixes" json:"include_prefixes,omitempty"`
+	ExcludePrefixes []string `yaml:"exclude_prefixes" json:"exclude_prefixes,omitempty"`
+
+	// IncludeBranches and ExcludeBranches are exact branches or patterns like feature/*
+	// of the source branch, the builds without a branch (tag builds) are not filtered by them
+	IncludeBranches []string `yaml:"include_branches" json:"include_branches,omitempty"`
+	ExcludeBranches []string `yaml:"exclude_branches" json:"exclude_branches,omitempty"`
+}
+
+// PostMerge is a request made once the release PR is merged. The PRs which aren't merged right
+// away are polled until Timeout (defaults to 24h), the polls don't survive a restart of Flow.
+type PostMerge struct {
+	// URL and Body are Go templates with .App, .Env, .Version and .PRURL,
+	// Body defaults to the JSON {"app", "env", "version", "pr_url"}
+	URL  string `yaml:"url"`
+	Body string `yaml:"body"`
+	// Method defaults to POST
+	Method string `yaml:"method"`
+	// TokenEnv is the environment variable of the bearer token, no Authorization when empty
+	TokenEnv string        `yaml:"token_env"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+func (p PostMerge) timeout() time.Duration {
+	if p.Timeout <= 0 {
+		return defaultPostMergeTimeout
+	}
+	return p.Timeout
+}
+
+// Promotion is what the GitHub release of the tag needs to release it to the env. The release
+// must exist and not be a draft.
+type Promotion struct {
+	// Stable refuses the prereleases
+	Stable bool `yaml:"stable"`
+	// Marker is a text the name or the body of the release must contain, e.g. production-ready
+	Marker string `yaml:"marker"`
+}
+
+// Bootstrap is the block inserted into the files without the image
+type Bootstrap struct {
+	// After is a pattern of the line the block is inserted after, the block is appended when empty
+	After string `yaml:"after"`
+	// Block is a Go template with .App, .Env, .Version and .Image, the reference of the image
+	Block string `yaml:"block"`
+}
+
+// SourceStatus posts the outcome of the releases of a build to its commit of the source repository
+type SourceStatus struct {
+	// Target is status (default), a commit status, or check_run, which only GitHub Apps can create
+	Target string `yaml:"target"`
+	// Context is the name of the status or the check run, defaults to flow/release
+	Context string `yaml:"context"`
+}
+
+// Marker is a file of the manifest repository recording the last released version of each env
+type Marker struct {
+	// Path is a Go template with .App and .Env, e.g. .flow/versions/{{ .Env }}.yaml
+	Path string `yaml:"path"`
+	// Content is a Go template with .App, .Env, .Version and the build .Substitutions
+	Content string `yaml:"content"`
+}
+
+// OpenPRLimit counts the open PRs with the pr_label of the manifest repo before each release,
+// and warns once an hour when there are Max of them or more (0 disables it)
+type OpenPRLimit struct {
+	Max int `yaml:"max"`
+	// Pause skips the releases to the repo until it's under Max again
+	Pause bool `yaml:"pause"`
+}
+
+// ImagePattern is an escape hatch for the files the generated "image:.*" over-matches,
+// e.g. with trailing comments
+type ImagePattern struct {
+	// Search is the regexp of the references, e.g. gcr.io/proj/app:[^\s#]+
+	Search string `yaml:"search"`
+	// Replace is a Go template with .Image, .Ref and .Version of the replacement,
+	// which may refer to the groups of Search like $1
+	Replace string `yaml:"replace"`
+	// Files are the rendered paths of the files the pattern is used for, all of them when empty
+	Files []string `yaml:"files"`
+}
+
+// BuildSuccess has the IDs of the steps (the id of the build config)
+type BuildSuccess struct {
+	// RequiredSteps must succeed, even when the build succeeded
+	RequiredSteps []string `yaml:"required_steps"`
+	// OptionalSteps may fail, a failed build succeeds when the other steps succeeded
+	OptionalSteps []string `yaml:"optional_steps"`
+}
+
+// DeployNotify resolves the env of a deploy build by the EnvSubstitution of the build, by Branches
+// and by the base branches of the manifests, in this order
+type DeployNotify struct {
+	// Envs are notified, the deploys of the other envs are not
+	Envs            []string `yaml:"envs"`
+	EnvSubstitution string   `yaml:"env_substitution"`
+	// Branches maps the branches of the deploy builds to the envs
+	Branches map[string]string `yaml:"branches"`
+}
+
+// RegistryAuth is used when the registry asks for credentials, the reads are anonymous otherwise
+type RegistryAuth struct {
+	// Google uses the access token of the default credentials, e.g. for gcr.io and pkg.dev
+	Google bool `yaml:"google"`
+	// Username and the password of the PasswordEnv environment variable, for the other registries
+	Username    string `yaml:"username"`
+	PasswordEnv string `yaml:"password_env"`
+}
+
+// FailureLog is read from the logs bucket of the build, which the service account must be able to read
+type FailureLog struct {
+	// Lines is how many of the last lines are shown (0 disables it)
+	Lines int `yaml:"lines"`
+	// MaxBytes truncates the lines, defaults to 2000 which fits a Slack message
+	MaxBytes int `yaml:"max_bytes"`
 }
 
+func (l FailureLog) maxBytes() int {
+	if l.MaxBytes <= 0 {
+		return defaultFailureLogBytes
+	}
+	return l.MaxBytes
+}
+
+// FailureDedup suppresses identical failure notifications within Window (0 disables it)
+type FailureDedup struct {
+	Window time.Duration `yaml:"window"`
+	// Key is a Go template with .App, .Env, .Error, the class of the failure (e.g. version), and .Message,
+	// failures with different keys always notify. .Env is empty for the failures of the whole app.
+	Key string `yaml:"key"`
+	// StillFailing adds the number of suppressed failures to the next notification
+	StillFailing bool `yaml:"still_failing"`
+}
+
+// AppGroup collects the releases of the apps for Window from the first one,
+// the apps must share the manifest repository
+type AppGroup struct {
+	Name   string        `yaml:"name"`
+	Apps   []string      `yaml:"apps"`
+	Window time.Duration `yaml:"window"`
+}
+
+// AppLease serializes the releases of each app across the instances sharing the store, disabled
+// when TTL is 0. A single instance already releases each app one at a time.
+type AppLease struct {
+	// TTL frees the lease of an instance which stopped while releasing
+	TTL time.Duration `yaml:"ttl"`
+	// Wait is how long a release waits for the lease, the event is redelivered when it's still held
+	Wait time.Duration `yaml:"wait"`
+}
+
+// Subscriber tunes the Pub/Sub subscription, zero values keep the defaults of the client
+type Subscriber struct {
+	MaxOutstandingMessages int `yaml:"max_outstanding_messages"`
+	NumGoroutines          int `yaml:"num_goroutines"`
+	// OrderByApp processes the events of different apps at once, while the events of
+	// each app are still processed one at a time. By default every event is.
+	OrderByApp bool `yaml:"order_by_app"`
+
+	// MaxAttempts acks the events which failed with retryable errors as many times (0 retries forever),
+	// publishing them to DeadLetterTopic, or only logging them without it, for a manual replay
+	MaxAttempts     int    `yaml:"max_attempts"`
+	DeadLetterTopic string `yaml:"dead_letter_topic"`
+}
+
+// FetchLimits guard the reads of the files of the manifest repositories, exceeding them fails the env
+type FetchLimits struct {
+	// MaxFileSize is in bytes, defaults to 1MB
+	MaxFileSize int `yaml:"max_file_size"`
+	// MaxFiles is the number of the files of a release, defaults to 100
+	MaxFiles int `yaml:"max_files"`
+	// Timeout is of reading all the files of a release, defaults to 1m
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Digest posts the releases of the last period to Channel, disabled without Schedule
+type Digest struct {
+	// Schedule is either daily or weekly, which is posted on Mondays
+	Schedule string `yaml:"schedule"`
+	// At is the time of the post as 15:04 in TimeZone, defaults to 09:00 UTC
+	At       string `yaml:"at"`
+	TimeZone string `yaml:"time_zone"`
+	// Channel defaults to the global channel
+	Channel string `yaml:"channel"`
+}
+
+// AuditLog is the file the releases are committed to, one line of
+// "time app env version url" separated by tabs per release
+type AuditLog struct {
+	Owner  string `yaml:"owner"`
+	Name   string `yaml:"name"`
+	Branch string `yaml:"branch"`
+	File   string `yaml:"file"`
+}
+
+// SlackWorkspace is a Slack credential, the token is read from the environment variable
+type SlackWorkspace struct {
+	Name     string `yaml:"name"`
+	TokenEnv string `yaml:"token_env"`
+}
+
+type NotifierConfig struct {
+	// Type is either slack or webhook
+	Type string `yaml:"type"`
+	// URL receives the JSON of the webhook notifier
+	URL string `yaml:"url"`
+}
+
+// GitAuthor commits the releases, GitHubID or FromToken replace the email with the
+// noreply address of the account, ID+login@users.noreply.github.com, for verified commits
 type GitAuthor struct {
 	Name  string `yaml:"name"`
 	Email string `yaml:"email"`
+	// GitHubID and Login (defaults to Name) are of the account of the noreply address
+	GitHubID int64  `yaml:"github_id"`
+	Login    string `yaml:"login"`
+	// FromToken derives the noreply address and the default name from the account of the GitHub token
+	FromToken bool `yaml:"from_token"`
+}
+
+// MessageTemplates are Go templates rendered from slackbot.MessageDetail
+type MessageTemplates struct {
+	Success string `yaml:"success"`
+	Failure string `yaml:"failure"`
+	Deploy  string `yaml:"deploy"`
+	PR      string `yaml:"pr"`
+}
+
+func (c *Config) validate() error {
+	workspaces := map[string]bool{}
+	for _, w := range c.SlackWorkspaces {
+		if w.Name == "" || w.TokenEnv == "" {
+			return errors.New("slack_workspaces need name and token_env")
+		}
+		if workspaces[w.Name] {
+			return fmt.Errorf("duplicated slack_workspaces %s", w.Name)
+		}
+		workspaces[w.Name] = true
+	}
+
+	if c.CommitDate != "" && c.CommitDate != commitDateNow && c.CommitDate != commitDateBuild {
+		return fmt.Errorf("unknown commit_date %s, it is either now or build", c.CommitDate)
+	}
+
+	if c.Digest.Schedule != "" {
+		if _, err := c.Digest.next(time.Now()); err != nil {
+			return fmt.Errorf("digest: %s", err)
+		}
+	}
+
+	if _, err := parseTemplate("pr_body", c.PRBody); err != nil {
+		return fmt.Errorf("invalid pr_body: %s", err)
+	}
+
+	for _, pattern := range c.RedactPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("redact_patterns %q: %s", pattern, err)
+		}
+	}
+
+	for _, pattern := range c.AllowedFiles {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("allowed_files %q: %s", pattern, err)
+		}
+	}
+
+	// The events carry either the ID or the name of the trigger, so each must resolve to a single app
+	triggers := map[string]string{}
+	for _, app := range c.ApplicationList {
+		for _, trigger := range []string{app.TriggerID, app.TriggerName} {
+			if other, ok := triggers[trigger]; ok && trigger != "" && other != app.Name {
+				return fmt.Errorf("%s and %s have the same trigger %s", other, app.Name, trigger)
+			}
+			triggers[trigger] = app.Name
+		}
+	}
+
+	for _, app := range c.ApplicationList {
+		if app.SlackWorkspace != "" && !workspaces[app.SlackWorkspace] {
+			return fmt.Errorf("unknown slack_workspace of %s: %s", app.Name, app.SlackWorkspace)
+		}
+
+		if app.VersionTransform != nil {
+			if err := app.VersionTransform.validate(); err != nil {
+				return fmt.Errorf("invalid version_transform of %s: %s", app.Name, err)
+			}
+		}
+
+		if app.VersionPattern != "" {
+			if err := validateVersionPattern(app.VersionPattern); err != nil {
+				return fmt.Errorf("invalid version_pattern of %s: %s", app.Name, err)
+			}
+		}
+
+		if app.GitAuthor != nil {
+			if err := validateGitAuthor(*app.GitAuthor); err != nil {
+				return fmt.Errorf("invalid git_author of %s: %s", app.Name, err)
+			}
+		}
+
+		if app.VersionLabel != "" && !app.versionFromImage() {
+			return fmt.Errorf("version_label of %s needs the image version_source", app.Name)
+		}
+		switch app.VersionSource {
+		case "", versionSourceImage, versionSourceTag, versionSourceImageOrTag:
+		default:
+			return fmt.Errorf("unknown version_source of %s: %s", app.Name, app.VersionSource)
+		}
+
+		switch app.NoImages {
+		case "", noImagesFail, noImagesIgnore:
+		default:
+			return fmt.Errorf("unknown no_images of %s: %s", app.Name, app.NoImages)
+		}
+
+		switch app.PRMode {
+		case "", prModePerEnv:
+		case prModeSingle:
+			if err := app.validateSingle(c); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown pr_mode of %s: %s", app.Name, app.PRMode)
+		}
+
+		if err := validateVersionValidation(app.VersionValidation); err != nil {
+			return fmt.Errorf("invalid version_validation of %s: %s", app.Name, err)
+		}
+
+		for _, repo := range app.BuildRepos {
+			if parts := strings.Split(repo, "/"); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return fmt.Errorf("invalid build_repos of %s: %q is not owner/name", app.Name, repo)
+			}
+		}
+
+		switch app.ImageMatch {
+		case "", imageMatchFull, imageMatchShort:
+		default:
+			return fmt.Errorf("unknown image_match of %s: %s", app.Name, app.ImageMatch)
+		}
+
+		if s := app.SourceStatus; s != nil {
+			switch s.Target {
+			case "", sourceStatusTarget, sourceStatusCheckRun:
+			default:
+				return fmt.Errorf("unknown source_status target of %s: %s", app.Name, s.Target)
+			}
+		}
+
+		if m := app.Marker; m != nil {
+			if m.Path == "" || m.Content == "" {
+				return fmt.Errorf("marker of %s needs a path and a content", app.Name)
+			}
+			if _, err := parseTemplate("marker", m.Path); err != nil {
+				return fmt.Errorf("invalid marker path of %s: %s", app.Name, err)
+			}
+			if _, err := parseTemplate("marker", m.Content); err != nil {
+				return fmt.Errorf("invalid marker content of %s: %s", app.Name, err)
+			}
+		}
+
+		if _, err := parseTemplate("pr_body", app.PRBody); err != nil {
+			return fmt.Errorf("invalid pr_body of %s: %s", app.Name, err)
+		}
+
+		if _, err := parseTemplate("image_ref_template", app.ImageRefTemplate); err != nil {
+			return fmt.Errorf("invalid image_ref_template of %s: %s", app.Name, err)
+		}
+
+		for _, m := range app.Manifests {
+			if _, err := parseTemplate("pr_body", m.PRBody); err != nil {
+				return fmt.Errorf("invalid pr_body of %s %s: %s", app.Name, m.Env, err)
+			}
+			if p := m.PostMerge; p != nil {
+				if p.URL == "" {
+					return fmt.Errorf("post_merge of %s %s needs a url", app.Name, m.Env)
+				}
+				if _, err := parseTemplate("post_merge.url", p.URL); err != nil {
+					return fmt.Errorf("invalid post_merge url of %s %s: %s", app.Name, m.Env, err)
+				}
+				if _, err := parseTemplate("post_merge.body", p.Body); err != nil {
+					return fmt.Errorf("invalid post_merge body of %s %s: %s", app.Name, m.Env, err)
+				}
+			}
+			switch m.CodeOwners {
+			case "", codeOwnersLog, codeOwnersRequest:
+			default:
+				return fmt.Errorf("unknown code_owners of %s %s: %s, it is either log or request", app.Name, m.Env, m.CodeOwners)
+			}
+			if _, err := parseTemplate("merge_commit_title", m.MergeCommitTitle); err != nil {
+				return fmt.Errorf("invalid merge_commit_title of %s %s: %s", app.Name, m.Env, err)
+			}
+			if _, err := parseTemplate("merge_commit_body", m.MergeCommitBody); err != nil {
+				return fmt.Errorf("invalid merge_commit_body of %s %s: %s", app.Name, m.Env, err)
+			}
+			if _, err := parseTemplate("release_tag", m.ReleaseTag); err != nil {
+				return fmt.Errorf("invalid release_tag of %s %s: %s", app.Name, m.Env, err)
+			}
+			if _, err := m.allowedFiles(app, c.allowedFiles()); err != nil {
+				return fmt.Errorf("invalid files of %s %s: %s", app.Name, m.Env, err)
+			}
+			if m.BaseBranch != "" && len(m.BaseBranches) > 0 {
+				return fmt.Errorf("%s %s has both base_branch and base_branches", app.Name, m.Env)
+			}
+			branches := map[string]bool{}
+			for _, b := range m.BaseBranches {
+				if branches[b] {
+					return fmt.Errorf("%s %s has the duplicated base_branches %s", app.Name, m.Env, b)
+				}
+				branches[b] = true
+			}
+			if b := m.Bootstrap; b != nil {
+				if b.Block == "" {
+					return fmt.Errorf("bootstrap of %s %s needs a block", app.Name, m.Env)
+				}
+				if _, err := parseTemplate("bootstrap", b.Block); err != nil {
+					return fmt.Errorf("invalid bootstrap block of %s %s: %s", app.Name, m.Env, err)
+				}
+				if _, err := regexp.Compile(b.After); err != nil {
+					return fmt.Errorf("invalid bootstrap after of %s %s: %s", app.Name, m.Env, err)
+				}
+			}
+			switch m.UpdateStrategy {
+			case "", updateStrategyRegex, updateStrategyYAML:
+			default:
+				return fmt.Errorf("unknown update_strategy of %s %s: %s", app.Name, m.Env, m.UpdateStrategy)
+			}
+			if p := m.ImagePattern; p != nil {
+				if m.UpdateStrategy == updateStrategyYAML {
+					return fmt.Errorf("image_pattern of %s %s needs the regex update_strategy", app.Name, m.Env)
+				}
+				if p.Search == "" || p.Replace == "" {
+					return fmt.Errorf("image_pattern of %s %s needs search and replace", app.Name, m.Env)
+				}
+				if _, err := regexp.Compile(p.Search); err != nil {
+					return fmt.Errorf("invalid image_pattern search of %s %s: %s", app.Name, m.Env, err)
+				}
+				if _, err := parseTemplate("image_pattern", p.Replace); err != nil {
+					return fmt.Errorf("invalid image_pattern replace of %s %s: %s", app.Name, m.Env, err)
+				}
+			}
+			switch m.Replace {
+			case "", replaceAll, replaceFirst:
+			default:
+				return fmt.Errorf("unknown replace of %s %s: %s", app.Name, m.Env, m.Replace)
+			}
+			switch m.OpenPR {
+			case "", openPRSupersede, openPRAmend:
+			default:
+				return fmt.Errorf("unknown open_pr of %s %s: %s", app.Name, m.Env, m.OpenPR)
+			}
+			switch m.PinBy {
+			case "", pinByTag, pinByDigest:
+			default:
+				return fmt.Errorf("unknown pin_by of %s %s: %s", app.Name, m.Env, m.PinBy)
+			}
+			if err := validateBranchPatterns(m.AllowedSourceBranches); err != nil {
+				return fmt.Errorf("invalid allowed_source_branches of %s %s: %s", app.Name, m.Env, err)
+			}
+			if err := validateBranchPatterns(m.Filters.IncludeBranches); err != nil {
+				return fmt.Errorf("invalid include_branches of %s %s: %s", app.Name, m.Env, err)
+			}
+			if err := validateBranchPatterns(m.Filters.ExcludeBranches); err != nil {
+				return fmt.Errorf("invalid exclude_branches of %s %s: %s", app.Name, m.Env, err)
+			}
+		}
+	}
+	if err := validateGitAuthor(c.GitAuthor); err != nil {
+		return fmt.Errorf("invalid git_author: %s", err)
+	}
+
+	if err := c.VersionTransform.validate(); err != nil {
+		return fmt.Errorf("invalid version_transform: %s", err)
+	}
+
+	if _, err := parseTemplate("failure_dedup.key", c.FailureDedup.Key); err != nil {
+		return fmt.Errorf("invalid failure_dedup key: %s", err)
+	}
+
+	if a := c.AuditLog; a != (AuditLog{}) && (a.Owner == "" || a.Name == "" || a.Branch == "" || a.File == "") {
+		return errors.New("audit_log needs owner, name, branch and file")
+	}
+
+	for _, g := range c.AppGroups {
+		if err := c.validateAppGroup(g); err != nil {
+			return fmt.Errorf("invalid app_groups %s: %s", g.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) validateAppGroup(g AppGroup) error {
+	if g.Name == "" {
+		return errors.New("name is empty")
+	}
+
+	var repo string
+	for _, name := range g.Apps {
+		var app *Application
+		for i := range c.ApplicationList {
+			if c.ApplicationList[i].Name == name {
+				app = &c.ApplicationList[i]
+			}
+		}
+		if app == nil {
+			return fmt.Errorf("unknown app %s", name)
+		}
+
+		r := app.ManifestOwner + "/" + app.ManifestName
+		if repo != "" && r != repo {
+			return fmt.Errorf("%s is not in the manifest repository %s", name, repo)
+		}
+		repo = r
+	}
+	return nil
+}
+
+func (c *Config) prLabel() string {
+	if c.PRLabel == "" {
+		return defaultPRLabel
+	}
+	return c.PRLabel
+}
+
+func (c *Config) claimTTL() time.Duration {
+	if c.ClaimTTL <= 0 {
+		return defaultClaimTTL
+	}
+	return c.ClaimTTL
+}
+
+// maxPRs is the number of releases an event of the app may create
+func (a *Application) maxPRs() int {
+	if a.MaxPRsPerEvent > 0 {
+		return a.MaxPRsPerEvent
+	}
+	if c := currentConfig(); c.MaxPRsPerEvent > 0 {
+		return c.MaxPRsPerEvent
+	}
+	return defaultMaxPRsPerEvent
+}
+
+func (c *Config) repoConcurrency() int {
+	if c.ManifestRepoConcurrency > 0 {
+		return c.ManifestRepoConcurrency
+	}
+	return 1
+}
+
+// fetchLimits fills in the defaults of the unset limits
+func (c *Config) fetchLimits() FetchLimits {
+	l := c.Fetch
+	if l.MaxFileSize <= 0 {
+		l.MaxFileSize = defaultMaxFileSize
+	}
+	if l.MaxFiles <= 0 {
+		l.MaxFiles = defaultMaxFiles
+	}
+	if l.Timeout <= 0 {
+		l.Timeout = defaultFetchTimeout
+	}
+	return l
+}
+
+func (c *Config) allowedFiles() []string {
+	if len(c.AllowedFiles) > 0 {
+		return c.AllowedFiles
+	}
+	return defaultAllowedFiles
+}
+
+func (a *Application) notifyOnlyOnChange() bool {
+	if a.NotifyOnlyOnChange != nil {
+		return *a.NotifyOnlyOnChange
+	}
+	return currentConfig().NotifyOnlyOnChange
 }
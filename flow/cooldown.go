@@ -0,0 +1,24 @@
+package flow
+
+import (
+	"context"
+	"time"
+)
+
+// cooldown returns how long the env still cools down from its last release, 0 when it doesn't
+func (f *Flow) cooldown(ctx context.Context, app *Application, m Manifest) (time.Duration, error) {
+	if m.Cooldown <= 0 {
+		return 0, nil
+	}
+
+	releasedAt, err := f.store.GetLastReleaseAt(ctx, app.Name, m.target())
+	if err != nil || releasedAt.IsZero() {
+		return 0, err
+	}
+
+	remaining := m.Cooldown - f.now().Sub(releasedAt)
+	if remaining < 0 {
+		return 0, nil
+	}
+	return remaining.Round(time.Second), nil
+}
@@ -0,0 +1,90 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/sakajunquality/flow/gitbot"
+)
+
+// EnvVersions are the references to the image of the app in the files of an env
+type EnvVersions struct {
+	Branch string        `json:"branch"`
+	Files  []FileVersion `json:"files"`
+	// Refs are the distinct references of all the files, in the order they were found
+	Refs []string `json:"refs"`
+	// Inconsistent is set when the files reference the image at more than one tag or digest
+	Inconsistent bool `json:"inconsistent"`
+}
+
+// FileVersion are the references to the image in a file, Error is why the file couldn't be read
+type FileVersion struct {
+	Path  string   `json:"path"`
+	Refs  []string `json:"refs"`
+	Error string   `json:"error,omitempty"`
+}
+
+// CurrentVersions reads the files of every env of the app from their base branches and returns
+// the references to the image by env, e.g. {"production": {"refs": ["gcr.io/app:v1.2.3"]}}
+func (f *Flow) CurrentVersions(ctx context.Context, appName string) (map[string]EnvVersions, error) {
+	c := currentConfig()
+	var app *Application
+	for i := range c.ApplicationList {
+		if c.ApplicationList[i].Name == appName {
+			app = &c.ApplicationList[i]
+			break
+		}
+	}
+	if app == nil {
+		return nil, fmt.Errorf("No application found for %s", appName)
+	}
+
+	// The same image the releases rewrite, up to a quote, a comment or the end of the line
+	re, err := regexp.Compile(regexp.QuoteMeta(app.ImageName) + `[:@][^\s"'#]*`)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := map[string]EnvVersions{}
+	for _, m := range app.targets() {
+		files, err := m.files(*app)
+		if err != nil {
+			return nil, err
+		}
+
+		v := EnvVersions{Branch: app.baseBranch(m), Files: []FileVersion{}, Refs: []string{}}
+		repo := gitbot.NewRepo(app.ManifestOwner, app.ManifestName, v.Branch)
+		repo.SetHTTPClient(f.httpClient)
+
+		seen := map[string]bool{}
+		for _, file := range files {
+			fv := FileVersion{Path: file, Refs: []string{}}
+			content, err := f.getContent(ctx, repo, file)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				fv.Error = f.redact(err.Error())
+				v.Files = append(v.Files, fv)
+				continue
+			}
+
+			fileSeen := map[string]bool{}
+			for _, ref := range re.FindAllString(content, -1) {
+				if !fileSeen[ref] {
+					fileSeen[ref] = true
+					fv.Refs = append(fv.Refs, ref)
+				}
+				if !seen[ref] {
+					seen[ref] = true
+					v.Refs = append(v.Refs, ref)
+				}
+			}
+			v.Files = append(v.Files, fv)
+		}
+		v.Inconsistent = len(v.Refs) > 1
+		versions[m.target()] = v
+	}
+	return versions, nil
+}
@@ -0,0 +1,71 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// giveUp records the failed attempt of the event and tells whether it has failed
+// Subscriber.MaxAttempts times, in which case the event is dead-lettered and notified once
+func (f *Flow) giveUp(ctx context.Context, e Event, msg *pubsub.Message, err error) bool {
+	limit := currentConfig().Subscriber.MaxAttempts
+	if limit <= 0 || e.ID == "" {
+		return false
+	}
+
+	errs, serr := f.store.AddAttempt(ctx, e.ID, f.redact(err.Error()))
+	if serr != nil {
+		// Retrying is safe, the releases are claimed
+		fmt.Fprintf(os.Stderr, "Error recording the attempt of %s: %s\n", e.ID, serr)
+		return false
+	}
+	if len(errs) < limit {
+		return false
+	}
+
+	fmt.Fprintf(os.Stderr, "Error: giving up on event %s after %d attempts: %s\n", e.ID, len(errs), strings.Join(errs, "; "))
+	f.deadLetterEvent(ctx, e, msg, errs)
+	// The event of an app is notified to its channel
+	var app *Application
+	if apps, err := f.resolver.Resolve(ctx, e); err == nil && len(apps) == 1 {
+		app = &apps[0]
+	}
+	f.notifyFalure(ctx, e, classDeadLetter, fmt.Sprintf("Gave up on the event after %d attempts, replay it once fixed:\n%s", len(errs), strings.Join(errs, "\n")), app, nil)
+	f.clearAttempts(ctx, e)
+	return true
+}
+
+// deadLetterEvent publishes the event to Subscriber.DeadLetterTopic, or logs it without the topic
+func (f *Flow) deadLetterEvent(ctx context.Context, e Event, msg *pubsub.Message, errs []string) {
+	if f.deadLetter == nil {
+		fmt.Fprintf(os.Stderr, "Dead-lettered event %s: %s\n", e.ID, msg.Data)
+		return
+	}
+
+	result := f.deadLetter.Publish(ctx, &pubsub.Message{
+		Data: msg.Data,
+		Attributes: map[string]string{
+			"build_id": e.ID,
+			"attempts": strconv.Itoa(len(errs)),
+			"errors":   strings.Join(errs, "\n"),
+		},
+	})
+	if _, err := result.Get(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Error dead-lettering event %s, dropping: %s\n%s\n", e.ID, err, msg.Data)
+	}
+}
+
+// clearAttempts forgets the failed attempts of the event once it's done with
+func (f *Flow) clearAttempts(ctx context.Context, e Event) {
+	if currentConfig().Subscriber.MaxAttempts <= 0 || e.ID == "" {
+		return
+	}
+	if err := f.store.ClearAttempts(ctx, e.ID); err != nil {
+		fmt.Fprintf(os.Stderr, "Error clearing the attempts of %s: %s\n", e.ID, err)
+	}
+}
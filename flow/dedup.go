@@ -0,0 +1,107 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultDedupKey = "{{ .App }}/{{ .Env }}/{{ .Error }}"
+
+// dedupKeyData is what FailureDedup.Key renders from, Error is the class of the failure
+// (e.g. version) and Message the whole error message
+type dedupKeyData struct {
+	App     string
+	Env     string
+	Error   string
+	Message string
+}
+
+// failureDeduper suppresses identical failures within the window
+type failureDeduper struct {
+	mu       sync.Mutex
+	window   time.Duration
+	failures map[string]*failureRecord
+}
+
+type failureRecord struct {
+	notifiedAt time.Time
+	suppressed int
+}
+
+func newFailureDeduper(window time.Duration) *failureDeduper {
+	return &failureDeduper{
+		window:   window,
+		failures: map[string]*failureRecord{},
+	}
+}
+
+// check reports whether the failure should be notified,
+// along with how many identical failures were suppressed since the last notification
+func (d *failureDeduper) check(key string, now time.Time) (bool, int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for k, r := range d.failures {
+		if now.Sub(r.notifiedAt) >= d.window && r.suppressed == 0 {
+			delete(d.failures, k)
+		}
+	}
+
+	r, ok := d.failures[key]
+	if !ok {
+		d.failures[key] = &failureRecord{notifiedAt: now}
+		return true, 0
+	}
+
+	if now.Sub(r.notifiedAt) < d.window {
+		r.suppressed++
+		return false, r.suppressed
+	}
+
+	suppressed := r.suppressed
+	r.notifiedAt = now
+	r.suppressed = 0
+	return true, suppressed
+}
+
+// buildProcessed tells whether the build was fully processed within BuildDedupTTL,
+// e.g. when Pub/Sub redelivers the event
+func (f *Flow) buildProcessed(ctx context.Context, e Event) bool {
+	if currentConfig().BuildDedupTTL <= 0 || e.ID == "" {
+		return false
+	}
+
+	processed, err := f.store.IsBuildProcessed(ctx, e.ID)
+	if err != nil {
+		// Processing it again is safe, the releases are claimed
+		fmt.Fprintf(os.Stderr, "Error checking the build %s: %s\n", e.ID, err)
+		return false
+	}
+	return processed
+}
+
+// markBuildProcessed records the build unless any of the envs failed, which are retried on redelivery.
+// The failures of the whole apps, e.g. of the builds, fail the same way again and are recorded.
+func (f *Flow) markBuildProcessed(ctx context.Context, e Event, prs PullRequests) {
+	ttl := currentConfig().BuildDedupTTL
+	if ttl <= 0 || e.ID == "" || f.DryRun || prs.envFailed() {
+		return
+	}
+
+	if err := f.store.MarkBuildProcessed(ctx, e.ID, ttl); err != nil {
+		fmt.Fprintf(os.Stderr, "Error recording the build %s: %s\n", e.ID, err)
+	}
+}
+
+// envFailed tells whether any of the envs failed, unlike failed it ignores the failures of the whole apps
+func (prs PullRequests) envFailed() bool {
+	for _, pr := range prs {
+		if pr.err != nil && pr.env != "" {
+			return true
+		}
+	}
+	return false
+}
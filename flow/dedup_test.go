@@ -0,0 +1,116 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sakajunquality/flow/slackbot"
+)
+
+func TestFailureDeduperCheck(t *testing.T) {
+	start := time.Now()
+	d := newFailureDeduper(10 * time.Minute)
+
+	tests := []struct {
+		key        string
+		after      time.Duration
+		notify     bool
+		suppressed int
+	}{
+		{"app//build failure", 0, true, 0},
+		{"app//build failure", time.Minute, false, 1},
+		{"app//build failure", 2 * time.Minute, false, 2},
+		{"app//version", 3 * time.Minute, true, 0},
+		{"app//build failure", 11 * time.Minute, true, 2},
+		{"app//build failure", 12 * time.Minute, false, 1},
+	}
+	for i, tt := range tests {
+		notify, suppressed := d.check(tt.key, start.Add(tt.after))
+		if notify != tt.notify || suppressed != tt.suppressed {
+			t.Errorf("#%d check(%q) = %v, %d, want %v, %d", i, tt.key, notify, suppressed, tt.notify, tt.suppressed)
+		}
+	}
+}
+
+func TestDedupFailure(t *testing.T) {
+	setConfig(&Config{})
+	f := &Flow{deduper: newFailureDeduper(time.Hour)}
+	prod := &Manifest{Env: "prod"}
+	dev := &Manifest{Env: "dev"}
+
+	tests := []struct {
+		name    string
+		app     string
+		message string
+		class   string
+		m       *Manifest
+		notify  bool
+	}{
+		{"first build failure", "app", "", classBuild, nil, true},
+		{"same build failure", "app", "", classBuild, nil, false},
+		{"build failure of another app", "other", "", classBuild, nil, true},
+		{"version of prod", "app", "v1 is invalid", classVersion, prod, true},
+		{"another version of prod", "app", "v2 is invalid", classVersion, prod, false},
+		{"version of dev", "app", "v2 is invalid", classVersion, dev, true},
+	}
+	for _, tt := range tests {
+		d := slackbot.MessageDetail{AppName: tt.app, ErrorMessage: tt.message}
+		if notify, _ := f.dedupFailure(d, tt.class, tt.m); notify != tt.notify {
+			t.Errorf("%s: notify = %v, want %v", tt.name, notify, tt.notify)
+		}
+	}
+}
+
+func TestBuildDedup(t *testing.T) {
+	slackAPI := newSlackServer()
+	defer slackAPI.Close()
+
+	tests := []struct {
+		name     string
+		ttl      time.Duration
+		ids      []string
+		messages int
+	}{
+		{"redelivered failure", time.Hour, []string{"build", "build"}, 1},
+		{"other build", time.Hour, []string{"build-1", "build-2"}, 2},
+		// Without the dedup, the redelivered failures are notified again
+		{"without dedup", 0, []string{"build", "build"}, 2},
+	}
+	for _, tt := range tests {
+		setConfig(&Config{
+			SlackNotifiyChannel: "#deploy",
+			BuildDedupTTL:       tt.ttl,
+			ApplicationList:     []Application{{Name: "app", TriggerID: "trigger"}},
+		})
+		f := newTestFlow()
+
+		for _, id := range tt.ids {
+			e := testEvent("FAILURE", []string{"gcr.io/project/app:v1.0.0"}, "", "v1.0.0")
+			e.ID = id
+			f.process(context.Background(), e)
+		}
+		if posts := slackAPI.Posts(); len(posts) != tt.messages {
+			t.Errorf("%s: posted %d messages, want %d", tt.name, len(posts), tt.messages)
+		}
+	}
+}
+
+func TestEnvFailed(t *testing.T) {
+	tests := []struct {
+		name string
+		prs  PullRequests
+		want bool
+	}{
+		{"no releases", nil, false},
+		{"created", PullRequests{{env: "prod", url: "https://github.com/owner/manifests/pull/1"}}, false},
+		{"failed build", appFailedPRs(&Application{Name: "app"}, errors.New("build FAILURE")), false},
+		{"failed env", PullRequests{{env: "dev"}, {env: "prod", err: errors.New("conflict")}}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.prs.envFailed(); got != tt.want {
+			t.Errorf("%s: envFailed = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package flow
+
+import (
+	"fmt"
+	"os"
+)
+
+// deployEnv resolves the env of the deploy build by the env_substitution, the branches
+// of deploy_notify and the base branches of the manifests, empty when it's unknown
+func (a *Application) deployEnv(e Event) string {
+	n := a.DeployNotify
+	if n.EnvSubstitution != "" {
+		if env := e.Substitutions[n.EnvSubstitution]; env != "" {
+			return env
+		}
+	}
+	if e.BranchName == nil {
+		return ""
+	}
+
+	if env, ok := n.Branches[*e.BranchName]; ok {
+		return env
+	}
+	for _, m := range a.targets() {
+		if a.baseBranch(m) == *e.BranchName {
+			return m.Env
+		}
+	}
+	return ""
+}
+
+// deployNotified tells whether the deploy is notified, the deploys of an unknown env are
+// notified so that a missing mapping doesn't hide them
+func (a *Application) deployNotified(e Event) bool {
+	envs := a.DeployNotify.Envs
+	if len(envs) == 0 {
+		return true
+	}
+
+	env := a.deployEnv(e)
+	if env == "" {
+		fmt.Fprintf(os.Stdout, "Could not resolve the env of the deploy of %s, notifying it\n", a.Name)
+		return true
+	}
+	for _, notified := range envs {
+		if env == notified {
+			return true
+		}
+	}
+	fmt.Fprintf(os.Stdout, "Skipping the deploy notification of %s %s, which is not in deploy_notify\n", a.Name, env)
+	return false
+}
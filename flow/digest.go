@@ -0,0 +1,140 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sakajunquality/flow/slackbot"
+)
+
+const (
+	digestDaily  = "daily"
+	digestWeekly = "weekly"
+)
+
+// next returns the first post of the digest after t
+func (d Digest) next(t time.Time) (time.Time, error) {
+	if d.Schedule != digestDaily && d.Schedule != digestWeekly {
+		return time.Time{}, fmt.Errorf("unknown schedule %q, it is either daily or weekly", d.Schedule)
+	}
+
+	at := d.At
+	if at == "" {
+		at = "09:00"
+	}
+	clock, err := time.Parse("15:04", at)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("at %q is not 15:04", d.At)
+	}
+
+	loc := time.UTC
+	if d.TimeZone != "" {
+		if loc, err = time.LoadLocation(d.TimeZone); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	t = t.In(loc)
+	next := time.Date(t.Year(), t.Month(), t.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)
+	for !next.After(t) || (d.Schedule == digestWeekly && next.Weekday() != time.Monday) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next, nil
+}
+
+// since is the start of the period of the post at
+func (d Digest) since(at time.Time) time.Time {
+	if d.Schedule == digestWeekly {
+		return at.AddDate(0, 0, -7)
+	}
+	return at.AddDate(0, 0, -1)
+}
+
+// runDigest posts the digest on its schedule until ctx is done
+func (f *Flow) runDigest(ctx context.Context) {
+	for {
+		d := currentConfig().Digest
+		at, err := d.next(f.now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error scheduling the digest: %s\n", err)
+			return
+		}
+
+		timer := time.NewTimer(at.Sub(f.now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		f.postDigest(ctx, d, at)
+	}
+}
+
+// postDigest posts the releases of the period ending at, the replica which claims the post posts it
+func (f *Flow) postDigest(ctx context.Context, d Digest, at time.Time) {
+	if !f.DryRun {
+		key := "digest/" + at.UTC().Format(time.RFC3339)
+		// The digest is only posted at its time, a redelivery can't post it again
+		ok, err := f.store.Claim(ctx, key, 0)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error claiming the digest %s: %s\n", key, err)
+			return
+		}
+		if !ok {
+			return
+		}
+	}
+
+	since := d.since(at)
+	records, err := f.store.Releases(ctx, since, at)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error getting the releases of the digest: %s\n", err)
+		return
+	}
+
+	channel := d.Channel
+	if channel == "" {
+		channel = currentConfig().SlackNotifiyChannel
+	}
+	f.post(ctx, channel, slackbot.MessageDetail{
+		IsSuccess: true,
+		AppName:   fmt.Sprintf("Releases since %s", since.Format("2006-01-02 15:04 MST")),
+		Body:      digestText(records),
+	})
+}
+
+// digestText lists the versions released to each env of every app, in the order they were released
+func digestText(records []ReleaseRecord) string {
+	if len(records) == 0 {
+		return "Nothing was released\n"
+	}
+
+	var apps []string
+	versions := map[string]map[string][]string{}
+	envs := map[string][]string{}
+	for _, r := range records {
+		if _, ok := versions[r.App]; !ok {
+			apps = append(apps, r.App)
+			versions[r.App] = map[string][]string{}
+		}
+		if _, ok := versions[r.App][r.Env]; !ok {
+			envs[r.App] = append(envs[r.App], r.Env)
+		}
+		versions[r.App][r.Env] = append(versions[r.App][r.Env], r.Version)
+	}
+	sort.Strings(apps)
+
+	var text string
+	for _, app := range apps {
+		text += fmt.Sprintf("*%s*\n", app)
+		for _, env := range envs[app] {
+			text += fmt.Sprintf("`%s` %s\n", env, strings.Join(versions[app][env], ", "))
+		}
+	}
+	return text
+}
@@ -0,0 +1,103 @@
+package flow
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/sakajunquality/cloud-pubsub-events/cloudbuildevent"
+)
+
+// Event is a Cloud Build event including the fields cloudbuildevent doesn't decode
+type Event struct {
+	cloudbuildevent.Event
+	Substitutions map[string]string `json:"substitutions"`
+	Results       Results           `json:"results"`
+	CreateTime    *time.Time        `json:"createTime"`
+	LogsBucket    string            `json:"logsBucket"`
+
+	// SourceProvenance has the commit of the build, see commitSHA
+	SourceProvenance SourceProvenance `json:"sourceProvenance"`
+
+	// Steps shadow the ones of cloudbuildevent, which have no ID
+	Steps []BuildStep `json:"steps"`
+}
+
+// BuildStep is a step of the build, the ID is the id of the step in the build config
+type BuildStep struct {
+	cloudbuildevent.Step
+	ID string `json:"id"`
+}
+
+// SourceProvenance is the source Cloud Build resolved, e.g. the commit of the branch
+type SourceProvenance struct {
+	ResolvedRepoSource struct {
+		CommitSha string `json:"commitSha"`
+	} `json:"resolvedRepoSource"`
+}
+
+// durations are how long the build ran and how long it was queued, zero when the times are missing
+func (e Event) durations() (build, queue time.Duration) {
+	if e.StartTime == nil || e.StartTime.IsZero() {
+		return 0, 0
+	}
+	if e.FinishTime != nil && !e.FinishTime.IsZero() && e.FinishTime.After(*e.StartTime) {
+		build = e.FinishTime.Sub(*e.StartTime)
+	}
+	if e.CreateTime != nil && !e.CreateTime.IsZero() && e.StartTime.After(*e.CreateTime) {
+		queue = e.StartTime.Sub(*e.CreateTime)
+	}
+	return build, queue
+}
+
+type Results struct {
+	Images []BuiltImage `json:"images"`
+}
+
+// BuiltImage is an image pushed by the build, Name includes the tag
+type BuiltImage struct {
+	Name   string `json:"name"`
+	Digest string `json:"digest"`
+}
+
+// imageDigest returns the digest of the image pushed with the tag, empty when it's unknown
+func (e Event) imageDigest(tag string) string {
+	for _, image := range e.Results.Images {
+		if getTagFromImage(image.Name) == tag {
+			return image.Digest
+		}
+	}
+	return ""
+}
+
+// State is what Flow does with an event
+type State int
+
+const (
+	// StateIgnore skips the event, e.g. of a build which hasn't finished
+	StateIgnore State = iota
+	StateSuccess
+	StateFailure
+	// StateDeploy notifies the event as a deploy, like the builds of DeployOnly apps
+	StateDeploy
+)
+
+// StateClassifier classifies the events, e.g. to handle the statuses of Cloud Build
+// which cloudbuildevent doesn't know
+type StateClassifier func(e Event) State
+
+// DefaultStateClassifier ignores the unfinished builds and classifies the others by their success
+func DefaultStateClassifier(e Event) State {
+	if !e.IsFinished() {
+		return StateIgnore
+	}
+	if !e.IsSuuccess() {
+		return StateFailure
+	}
+	return StateSuccess
+}
+
+func ParseEvent(data []byte) (Event, error) {
+	var e Event
+	err := json.Unmarshal(data, &e)
+	return e, err
+}
@@ -0,0 +1,24 @@
+package flow
+
+import "testing"
+
+func TestImageDigest(t *testing.T) {
+	e := Event{Results: Results{Images: []BuiltImage{
+		{Name: "gcr.io/project/app:latest", Digest: "sha256:0000"},
+		{Name: "gcr.io/project/app:v1.0.0", Digest: "sha256:1111"},
+	}}}
+
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{"v1.0.0", "sha256:1111"},
+		{"latest", "sha256:0000"},
+		{"v1.1.0", ""},
+	}
+	for _, tt := range tests {
+		if got := e.imageDigest(tt.tag); got != tt.want {
+			t.Errorf("imageDigest(%q) = %q, want %q", tt.tag, got, tt.want)
+		}
+	}
+}
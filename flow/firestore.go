@@ -0,0 +1,377 @@
+package flow
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/sakajunquality/flow/slackbot"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	claimsCollection   = "flow-claims"
+	releasesCollection = "flow-releases"
+	historyCollection  = "flow-release-history"
+	pinsCollection     = "flow-pins"
+	statusCollection   = "flow-statuses"
+	messagesCollection = "flow-status-messages"
+	buildsCollection   = "flow-builds"
+	attemptsCollection = "flow-attempts"
+	leasesCollection   = "flow-leases"
+)
+
+type firestoreStore struct {
+	client *firestore.Client
+}
+
+// claimDoc is pending until it's completed, see Store.Claim
+type claimDoc struct {
+	Key       string    `firestore:"key"`
+	ClaimedAt time.Time `firestore:"claimed_at"`
+	Pending   bool      `firestore:"pending"`
+}
+
+type releaseDoc struct {
+	App        string    `firestore:"app"`
+	Env        string    `firestore:"env"`
+	Version    string    `firestore:"version"`
+	ReleasedAt time.Time `firestore:"released_at"`
+}
+
+// NewFirestoreStore returns a Store which is safe to share between multiple instances,
+// it connects to the emulator at FIRESTORE_EMULATOR_HOST when it's set
+func NewFirestoreStore(ctx context.Context, projectID string) (Store, error) {
+	var opts []option.ClientOption
+	if host := os.Getenv("FIRESTORE_EMULATOR_HOST"); host != "" {
+		conn, err := grpc.Dial(host, grpc.WithInsecure())
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, option.WithGRPCConn(conn))
+	}
+
+	client, err := firestore.NewClient(ctx, projectID, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &firestoreStore{client: client}, nil
+}
+
+// Claim takes over the stale claims in a transaction, so only one instance wins
+func (s *firestoreStore) Claim(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	doc := s.client.Collection(claimsCollection).Doc(docID(key))
+
+	var claimed bool
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		claimed = false
+		snap, err := tx.Get(doc)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		now := time.Now()
+		if err == nil {
+			var c claimDoc
+			if err := snap.DataTo(&c); err != nil {
+				return err
+			}
+			if !c.Pending || ttl <= 0 || now.Sub(c.ClaimedAt) < ttl {
+				return nil
+			}
+		}
+
+		claimed = true
+		return tx.Set(doc, claimDoc{Key: key, ClaimedAt: now, Pending: true})
+	})
+	return claimed, err
+}
+
+func (s *firestoreStore) CompleteClaim(ctx context.Context, key string) error {
+	_, err := s.client.Collection(claimsCollection).Doc(docID(key)).Update(ctx, []firestore.Update{
+		{Path: "pending", Value: false},
+	})
+	return err
+}
+
+func (s *firestoreStore) Unclaim(ctx context.Context, key string) error {
+	_, err := s.client.Collection(claimsCollection).Doc(docID(key)).Delete(ctx)
+	return err
+}
+
+func (s *firestoreStore) SetLastRelease(ctx context.Context, app, env, version string, releasedAt time.Time) error {
+	r := releaseDoc{App: app, Env: env, Version: version, ReleasedAt: releasedAt}
+	_, err := s.client.Batch().
+		Set(s.client.Collection(releasesCollection).Doc(docID(app+"/"+env)), r).
+		Set(s.client.Collection(historyCollection).Doc(docID(app+"/"+env+"/"+version)), r).
+		Commit(ctx)
+	return err
+}
+
+func (s *firestoreStore) Releases(ctx context.Context, since, until time.Time) ([]ReleaseRecord, error) {
+	snaps, err := s.client.Collection(historyCollection).
+		Where("released_at", ">=", since).
+		Where("released_at", "<", until).
+		OrderBy("released_at", firestore.Asc).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var records []ReleaseRecord
+	for _, snap := range snaps {
+		var r releaseDoc
+		if err := snap.DataTo(&r); err != nil {
+			return nil, err
+		}
+		records = append(records, ReleaseRecord{App: r.App, Env: r.Env, Version: r.Version, ReleasedAt: r.ReleasedAt})
+	}
+	return records, nil
+}
+
+func (s *firestoreStore) GetLastRelease(ctx context.Context, app, env string) (string, error) {
+	r, err := s.lastRelease(ctx, app, env)
+	if err != nil || r == nil {
+		return "", err
+	}
+	return r.Version, nil
+}
+
+func (s *firestoreStore) GetLastReleaseAt(ctx context.Context, app, env string) (time.Time, error) {
+	r, err := s.lastRelease(ctx, app, env)
+	if err != nil || r == nil {
+		return time.Time{}, err
+	}
+	return r.ReleasedAt, nil
+}
+
+// lastRelease returns nil when nothing was released yet
+func (s *firestoreStore) lastRelease(ctx context.Context, app, env string) (*releaseDoc, error) {
+	snap, err := s.client.Collection(releasesCollection).Doc(docID(app + "/" + env)).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var r releaseDoc
+	if err := snap.DataTo(&r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+type pinDoc struct {
+	App      string    `firestore:"app"`
+	Env      string    `firestore:"env"`
+	Version  string    `firestore:"version"`
+	PinnedAt time.Time `firestore:"pinned_at"`
+}
+
+func (s *firestoreStore) SetPin(ctx context.Context, app, env, version string) error {
+	doc := s.client.Collection(pinsCollection).Doc(docID(app + "/" + env))
+	if version == "" {
+		_, err := doc.Delete(ctx)
+		return err
+	}
+
+	_, err := doc.Set(ctx, pinDoc{App: app, Env: env, Version: version, PinnedAt: time.Now()})
+	return err
+}
+
+func (s *firestoreStore) GetPin(ctx context.Context, app, env string) (string, error) {
+	snap, err := s.client.Collection(pinsCollection).Doc(docID(app + "/" + env)).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var p pinDoc
+	if err := snap.DataTo(&p); err != nil {
+		return "", err
+	}
+	return p.Version, nil
+}
+
+type statusMessageDoc struct {
+	App  string                `firestore:"app"`
+	Refs []slackbot.MessageRef `firestore:"refs"`
+}
+
+func (s *firestoreStore) SetStatusMessage(ctx context.Context, app string, refs []slackbot.MessageRef) error {
+	_, err := s.client.Collection(messagesCollection).Doc(docID(app)).Set(ctx, statusMessageDoc{App: app, Refs: refs})
+	return err
+}
+
+func (s *firestoreStore) GetStatusMessage(ctx context.Context, app string) ([]slackbot.MessageRef, error) {
+	snap, err := s.client.Collection(messagesCollection).Doc(docID(app)).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var m statusMessageDoc
+	if err := snap.DataTo(&m); err != nil {
+		return nil, err
+	}
+	return m.Refs, nil
+}
+
+func (s *firestoreStore) SetAppStatus(ctx context.Context, appStatus AppStatus) error {
+	_, err := s.client.Collection(statusCollection).Doc(docID(appStatus.App)).Set(ctx, appStatus)
+	return err
+}
+
+func (s *firestoreStore) GetAppStatus(ctx context.Context, app string) (*AppStatus, error) {
+	snap, err := s.client.Collection(statusCollection).Doc(docID(app)).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var st AppStatus
+	if err := snap.DataTo(&st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// buildDoc expires at ExpiresAt, which a TTL policy of Firestore can delete it at
+type buildDoc struct {
+	ID          string    `firestore:"id"`
+	ProcessedAt time.Time `firestore:"processed_at"`
+	ExpiresAt   time.Time `firestore:"expires_at"`
+}
+
+func (s *firestoreStore) MarkBuildProcessed(ctx context.Context, buildID string, ttl time.Duration) error {
+	now := time.Now()
+	_, err := s.client.Collection(buildsCollection).Doc(docID(buildID)).Set(ctx, buildDoc{
+		ID:          buildID,
+		ProcessedAt: now,
+		ExpiresAt:   now.Add(ttl),
+	})
+	return err
+}
+
+func (s *firestoreStore) IsBuildProcessed(ctx context.Context, buildID string) (bool, error) {
+	snap, err := s.client.Collection(buildsCollection).Doc(docID(buildID)).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var b buildDoc
+	if err := snap.DataTo(&b); err != nil {
+		return false, err
+	}
+	return time.Now().Before(b.ExpiresAt), nil
+}
+
+type attemptDoc struct {
+	ID        string    `firestore:"id"`
+	Errors    []string  `firestore:"errors"`
+	UpdatedAt time.Time `firestore:"updated_at"`
+}
+
+func (s *firestoreStore) AddAttempt(ctx context.Context, buildID, errorMessage string) ([]string, error) {
+	doc := s.client.Collection(attemptsCollection).Doc(docID(buildID))
+
+	var errs []string
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		a := attemptDoc{ID: buildID}
+		snap, err := tx.Get(doc)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			if err := snap.DataTo(&a); err != nil {
+				return err
+			}
+		}
+
+		a.Errors = append(a.Errors, errorMessage)
+		a.UpdatedAt = time.Now()
+		errs = a.Errors
+		return tx.Set(doc, a)
+	})
+	return errs, err
+}
+
+func (s *firestoreStore) ClearAttempts(ctx context.Context, buildID string) error {
+	_, err := s.client.Collection(attemptsCollection).Doc(docID(buildID)).Delete(ctx)
+	return err
+}
+
+type leaseDoc struct {
+	Key       string    `firestore:"key"`
+	Holder    string    `firestore:"holder"`
+	ExpiresAt time.Time `firestore:"expires_at"`
+}
+
+func (s *firestoreStore) AcquireLease(ctx context.Context, key, holder string, ttl time.Duration) (bool, error) {
+	doc := s.client.Collection(leasesCollection).Doc(docID(key))
+
+	var acquired bool
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		acquired = false
+		snap, err := tx.Get(doc)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		now := time.Now()
+		if err == nil {
+			var l leaseDoc
+			if err := snap.DataTo(&l); err != nil {
+				return err
+			}
+			if l.Holder != holder && now.Before(l.ExpiresAt) {
+				return nil
+			}
+		}
+
+		acquired = true
+		return tx.Set(doc, leaseDoc{Key: key, Holder: holder, ExpiresAt: now.Add(ttl)})
+	})
+	return acquired, err
+}
+
+func (s *firestoreStore) ReleaseLease(ctx context.Context, key, holder string) error {
+	doc := s.client.Collection(leasesCollection).Doc(docID(key))
+
+	return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		snap, err := tx.Get(doc)
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var l leaseDoc
+		if err := snap.DataTo(&l); err != nil {
+			return err
+		}
+		// Taken by another holder after this one expired
+		if l.Holder != holder {
+			return nil
+		}
+		return tx.Delete(doc)
+	})
+}
+
+// docID escapes the key since document IDs can't contain slashes
+func docID(key string) string {
+	return url.PathEscape(key)
+}
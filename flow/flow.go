@@ -4,9 +4,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
 
 	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/storage"
+	"github.com/sakajunquality/flow/gitbot"
+	"github.com/sakajunquality/flow/slackbot"
 )
 
 const (
@@ -14,29 +22,156 @@ const (
 	subName       = "cloudbuild-flow-sub"
 )
 
-var (
-	subscription *pubsub.Subscription
-	cfg          *Config
-)
+var subscription *pubsub.Subscription
 
 type Flow struct {
-	Env           string
+	Env string
+	// DryRun skips every write to GitHub and Slack
+	DryRun bool
+	// OnlyApps and SkipApps restrict the apps which are processed, the events of the others are ignored
+	OnlyApps []string
+	SkipApps []string
+	// JSONResults writes the EventResult of every event received from Pub/Sub to stdout as a JSON line
+	JSONResults bool
+
 	projectID     string
 	slackBotToken string
-	githubToken   string
+	// slackTokens are the tokens of the named slack workspaces
+	slackTokens map[string]string
+	// adminToken authorizes ApplicationHandler, which is disabled without it
+	adminToken  string
+	githubToken *refreshingToken
+	templates   *slackbot.Templates
+	store       Store
+	deduper     *failureDeduper
+	httpClient  *http.Client
+	notifier    Notifier
+	releaser    Releaser
+	resolver    AppResolver
+	versions    VersionResolver
+	classify    StateClassifier
+	now         func() time.Time
+	batcher     *batcher
+	deadLetter  *pubsub.Topic
+	// resultTopic receives the EventResult of every event, see Config.ResultTopic
+	resultTopic *pubsub.Topic
+	// logs reads the build logs, see Config.FailureLog
+	logs *storage.Client
+	// openPRWarnings throttles the warnings of the open_pr_limit per manifest repo
+	openPRWarnings *failureDeduper
+	// releaseMessages are kept in memory, so deploys handled by another instance post new messages
+	releaseMessages *releaseMessages
+	auditLog        *auditLog
+	// redactPatterns and redactors mask the secrets of the logs, see redact
+	redactPatterns []*regexp.Regexp
+	redactors      []Redactor
+
+	// user is the account of the GitHub token, see GitAuthor.FromToken
+	userMu sync.Mutex
+	user   *gitbot.User
+
+	cancelReceive context.CancelFunc
+	cancelProcess context.CancelFunc
+	stopped       chan struct{}
 }
 
-func New(c *Config) (*Flow, error) {
-	cfg = c
+func New(c *Config, opts ...Option) (*Flow, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	cfgMu.Lock()
+	setConfig(c)
+	cfgMu.Unlock()
 	f := &Flow{
-		Env:           os.Getenv("FLOW_ENV"),
-		projectID:     os.Getenv("FLOW_GCP_PROJECT_ID"),
-		slackBotToken: os.Getenv("FLOW_SLACK_BOT_TOKEN"),
-		githubToken:   os.Getenv("FLOW_GITHUB_TOKEN"),
+		Env:             os.Getenv("FLOW_ENV"),
+		projectID:       os.Getenv("FLOW_GCP_PROJECT_ID"),
+		slackBotToken:   os.Getenv("FLOW_SLACK_BOT_TOKEN"),
+		adminToken:      os.Getenv("FLOW_ADMIN_TOKEN"),
+		OnlyApps:        SplitList(os.Getenv("FLOW_ONLY_APPS")),
+		SkipApps:        SplitList(os.Getenv("FLOW_SKIP_APPS")),
+		httpClient:      &http.Client{Timeout: defaultHTTPTimeout},
+		releaseMessages: newReleaseMessages(),
+		openPRWarnings:  newFailureDeduper(openPRWarnInterval),
+		releaser:        githubReleaser{},
+		resolver:        configResolver{},
+		classify:        DefaultStateClassifier,
+		now:             time.Now,
+	}
+
+	tokenProvider := githubTokenProvider()
+	if tokenProvider != nil {
+		f.githubToken = newRefreshingToken(tokenProvider, defaultTokenRefresh)
+	}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+	if f.versions == nil {
+		f.versions = registryVersionResolver{httpClient: f.httpClient, auth: c.Registry}
+	}
+
+	if f.Env == "" || f.projectID == "" || f.slackBotToken == "" || f.githubToken == nil {
+		return nil, errors.New("You need to specify a non-empty value for FLOW_ENV, FLOW_GCP_PROJECT_ID, FLOW_SLACK_BOT_TOKEN and FLOW_GITHUB_TOKEN (or FLOW_GITHUB_TOKEN_FILE or FLOW_GITHUB_TOKEN_SECRET)")
+	}
+
+	f.slackTokens = map[string]string{}
+	for _, w := range c.SlackWorkspaces {
+		token := os.Getenv(w.TokenEnv)
+		if token == "" {
+			return nil, fmt.Errorf("You need to specify a non-empty value for %s of the slack workspace %s", w.TokenEnv, w.Name)
+		}
+		f.slackTokens[w.Name] = token
+	}
+
+	patterns, err := compileRedactPatterns(c.RedactPatterns)
+	if err != nil {
+		return nil, err
+	}
+	f.redactPatterns = patterns
+
+	t := c.MessageTemplates
+	templates, err := slackbot.NewTemplates(t.Success, t.Failure, t.Deploy, t.PR)
+	if err != nil {
+		return nil, err
+	}
+	f.templates = templates
+
+	if f.notifier == nil {
+		notifier, err := f.newNotifier(c.Notifiers)
+		if err != nil {
+			return nil, err
+		}
+		f.notifier = notifier
 	}
 
-	if f.Env == "" || f.projectID == "" || f.slackBotToken == "" || f.githubToken == "" {
-		return nil, errors.New("You need to specify a non-empty value for FLOW_ENV, FLOW_GCP_PROJECT_ID, FLOW_SLACK_BOT_TOKEN and FLOW_GITHUB_TOKEN")
+	if c.AuditLog != (AuditLog{}) {
+		f.auditLog = f.newAuditLog(c.AuditLog)
+	}
+
+	if c.FailureDedup.Window > 0 {
+		f.deduper = newFailureDeduper(c.FailureDedup.Window)
+	}
+
+	if c.FailureLog.Lines > 0 {
+		logs, err := storage.NewClient(context.Background())
+		if err != nil {
+			return nil, fmt.Errorf("Error creating storage client: %v", err)
+		}
+		f.logs = logs
+	}
+
+	switch c.StateStore {
+	case "", "memory":
+		f.store = NewMemoryStore()
+	case "firestore":
+		store, err := NewFirestoreStore(context.Background(), f.projectID)
+		if err != nil {
+			return nil, fmt.Errorf("Error creating firestore client: %v", err)
+		}
+		f.store = store
+	default:
+		return nil, fmt.Errorf("Unknown state_store %s", c.StateStore)
 	}
 
 	return f, nil
@@ -45,7 +180,8 @@ func New(c *Config) (*Flow, error) {
 func (f *Flow) Start(ctx context.Context, errCh chan error) {
 	pubsubClient, err := pubsub.NewClient(ctx, f.projectID)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating pubsub client: %v.\n", err)
+		errCh <- fmt.Errorf("Error creating pubsub client: %v", err)
+		return
 	}
 
 	// Create Cloud Pub/Sub topic if not exist
@@ -68,5 +204,57 @@ func (f *Flow) Start(ctx context.Context, errCh chan error) {
 		}
 	}
 
-	go f.subscribe(ctx, errCh)
+	c := currentConfig()
+	if c.Subscriber.DeadLetterTopic != "" {
+		f.deadLetter = pubsubClient.Topic(c.Subscriber.DeadLetterTopic)
+	}
+	if c.ResultTopic != "" {
+		f.resultTopic = pubsubClient.Topic(c.ResultTopic)
+	}
+
+	receiveCtx, cancelReceive := context.WithCancel(ctx)
+	processCtx, cancelProcess := context.WithCancel(context.Background())
+	f.cancelReceive = cancelReceive
+	f.cancelProcess = cancelProcess
+	f.stopped = make(chan struct{})
+	f.batcher = newBatcher(func(group AppGroup, releases []batchedRelease) {
+		f.releaseBatch(processCtx, group, releases)
+	})
+
+	if c.Digest.Schedule != "" {
+		go f.runDigest(receiveCtx)
+	}
+	go f.bootstrapStatusMessages(processCtx)
+
+	go f.subscribe(receiveCtx, processCtx, errCh)
+}
+
+// appEnabled tells whether the app passes OnlyApps and SkipApps
+func (f *Flow) appEnabled(name string) bool {
+	for _, skip := range f.SkipApps {
+		if skip == name {
+			return false
+		}
+	}
+	if len(f.OnlyApps) == 0 {
+		return true
+	}
+	for _, only := range f.OnlyApps {
+		if only == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitList splits a comma separated list, ignoring the spaces and the empty items,
+// e.g. of FLOW_ONLY_APPS and FLOW_SKIP_APPS
+func SplitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
@@ -0,0 +1,45 @@
+package flow
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"app", []string{"app"}},
+		{"app-a,app-b", []string{"app-a", "app-b"}},
+		{" app-a , ,app-b, ", []string{"app-a", "app-b"}},
+	}
+	for _, tt := range tests {
+		if got := SplitList(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitList(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAppEnabled(t *testing.T) {
+	tests := []struct {
+		name string
+		only []string
+		skip []string
+		app  string
+		want bool
+	}{
+		{"no lists", nil, nil, "app", true},
+		{"only listed", []string{"app"}, nil, "app", true},
+		{"only not listed", []string{"other"}, nil, "app", false},
+		{"skipped", nil, []string{"app"}, "app", false},
+		{"skip wins over only", []string{"app"}, []string{"app"}, "app", false},
+	}
+	for _, tt := range tests {
+		f := &Flow{OnlyApps: tt.only, SkipApps: tt.skip}
+		if got := f.appEnabled(tt.app); got != tt.want {
+			t.Errorf("%s: appEnabled(%q) = %v, want %v", tt.name, tt.app, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+
+	"github.com/sakajunquality/flow/gitbot"
+)
+
+// githubServer fakes the GitHub API with the JSON responses by path, the other paths are not found
+type githubServer struct {
+	server    *httptest.Server
+	responses map[string]string
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func newGitHubServer(responses map[string]string) *githubServer {
+	s := &githubServer{responses: responses}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+func (s *githubServer) Close() {
+	s.server.Close()
+}
+
+// Client sends the requests to api.github.com to the fake
+func (s *githubServer) Client() *http.Client {
+	u, _ := url.Parse(s.server.URL)
+	return &http.Client{Transport: rewriteHost{u}}
+}
+
+func (s *githubServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.URL.Path)
+	s.mu.Unlock()
+
+	body, ok := s.responses[r.URL.Path]
+	if !ok {
+		http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(body))
+}
+
+// Requests returns the paths requested so far
+func (s *githubServer) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// rewriteHost sends the requests to api.github.com to the server
+type rewriteHost struct {
+	u *url.URL
+}
+
+func (rt rewriteHost) RoundTrip(r *http.Request) (*http.Response, error) {
+	r.URL.Scheme = rt.u.Scheme
+	r.URL.Host = rt.u.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// fakeReleaser reads the files from contents by repo/path and records the releases instead of opening PRs
+type fakeReleaser struct {
+	contents map[string]string
+	// merge is the auto-merge of the PRs
+	merge gitbot.MergeState
+
+	mu sync.Mutex
+	// files are the changed files of each release by path
+	files []map[string]string
+}
+
+func (r *fakeReleaser) GetContent(ctx context.Context, repo *gitbot.Repo, token, filePath string) (string, error) {
+	content, ok := r.contents[repo.FullName()+"/"+filePath]
+	if !ok {
+		return "", fmt.Errorf("%s not found in %s", filePath, repo.FullName())
+	}
+	return content, nil
+}
+
+func (r *fakeReleaser) Create(ctx context.Context, release *gitbot.Release, token string) (*gitbot.Result, error) {
+	changes, err := release.PreviewFrom(func(filePath string) (string, error) {
+		return r.GetContent(ctx, &release.Repo, token, filePath)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	files := map[string]string{}
+	for _, c := range changes {
+		files[c.Path] = c.After
+	}
+	r.files = append(r.files, files)
+	number := len(r.files)
+	return &gitbot.Result{URL: fmt.Sprintf("https://github.com/%s/pull/%d", release.Repo.FullName(), number), Number: number, Merge: r.merge}, nil
+}
+
+// Releases returns the changed files of the releases
+func (r *fakeReleaser) Releases() []map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]map[string]string(nil), r.files...)
+}
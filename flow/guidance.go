@@ -0,0 +1,70 @@
+package flow
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sakajunquality/flow/gitbot"
+)
+
+// Classifications of the failures
+const (
+	classBuild        = "build failure"
+	classVersion      = "version"
+	classSource       = "source"
+	classLimit        = "release limit"
+	classDeadLetter   = "dead letter"
+	classUnauthorized = "unauthorized"
+	classNotFound     = "not found"
+	classConflict     = "conflict"
+	classGitHub       = "github"
+	classUnknown      = "unknown"
+)
+
+// classify names the kind of the failure of a release
+func classify(err error) string {
+	switch {
+	case errors.Is(err, gitbot.ErrUnauthorized):
+		return classUnauthorized
+	case errors.Is(err, gitbot.ErrNotFound):
+		return classNotFound
+	case errors.Is(err, gitbot.ErrConflict):
+		return classConflict
+	case errors.As(err, new(*gitbot.Error)):
+		return classGitHub
+	}
+	return classUnknown
+}
+
+// guidance tells what to do about the failure, it is posted in the thread of the failure message.
+// The notified failures are never retried, the retried events are only notified once they are given up on.
+func guidance(e Event, class, trace string) string {
+	var next string
+	switch class {
+	case classBuild:
+		next = "Fix the build, then re-run it."
+	case classVersion:
+		next = "Check the image tag and the version_pattern/version_validation of the app, then re-run the build."
+	case classSource:
+		next = "Check the trigger and the source repository of the app, then re-run the build."
+	case classLimit:
+		next = "Check the filters of the manifests or raise max_prs_per_event of the app, then re-run the build."
+	case classDeadLetter:
+		next = "Fix the cause of the errors, then replay the dead-lettered event."
+	case classUnauthorized:
+		next = "Check the permissions of the GitHub token on the manifest repository, then re-run the build."
+	case classNotFound:
+		next = "Check the manifest repository, branch and files of the app, then re-run the build."
+	case classConflict:
+		next = "The branch or the PR changed meanwhile, re-run the build."
+	default:
+		next = "Re-run the build once the cause is fixed."
+	}
+
+	text := fmt.Sprintf("*Classification:* %s\n*Automatic retry:* no\n*Next step:* %s\n*Re-run:* <%s|Cloud Build> or replay the event with `flowd -once`",
+		class, next, e.LogURL)
+	if trace != "" {
+		text += fmt.Sprintf("\n```%s```", trace)
+	}
+	return text
+}
@@ -0,0 +1,66 @@
+package flow
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v18/github"
+	"github.com/sakajunquality/flow/gitbot"
+)
+
+func githubError(status int) error {
+	return &gitbot.Error{
+		Step: gitbot.StepCommit,
+		Repo: "owner/manifests",
+		Err:  &github.ErrorResponse{Response: &http.Response{StatusCode: status}},
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{githubError(http.StatusUnauthorized), classUnauthorized},
+		{githubError(http.StatusForbidden), classUnauthorized},
+		{githubError(http.StatusNotFound), classNotFound},
+		{githubError(http.StatusConflict), classConflict},
+		{fmt.Errorf("release: %w", githubError(http.StatusUnprocessableEntity)), classConflict},
+		{githubError(http.StatusInternalServerError), classGitHub},
+		{errors.New("boom"), classUnknown},
+	}
+	for _, tt := range tests {
+		if got := classify(tt.err); got != tt.want {
+			t.Errorf("classify(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestGuidance(t *testing.T) {
+	e := Event{}
+	e.LogURL = "https://console.cloud.google.com/cloud-build/builds/b1"
+
+	tests := []struct {
+		class string
+		next  string
+	}{
+		{classBuild, "Fix the build"},
+		{classVersion, "version_pattern"},
+		{classSource, "source repository"},
+		{classLimit, "max_prs_per_event"},
+		{classDeadLetter, "replay the dead-lettered event"},
+		{classConflict, "re-run the build"},
+		{classUnknown, "Re-run the build once the cause is fixed"},
+	}
+	for _, tt := range tests {
+		text := guidance(e, tt.class, "trace")
+		for _, want := range []string{"*Classification:* " + tt.class, "*Automatic retry:* no", tt.next, e.LogURL, "```trace```"} {
+			if !strings.Contains(text, want) {
+				t.Errorf("guidance of %s lacks %q:\n%s", tt.class, want, text)
+			}
+		}
+	}
+}
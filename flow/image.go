@@ -0,0 +1,131 @@
+package flow
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sakajunquality/flow/gitbot"
+)
+
+// imageForm is a name the manifests reference the image by, and the reference it's released at
+type imageForm struct {
+	name string
+	ref  string
+	re   *regexp.Regexp
+	// bounded forms only match after a space, a quote or =, so that e.g. app doesn't match my-app
+	bounded bool
+	// search and replacement are of the image_pattern of the manifest instead of the name
+	search      string
+	replacement string
+}
+
+// imagePatternData is what ImagePattern.Replace renders from
+type imagePatternData struct {
+	Image   string
+	Ref     string
+	Version string
+}
+
+// patternForm is the form of the image_pattern of the manifest
+func (a Application) patternForm(p ImagePattern, imageRef, version string) (imageForm, error) {
+	replacement, err := renderTemplate("image_pattern", p.Replace, imagePatternData{
+		Image:   a.ImageName,
+		Ref:     imageRef,
+		Version: version,
+	})
+	if err != nil {
+		return imageForm{}, err
+	}
+
+	// validated by Config.validate
+	return imageForm{
+		name:        a.ImageName,
+		ref:         imageRef,
+		re:          regexp.MustCompile(p.Search),
+		search:      p.Search,
+		replacement: replacement,
+	}, nil
+}
+
+// usedFor tells whether the pattern is used for the file
+func (p *ImagePattern) usedFor(filePath string) bool {
+	if p == nil {
+		return false
+	}
+	if len(p.Files) == 0 {
+		return true
+	}
+	for _, f := range p.Files {
+		if f == filePath {
+			return true
+		}
+	}
+	return false
+}
+
+// imageForms are the full name of the image and, with image_match: short, the names without
+// the registry host and the repository alone, e.g. gcr.io/proj/app, proj/app and app.
+// The short forms are released in the same form, e.g. app:v1.0.0 to app:v1.1.0.
+func (a Application) imageForms(imageRef string) ([]imageForm, error) {
+	full := imageForm{name: a.ImageName, ref: imageRef}
+	forms := []imageForm{full}
+	if a.ImageMatch == imageMatchShort {
+		suffix := strings.TrimPrefix(imageRef, a.ImageName)
+		for _, name := range shortImageNames(a.ImageName) {
+			ref := imageRef
+			if strings.HasPrefix(imageRef, a.ImageName) {
+				ref = name + suffix
+			}
+			forms = append(forms, imageForm{name: name, ref: ref, bounded: true})
+		}
+	}
+
+	for i := range forms {
+		re, err := regexp.Compile(forms[i].pattern())
+		if err != nil {
+			return nil, err
+		}
+		forms[i].re = re
+	}
+	return forms, nil
+}
+
+// pattern matches the references of the form, the image may already be pinned by digest.
+// The full name matches up to the end of the line as it always did.
+func (f imageForm) pattern() string {
+	if f.search != "" {
+		return f.search
+	}
+	if f.bounded {
+		return fmt.Sprintf(`(^|[\s"'=])%s[:@][^\s"'#]*`, regexp.QuoteMeta(f.name))
+	}
+	return fmt.Sprintf("%s[:@].*", f.name)
+}
+
+func (f imageForm) updater(strategy string) gitbot.Updater {
+	switch {
+	case f.search != "":
+		return gitbot.NewRegexUpdater(f.search, f.replacement)
+	case strategy == updateStrategyYAML:
+		return gitbot.NewYAMLImageRefUpdater(f.name, f.ref)
+	case f.bounded:
+		return gitbot.NewRegexUpdater(f.pattern(), "${1}"+strings.Replace(f.ref, "$", "$$", -1))
+	default:
+		return gitbot.NewRegexUpdater(f.pattern(), f.ref)
+	}
+}
+
+// shortImageNames are the names of the image without the registry host and the repository alone
+func shortImageNames(image string) []string {
+	parts := strings.Split(image, "/")
+	var names []string
+	if len(parts) > 1 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		parts = parts[1:]
+		names = append(names, strings.Join(parts, "/"))
+	}
+	if len(parts) > 1 {
+		names = append(names, parts[len(parts)-1])
+	}
+	return names
+}
@@ -0,0 +1,24 @@
+package flow
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestShortImageNames(t *testing.T) {
+	tests := []struct {
+		image string
+		want  []string
+	}{
+		{"gcr.io/project/app", []string{"project/app", "app"}},
+		{"localhost:5000/team/app", []string{"team/app", "app"}},
+		{"localhost/app", []string{"app"}},
+		{"team/app", []string{"app"}},
+		{"app", nil},
+	}
+	for _, tt := range tests {
+		if got := shortImageNames(tt.image); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("shortImageNames(%q) = %q, want %q", tt.image, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package flow
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// leasePollInterval is how often a release waiting for the lease of its app retries it
+const leasePollInterval = time.Second
+
+// mu serializes the processing of all the events unless they're ordered by app
+var mu sync.Mutex
+
+// appLocks serializes the processing of the events of each app
+type appLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+var locks = &appLocks{locks: map[string]*sync.Mutex{}}
+
+func (l *appLocks) get(app string) *sync.Mutex {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	m, ok := l.locks[app]
+	if !ok {
+		m = &sync.Mutex{}
+		l.locks[app] = m
+	}
+	return m
+}
+
+// lock serializes the processing of the apps and returns the unlock. Events are processed
+// one at a time, or one at a time per app when the subscriber orders them by app.
+func lock(apps ...string) func() {
+	if !currentConfig().Subscriber.OrderByApp {
+		mu.Lock()
+		return mu.Unlock
+	}
+
+	// Locked in the same order everywhere so that batches of several apps don't deadlock
+	sorted := append([]string{}, apps...)
+	sort.Strings(sorted)
+
+	var held []*sync.Mutex
+	for i, app := range sorted {
+		if i > 0 && app == sorted[i-1] {
+			continue
+		}
+		m := locks.get(app)
+		m.Lock()
+		held = append(held, m)
+	}
+
+	return func() {
+		for _, m := range held {
+			m.Unlock()
+		}
+	}
+}
+
+// repoSlots limit the concurrent writes to each manifest repository, so that the releases of
+// the apps or the batches sharing a repository don't race on its branches and trees
+type repoSlots struct {
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+}
+
+var writes = &repoSlots{slots: map[string]chan struct{}{}}
+
+func (s *repoSlots) get(repo string) chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	slots, ok := s.slots[repo]
+	if !ok {
+		slots = make(chan struct{}, currentConfig().repoConcurrency())
+		s.slots[repo] = slots
+	}
+	return slots
+}
+
+// lockRepo waits for a slot of the repository (owner/name) and returns the release of the slot
+func lockRepo(ctx context.Context, repo string) (func(), error) {
+	slots := writes.get(repo)
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// leaseApp takes the lease of the app in the store, waiting for it up to the app_lease wait, and
+// returns its release. The lease is extended until it's released. When another instance still
+// holds it, the error redelivers the event rather than skipping a build which may be the newer one.
+func (f *Flow) leaseApp(ctx context.Context, app string) (func(), error) {
+	l := currentConfig().AppLease
+	if l.TTL <= 0 || f.DryRun {
+		return func() {}, nil
+	}
+
+	holder, err := newLeaseHolder()
+	if err != nil {
+		return nil, err
+	}
+
+	key := "lease/app/" + app
+	deadline := f.now().Add(l.Wait)
+	for {
+		ok, err := f.store.AcquireLease(ctx, key, holder, l.TTL)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			stop, renewed := make(chan struct{}), make(chan struct{})
+			go func() {
+				defer close(renewed)
+				f.renewLease(key, holder, l.TTL, stop)
+			}()
+
+			return func() {
+				close(stop)
+				<-renewed
+				// Released even when the event was canceled, the lease would block the app until the ttl
+				if err := f.store.ReleaseLease(context.Background(), key, holder); err != nil {
+					fmt.Fprintf(os.Stderr, "Error releasing the lease of %s: %s\n", app, err)
+				}
+			}, nil
+		}
+		if !f.now().Before(deadline) {
+			return nil, fmt.Errorf("another instance has been releasing %s for over the app_lease wait %s", app, l.Wait)
+		}
+
+		select {
+		case <-time.After(leasePollInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// renewLease extends the lease every third of its ttl until stop is closed, so that a release
+// taking longer than the ttl keeps it
+func (f *Flow) renewLease(key, holder string, ttl time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		ok, err := f.store.AcquireLease(context.Background(), key, holder, ttl)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error renewing the lease %s: %s\n", key, err)
+			continue
+		}
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Error: the lease %s expired and was taken by another instance\n", key)
+			return
+		}
+	}
+}
+
+// newLeaseHolder identifies a lease of this instance, which never frees the lease another
+// instance took after it expired
+func newLeaseHolder() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,147 @@
+package flow
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// maxConcurrentWrites runs the writes of the repos at once, each holding the slot of its repo
+// for a while, and returns the most writes held at once by repo and overall
+func maxConcurrentWrites(t *testing.T, repos []string) (map[string]int, int) {
+	t.Helper()
+
+	var mu sync.Mutex
+	active, byRepo := map[string]int{}, map[string]int{}
+	total, maxTotal := 0, 0
+
+	var wg sync.WaitGroup
+	for _, repo := range repos {
+		wg.Add(1)
+		go func(repo string) {
+			defer wg.Done()
+			unlock, err := lockRepo(context.Background(), repo)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer unlock()
+
+			mu.Lock()
+			active[repo]++
+			total++
+			if active[repo] > byRepo[repo] {
+				byRepo[repo] = active[repo]
+			}
+			if total > maxTotal {
+				maxTotal = total
+			}
+			mu.Unlock()
+
+			time.Sleep(50 * time.Millisecond)
+
+			mu.Lock()
+			active[repo]--
+			total--
+			mu.Unlock()
+		}(repo)
+	}
+	wg.Wait()
+	return byRepo, maxTotal
+}
+
+func TestLockRepo(t *testing.T) {
+	tests := []struct {
+		name        string
+		concurrency int
+		repos       []string
+		wantByRepo  map[string]int
+		wantTotal   int
+	}{
+		{
+			name:       "same repo serialized",
+			repos:      []string{"owner/manifests", "owner/manifests", "owner/manifests"},
+			wantByRepo: map[string]int{"owner/manifests": 1},
+			wantTotal:  1,
+		},
+		{
+			name:       "other repos in parallel",
+			repos:      []string{"owner/manifests", "owner/other", "owner/manifests", "owner/other"},
+			wantByRepo: map[string]int{"owner/manifests": 1, "owner/other": 1},
+			wantTotal:  2,
+		},
+		{
+			name:        "manifest_repo_concurrency",
+			concurrency: 2,
+			repos:       []string{"owner/manifests", "owner/manifests", "owner/manifests", "owner/manifests"},
+			wantByRepo:  map[string]int{"owner/manifests": 2},
+			wantTotal:   2,
+		},
+	}
+	for _, tt := range tests {
+		setConfig(&Config{ManifestRepoConcurrency: tt.concurrency})
+		writes = &repoSlots{slots: map[string]chan struct{}{}}
+
+		byRepo, total := maxConcurrentWrites(t, tt.repos)
+		for repo, want := range tt.wantByRepo {
+			if byRepo[repo] != want {
+				t.Errorf("%s: %d writes to %s at once, want %d", tt.name, byRepo[repo], repo, want)
+			}
+		}
+		if total != tt.wantTotal {
+			t.Errorf("%s: %d writes at once, want %d", tt.name, total, tt.wantTotal)
+		}
+	}
+}
+
+func TestLockRepoCanceled(t *testing.T) {
+	setConfig(&Config{})
+	writes = &repoSlots{slots: map[string]chan struct{}{}}
+
+	unlock, err := lockRepo(context.Background(), "owner/manifests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := lockRepo(ctx, "owner/manifests"); err != context.DeadlineExceeded {
+		t.Errorf("waited for the held repo with %v, want the deadline", err)
+	}
+
+	unlockOther, err := lockRepo(context.Background(), "owner/other")
+	if err != nil {
+		t.Errorf("waited for another repo: %s", err)
+	} else {
+		unlockOther()
+	}
+}
+
+func TestLeaseApp(t *testing.T) {
+	ttl := 60 * time.Millisecond
+	setConfig(&Config{AppLease: AppLease{TTL: ttl}})
+	f := newTestFlow()
+	ctx := context.Background()
+	key := "lease/app/app"
+
+	release, err := f.leaseApp(ctx, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Renewed while it's held
+	time.Sleep(3 * ttl)
+	if ok, err := f.store.AcquireLease(ctx, key, "other", ttl); err != nil || ok {
+		t.Errorf("took the renewed lease: %v, %v", ok, err)
+	}
+	if _, err := f.leaseApp(ctx, "app"); err == nil {
+		t.Error("took the held lease without an error")
+	}
+
+	release()
+	if ok, err := f.store.AcquireLease(ctx, key, "other", ttl); err != nil || !ok {
+		t.Errorf("took the released lease: %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,83 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultFailureLogBytes = 2000
+	// logTailRead is how much of the end of the log is read to find the lines
+	logTailRead = 64 * 1024
+)
+
+// failureLogTail returns the last lines of the log of the failed build, truncated to max_bytes.
+// It's empty when it's disabled or the log can't be read, the notification still has the link.
+func (f *Flow) failureLogTail(ctx context.Context, e Event) string {
+	if f.logs == nil || e.ID == "" || e.LogsBucket == "" {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, defaultHTTPTimeout)
+	defer cancel()
+
+	tail, err := f.readLogTail(ctx, e)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading the log of the build %s: %s\n", e.ID, err)
+		return ""
+	}
+	return f.redact(tail)
+}
+
+func (f *Flow) readLogTail(ctx context.Context, e Event) (string, error) {
+	// The logs of Cloud Build are gs://<bucket>/log-<build ID>.txt
+	bucket := strings.TrimPrefix(e.LogsBucket, "gs://")
+	if i := strings.Index(bucket, "/"); i >= 0 {
+		bucket = bucket[:i]
+	}
+	o := f.logs.Bucket(bucket).Object(fmt.Sprintf("log-%s.txt", e.ID))
+
+	attrs, err := o.Attrs(ctx)
+	if err != nil {
+		return "", err
+	}
+	var offset int64
+	if attrs.Size > logTailRead {
+		offset = attrs.Size - logTailRead
+	}
+
+	r, err := o.NewRangeReader(ctx, offset, -1)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	l := currentConfig().FailureLog
+	return tailLines(string(b), l.Lines, l.maxBytes()), nil
+}
+
+// tailLines returns the last n lines of the log, keeping the end when it's longer than max
+func tailLines(log string, n, max int) string {
+	lines := strings.Split(strings.TrimRight(log, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+
+	tail := strings.Join(lines, "\n")
+	if len(tail) > max {
+		start := len(tail) - max
+		for start < len(tail) && !utf8.RuneStart(tail[start]) {
+			start++
+		}
+		tail = "…" + tail[start:]
+	}
+	return tail
+}
@@ -0,0 +1,52 @@
+package flow
+
+import (
+	"sync"
+
+	"github.com/sakajunquality/flow/slackbot"
+)
+
+// releaseMessage is a posted release notification, kept to edit it on the deploy
+type releaseMessage struct {
+	channel string
+	refs    []slackbot.MessageRef
+	detail  slackbot.MessageDetail
+}
+
+// releaseMessages keeps the messages of the last release of each app
+type releaseMessages struct {
+	mu       sync.Mutex
+	messages map[string][]releaseMessage
+	// released is the event the messages of the app belong to
+	released map[string]string
+}
+
+func newReleaseMessages() *releaseMessages {
+	return &releaseMessages{
+		messages: map[string][]releaseMessage{},
+		released: map[string]string{},
+	}
+}
+
+// add keeps the message, the messages of an earlier release of the app are replaced
+func (r *releaseMessages) add(app string, m releaseMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.released[app] != m.detail.LogURL {
+		r.messages[app] = nil
+		r.released[app] = m.detail.LogURL
+	}
+	r.messages[app] = append(r.messages[app], m)
+}
+
+// take returns the messages of the last release of the app, which are edited only once
+func (r *releaseMessages) take(app string) []releaseMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	messages := r.messages[app]
+	delete(r.messages, app)
+	delete(r.released, app)
+	return messages
+}
@@ -0,0 +1,284 @@
+package flow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sakajunquality/flow/slackbot"
+)
+
+const (
+	notifierSlack   = "slack"
+	notifierWebhook = "webhook"
+)
+
+// Notifier delivers a message of Flow, channel is where Slack posts it
+type Notifier interface {
+	Notify(ctx context.Context, channel string, d slackbot.MessageDetail) error
+}
+
+// Editor is implemented by the notifiers which can edit the messages they posted
+type Editor interface {
+	Notifier
+	// Post notifies like Notify and returns the reference to edit the message
+	Post(ctx context.Context, channel string, d slackbot.MessageDetail) (slackbot.MessageRef, error)
+	Edit(ctx context.Context, ref slackbot.MessageRef, d slackbot.MessageDetail) error
+}
+
+// Replier is implemented by the notifiers which can reply in the thread of the messages they posted
+type Replier interface {
+	Reply(ctx context.Context, ref slackbot.MessageRef, text string) error
+}
+
+type slackNotifier struct {
+	token string
+	// tokens are the tokens of the named workspaces, appWorkspaces the workspaces of the apps
+	tokens        map[string]string
+	appWorkspaces map[string]string
+	templates     *slackbot.Templates
+	httpClient    *http.Client
+}
+
+// tokenOf is the token of the workspace, the default one when unnamed
+func (n *slackNotifier) tokenOf(workspace string) string {
+	if token, ok := n.tokens[workspace]; ok {
+		return token
+	}
+	return n.token
+}
+
+func (n *slackNotifier) Notify(ctx context.Context, channel string, d slackbot.MessageDetail) error {
+	_, err := n.Post(ctx, channel, d)
+	return err
+}
+
+func (n *slackNotifier) Post(ctx context.Context, channel string, d slackbot.MessageDetail) (slackbot.MessageRef, error) {
+	workspace := n.appWorkspaces[d.AppName]
+	msg := slackbot.NewSlackMessage(n.tokenOf(workspace), channel, d, n.templates)
+	msg.SetHTTPClient(n.httpClient)
+	ref, err := msg.Post(ctx)
+	ref.Workspace = workspace
+	return ref, err
+}
+
+func (n *slackNotifier) Edit(ctx context.Context, ref slackbot.MessageRef, d slackbot.MessageDetail) error {
+	msg := slackbot.NewSlackMessage(n.tokenOf(ref.Workspace), ref.Channel, d, n.templates)
+	msg.SetHTTPClient(n.httpClient)
+	return msg.Update(ctx, ref)
+}
+
+func (n *slackNotifier) Reply(ctx context.Context, ref slackbot.MessageRef, text string) error {
+	msg := slackbot.NewSlackMessage(n.tokenOf(ref.Workspace), ref.Channel, slackbot.MessageDetail{}, n.templates)
+	msg.SetHTTPClient(n.httpClient)
+	return msg.Reply(ctx, ref, text)
+}
+
+type webhookNotifier struct {
+	url        string
+	httpClient *http.Client
+}
+
+// webhookPayload is the JSON posted to webhooks
+type webhookPayload struct {
+	Channel      string   `json:"channel"`
+	Success      bool     `json:"success"`
+	PullRequests bool     `json:"pull_requests"`
+	App          string   `json:"app"`
+	Images       []string `json:"images,omitempty"`
+	LogURL       string   `json:"log_url"`
+	PrURL        string   `json:"pr_url,omitempty"`
+	Branch       *string  `json:"branch,omitempty"`
+	Tag          *string  `json:"tag,omitempty"`
+	Error        string   `json:"error,omitempty"`
+	LogTail      string   `json:"log_tail,omitempty"`
+	Status       string   `json:"status,omitempty"`
+	Body         string   `json:"body,omitempty"`
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, channel string, d slackbot.MessageDetail) error {
+	body, err := json.Marshal(webhookPayload{
+		Channel:      channel,
+		Success:      d.IsSuccess,
+		PullRequests: d.IsPrNotify,
+		App:          d.AppName,
+		Images:       d.Images,
+		LogURL:       d.LogURL,
+		PrURL:        d.PrURL,
+		Branch:       d.BranchName,
+		Tag:          d.TagName,
+		Error:        d.ErrorMessage,
+		LogTail:      d.LogTail,
+		Status:       d.Status,
+		Body:         d.Body,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// multiNotifier notifies all the notifiers even when some of them fail
+type multiNotifier []Notifier
+
+func (m multiNotifier) Notify(ctx context.Context, channel string, d slackbot.MessageDetail) error {
+	_, err := m.post(ctx, channel, d)
+	return err
+}
+
+// post notifies every notifier like Notify, the references are in the order of the notifiers
+// and are empty for the notifiers which can't edit their messages
+func (m multiNotifier) post(ctx context.Context, channel string, d slackbot.MessageDetail) ([]slackbot.MessageRef, error) {
+	refs := make([]slackbot.MessageRef, len(m))
+	var errs []string
+	for i, n := range m {
+		var err error
+		if e, ok := n.(Editor); ok {
+			refs[i], err = e.Post(ctx, channel, d)
+		} else {
+			err = n.Notify(ctx, channel, d)
+		}
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return refs, fmt.Errorf("%d of %d notifiers failed: %s", len(errs), len(m), strings.Join(errs, "; "))
+	}
+	return refs, nil
+}
+
+// edit edits the messages of the references returned by post, the notifiers
+// which can't edit their messages are notified of a new one
+func (m multiNotifier) edit(ctx context.Context, refs []slackbot.MessageRef, channel string, d slackbot.MessageDetail) error {
+	var errs []string
+	for i, n := range m {
+		var err error
+		if e, ok := n.(Editor); ok && i < len(refs) && refs[i].Timestamp != "" {
+			err = e.Edit(ctx, refs[i], d)
+		} else {
+			err = n.Notify(ctx, channel, d)
+		}
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d notifiers failed: %s", len(errs), len(m), strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// upsert edits the messages of the references, posting the ones which are missing or
+// can't be edited anymore. The notifiers which can't edit their messages are skipped.
+func (m multiNotifier) upsert(ctx context.Context, refs []slackbot.MessageRef, channel string, d slackbot.MessageDetail) ([]slackbot.MessageRef, error) {
+	updated := make([]slackbot.MessageRef, len(m))
+	var errs []string
+	for i, n := range m {
+		e, ok := n.(Editor)
+		if !ok {
+			continue
+		}
+		if i < len(refs) && refs[i].Timestamp != "" {
+			if err := e.Edit(ctx, refs[i], d); err == nil {
+				updated[i] = refs[i]
+				continue
+			}
+		}
+
+		var err error
+		if updated[i], err = e.Post(ctx, channel, d); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return updated, fmt.Errorf("%d of %d notifiers failed: %s", len(errs), len(m), strings.Join(errs, "; "))
+	}
+	return updated, nil
+}
+
+// reply replies to the messages of the references returned by post, the notifiers
+// which can't reply are skipped
+func (m multiNotifier) reply(ctx context.Context, refs []slackbot.MessageRef, text string) error {
+	var errs []string
+	for i, n := range m {
+		r, ok := n.(Replier)
+		if !ok || i >= len(refs) || refs[i].Timestamp == "" {
+			continue
+		}
+		if err := r.Reply(ctx, refs[i], text); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d notifiers failed: %s", len(errs), len(m), strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// appWorkspaces are the slack workspaces of the apps which don't notify the default one
+func appWorkspaces() map[string]string {
+	workspaces := map[string]string{}
+	for _, app := range currentConfig().ApplicationList {
+		if app.SlackWorkspace != "" {
+			workspaces[app.Name] = app.SlackWorkspace
+		}
+	}
+	return workspaces
+}
+
+func (f *Flow) newNotifier(configs []NotifierConfig) (Notifier, error) {
+	if len(configs) == 0 {
+		configs = []NotifierConfig{{Type: notifierSlack}}
+	}
+
+	var notifiers multiNotifier
+	for _, c := range configs {
+		switch c.Type {
+		case notifierSlack:
+			notifiers = append(notifiers, &slackNotifier{
+				token:         f.slackBotToken,
+				tokens:        f.slackTokens,
+				appWorkspaces: appWorkspaces(),
+				templates:     f.templates,
+				httpClient:    f.httpClient,
+			})
+		case notifierWebhook:
+			if c.URL == "" {
+				return nil, errors.New("webhook notifier needs a url")
+			}
+			notifiers = append(notifiers, &webhookNotifier{
+				url:        c.URL,
+				httpClient: f.httpClient,
+			})
+		default:
+			return nil, fmt.Errorf("Unknown notifier %s", c.Type)
+		}
+	}
+
+	return notifiers, nil
+}
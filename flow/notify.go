@@ -0,0 +1,357 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sakajunquality/flow/gitbot"
+	"github.com/sakajunquality/flow/slackbot"
+)
+
+// notifyRelasePR posts the results to the channel of each env, in the order of the envs
+func (f *Flow) notifyRelasePR(ctx context.Context, e Event, prs PullRequests, app *Application) {
+	if app.notifyOnlyOnChange() && !prs.changed() {
+		fmt.Fprintf(os.Stdout, "Nothing was released for %s, skipping the notification\n", app.Name)
+		return
+	}
+
+	var channels []string
+	byChannel := map[string]PullRequests{}
+	for _, pr := range prs {
+		if _, ok := byChannel[pr.channel]; !ok {
+			channels = append(channels, pr.channel)
+		}
+		byChannel[pr.channel] = append(byChannel[pr.channel], pr)
+	}
+
+	// Nothing was released, but the build is still notified
+	if len(channels) == 0 {
+		channels = append(channels, slackChannel(app, nil))
+	}
+
+	for _, channel := range channels {
+		f.notifyRelasePRToChannel(ctx, e, byChannel[channel], app, channel)
+	}
+}
+
+// changed tells whether any PR was created or failed, the rest left the envs as they were
+func (prs PullRequests) changed() bool {
+	for _, pr := range prs {
+		if pr.status == prCreated || pr.status == prFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// created tells whether any PR was created
+func (prs PullRequests) created() bool {
+	for _, pr := range prs {
+		if pr.status == prCreated {
+			return true
+		}
+	}
+	return false
+}
+
+// prSections are the sections of the release message, in order
+var prSections = []struct {
+	status prStatus
+	title  string
+}{
+	{prCreated, "Created"},
+	{prFailed, "Failed"},
+	{prUnchanged, "Unchanged"},
+	{prSkipped, "Skipped"},
+	{prFiltered, "Filtered"},
+}
+
+func (f *Flow) notifyRelasePRToChannel(ctx context.Context, e Event, prs PullRequests, app *Application, channel string) {
+	var prURL string
+	for _, section := range prSections {
+		var text string
+		for _, pr := range prs {
+			if pr.status == section.status {
+				text += prText(pr)
+			}
+		}
+		if text != "" {
+			prURL += fmt.Sprintf("*%s*\n%s", section.title, text)
+		}
+	}
+
+	d := slackbot.MessageDetail{
+		IsSuccess:  true,
+		IsPrNotify: true,
+		LogURL:     e.LogURL,
+		AppName:    app.Name,
+		Images:     e.Images,
+		TagName:    e.TagName,
+		BranchName: e.BranchName,
+		PrURL:      prURL,
+	}
+	d.Time, d.QueueTime = e.durations()
+	for _, pr := range prs {
+		if pr.location != "" {
+			d.Clusters = append(d.Clusters, fmt.Sprintf("%s → %s", pr.env, pr.location))
+		}
+	}
+
+	refs := f.post(ctx, channel, d)
+	f.releaseMessages.add(app.Name, releaseMessage{channel: channel, refs: refs, detail: d})
+
+	// The failed releases are not retried, their claims are released so a re-run releases them
+	for _, pr := range prs {
+		if pr.status == prFailed {
+			f.reply(ctx, refs, guidance(e, classify(pr.err), fmt.Sprintf("%s: %s", pr.env, pr.err)))
+		}
+	}
+}
+
+// prText is the result of the env in the release message
+func prText(pr PullRequest) string {
+	if pr.status == prFailed {
+		return fmt.Sprintf("`%s`\n```%s```\n", pr.env, pr.err)
+	}
+	if pr.status != prCreated {
+		return fmt.Sprintf("`%s` %s\n", pr.env, pr.skipped)
+	}
+
+	text := fmt.Sprintf("`%s`\n```%s```\n", pr.env, pr.url)
+	if pr.amended {
+		text += "updated the open PR in place\n"
+	}
+	if pr.reopened {
+		text += "reopened the closed PR\n"
+	}
+	if pr.rolledBack != "" {
+		return text + fmt.Sprintf("%s\n", pr.rolledBack)
+	}
+
+	switch pr.merge {
+	case gitbot.MergeMerged, gitbot.MergeQueued:
+		text += fmt.Sprintf("%s\n", pr.merge)
+	case gitbot.MergeFailed:
+		text += fmt.Sprintf("%s: %s\n", pr.merge, pr.mergeErr)
+	}
+	return text
+}
+
+// notifyBatch summarizes the releases of the group to the channel of each env
+func (f *Flow) notifyBatch(ctx context.Context, group AppGroup, releases []batchedRelease, prs PullRequests) {
+	var summary string
+	for _, r := range releases {
+		summary += fmt.Sprintf("%s `%s` %s\n", r.app.Name, r.manifest.target(), r.version)
+	}
+
+	last := releases[len(releases)-1]
+	for _, pr := range prs {
+		d := slackbot.MessageDetail{
+			IsSuccess:  true,
+			IsPrNotify: true,
+			LogURL:     last.e.LogURL,
+			AppName:    group.Name,
+			TagName:    last.e.TagName,
+			BranchName: last.e.BranchName,
+			PrURL:      summary + prText(pr),
+		}
+		d.Time, d.QueueTime = last.e.durations()
+
+		f.post(ctx, pr.channel, d)
+	}
+}
+
+func (f *Flow) notifyDeploy(ctx context.Context, e Event, app *Application) {
+	if !app.deployNotified(e) {
+		return
+	}
+
+	// The release messages show the deploy instead of a new message
+	if app.ReleaseMessageOf != "" {
+		messages := f.releaseMessages.take(app.ReleaseMessageOf)
+		for _, m := range messages {
+			d := m.detail
+			d.Status = fmt.Sprintf("deployed by %s", e.LogURL)
+			f.edit(ctx, m.refs, m.channel, d)
+		}
+		if len(messages) > 0 {
+			return
+		}
+	}
+
+	d := slackbot.MessageDetail{
+		IsSuccess:  true,
+		IsPrNotify: false,
+		LogURL:     e.LogURL,
+		AppName:    app.Name,
+		TagName:    e.TagName,
+		BranchName: e.BranchName,
+	}
+	d.Time, d.QueueTime = e.durations()
+
+	f.post(ctx, slackChannel(app, nil), d)
+}
+
+// notifyFalure posts the failure of the class, e.g. classBuild, with the guidance in its thread,
+// to the channel of the manifest when the failure is of an env, otherwise of the app
+func (f *Flow) notifyFalure(ctx context.Context, e Event, class, errorMessage string, app *Application, m *Manifest) {
+	d := slackbot.MessageDetail{
+		IsSuccess:    false,
+		LogURL:       e.LogURL,
+		Images:       e.Images,
+		ErrorMessage: errorMessage,
+		TagName:      e.TagName,
+		BranchName:   e.BranchName,
+	}
+	d.Time, d.QueueTime = e.durations()
+
+	// Only the failed builds have something to show in their logs
+	if f.classify(e) == StateFailure {
+		d.LogTail = f.failureLogTail(ctx, e)
+	}
+
+	if app != nil {
+		d.AppName = app.Name
+	}
+
+	if f.deduper != nil {
+		notify, suppressed := f.dedupFailure(d, class, m)
+		if !notify {
+			fmt.Fprintf(os.Stdout, "Suppressed a duplicate failure of %s (x%d)\n", d.AppName, suppressed)
+			return
+		}
+		if suppressed > 0 && currentConfig().FailureDedup.StillFailing {
+			d.ErrorMessage = fmt.Sprintf("still failing (x%d)\n%s", suppressed+1, d.ErrorMessage)
+		}
+	}
+
+	refs := f.post(ctx, slackChannel(app, m), d)
+	f.reply(ctx, refs, guidance(e, class, errorMessage))
+}
+
+// openFailureIssue opens an issue of the failed build of the app, once per build
+func (f *Flow) openFailureIssue(ctx context.Context, e Event, app *Application) {
+	title := fmt.Sprintf("Failed build of %s", app.Name)
+	body := fmt.Sprintf("The build %s of %s finished with %s.\n\n", e.ID, app.Name, e.Status)
+	if e.BranchName != nil {
+		body += fmt.Sprintf("- Branch: %s\n", *e.BranchName)
+	}
+	if e.TagName != nil {
+		title += " " + *e.TagName
+		body += fmt.Sprintf("- Tag: %s\n", *e.TagName)
+	}
+	body += fmt.Sprintf("- Logs: %s\n", e.LogURL)
+
+	if f.DryRun {
+		fmt.Fprintf(os.Stdout, "dry-run: skipping the issue %q of %s\n", title, app.Name)
+		return
+	}
+
+	key := "issue/" + e.ID
+	ok, err := f.store.Claim(ctx, key, currentConfig().claimTTL())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error claiming %s: %s\n", key, err)
+		return
+	}
+	if !ok {
+		return
+	}
+
+	repo := gitbot.NewRepo(app.ManifestOwner, app.ManifestName, app.ManifestBaseBranch)
+	repo.SetHTTPClient(f.httpClient)
+	url, err := repo.OpenIssue(ctx, f.token(ctx), title, body, []string{currentConfig().prLabel()})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening the issue of the failed build %s: %s\n", e.ID, err)
+		if err := f.store.Unclaim(ctx, key); err != nil {
+			fmt.Fprintf(os.Stderr, "Error unclaiming %s: %s\n", key, err)
+		}
+		return
+	}
+	f.completeClaims(ctx, []string{key})
+	fmt.Fprintf(os.Stdout, "Opened %s for the failed build %s\n", url, e.ID)
+}
+
+// dedupFailure tells whether the failure of the class is notified, see failureDeduper.check
+func (f *Flow) dedupFailure(d slackbot.MessageDetail, class string, m *Manifest) (bool, int) {
+	// The failures of the app are not of any env
+	var env string
+	if m != nil {
+		env = m.target()
+	}
+
+	keyTemplate := currentConfig().FailureDedup.Key
+	if keyTemplate == "" {
+		keyTemplate = defaultDedupKey
+	}
+
+	key, err := renderTemplate("failure_dedup.key", keyTemplate, dedupKeyData{
+		App:     d.AppName,
+		Env:     env,
+		Error:   class,
+		Message: d.ErrorMessage,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error rendering the failure dedup key: %s\n", err)
+		return true, 0
+	}
+
+	return f.deduper.check(key, time.Now())
+}
+
+// post notifies every notifier, the result of the event doesn't depend on it so errors are only logged.
+// It returns the references to edit the messages.
+func (f *Flow) post(ctx context.Context, channel string, d slackbot.MessageDetail) []slackbot.MessageRef {
+	if f.DryRun {
+		fmt.Fprintf(os.Stdout, "dry-run: skipping the notification to %s %#v\n", channel, d)
+		return nil
+	}
+
+	refs, err := f.notifiers().post(ctx, channel, d)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error notifying %s: %s\n", channel, err)
+	}
+	return refs
+}
+
+// edit edits the messages posted by post, errors are only logged
+func (f *Flow) edit(ctx context.Context, refs []slackbot.MessageRef, channel string, d slackbot.MessageDetail) {
+	if f.DryRun {
+		fmt.Fprintf(os.Stdout, "dry-run: skipping the edit of the notification to %s %#v\n", channel, d)
+		return
+	}
+
+	if err := f.notifiers().edit(ctx, refs, channel, d); err != nil {
+		fmt.Fprintf(os.Stderr, "Error editing the notification to %s: %s\n", channel, err)
+	}
+}
+
+// reply replies in the threads of the messages posted by post, errors are only logged
+func (f *Flow) reply(ctx context.Context, refs []slackbot.MessageRef, text string) {
+	if f.DryRun || len(refs) == 0 {
+		return
+	}
+
+	if err := f.notifiers().reply(ctx, refs, text); err != nil {
+		fmt.Fprintf(os.Stderr, "Error replying to the notification: %s\n", err)
+	}
+}
+
+func (f *Flow) notifiers() multiNotifier {
+	if m, ok := f.notifier.(multiNotifier); ok {
+		return m
+	}
+	return multiNotifier{f.notifier}
+}
+
+// slackChannel resolves the channel in the order of manifest, app and global
+func slackChannel(app *Application, m *Manifest) string {
+	if m != nil && m.SlackChannel != "" {
+		return m.SlackChannel
+	}
+	if app != nil && app.SlackChannel != "" {
+		return app.SlackChannel
+	}
+	return currentConfig().SlackNotifiyChannel
+}
@@ -0,0 +1,45 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ProcessOnce processes a single event without Pub/Sub, writing the result of each env to w.
+// It fails when the event, any of the apps, e.g. by its build, or any of the envs failed,
+// the result is returned unless the event failed.
+func (f *Flow) ProcessOnce(ctx context.Context, e Event, w io.Writer) (*EventResult, error) {
+	prs, err := f.process(ctx, e)
+	if f.auditLog != nil {
+		f.auditLog.flush()
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := f.newEventResult(e, prs)
+
+	failed := false
+	for _, pr := range prs {
+		switch pr.status {
+		case prFailed:
+			failed = true
+			// The failures of the whole app have no env
+			name := pr.env
+			if name == "" {
+				name = pr.app
+			}
+			fmt.Fprintf(w, "%s: error: %s\n", name, f.redact(pr.err.Error()))
+		case prCreated:
+			fmt.Fprintf(w, "%s: %s\n", pr.env, pr.url)
+		default:
+			fmt.Fprintf(w, "%s: %s: %s\n", pr.env, pr.status, pr.skipped)
+		}
+	}
+
+	if failed {
+		return result, errors.New("some of the apps or releases failed")
+	}
+	return result, nil
+}
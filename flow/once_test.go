@@ -0,0 +1,45 @@
+package flow
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestProcessOnceFailure(t *testing.T) {
+	slackAPI := newSlackServer()
+	defer slackAPI.Close()
+
+	setConfig(&Config{
+		SlackNotifiyChannel: "#deploy",
+		ApplicationList:     []Application{{Name: "app", TriggerID: "trigger"}},
+	})
+	f := newTestFlow()
+
+	tests := []struct {
+		name  string
+		event Event
+	}{
+		{"failed build", testEvent("FAILURE", []string{"gcr.io/project/app:v1.0.0"}, "", "v1.0.0")},
+		{"no images", testEvent("SUCCESS", nil, "", "v1.0.0")},
+		{"image without tag", testEvent("SUCCESS", []string{"gcr.io/project/app"}, "", "v1.0.0")},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if _, err := f.ProcessOnce(context.Background(), tt.event, &out); err == nil {
+			t.Errorf("%s: succeeded, want an error", tt.name)
+		}
+		if !strings.HasPrefix(out.String(), "app: error: ") {
+			t.Errorf("%s: wrote %q, want the error of app", tt.name, out.String())
+		}
+
+		posts := slackAPI.Posts()
+		if len(posts) != 1 || posts[0].Title != "Build Failure" {
+			t.Errorf("%s: posted %+v, want a Build Failure", tt.name, posts)
+		}
+		if replies := slackAPI.Replies(); len(replies) != 1 || !strings.Contains(replies[0], "*Classification:*") {
+			t.Errorf("%s: replied %q, want the guidance", tt.name, replies)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sakajunquality/flow/gitbot"
+	"github.com/sakajunquality/flow/slackbot"
+)
+
+// openPRWarnInterval is how often the same manifest repo is warned about at most
+const openPRWarnInterval = time.Hour
+
+// checkOpenPRs warns when the open PRs of Flow in the manifest repo of the release reached the
+// open_pr_limit, and returns why the release is paused with pause, empty otherwise
+func (f *Flow) checkOpenPRs(ctx context.Context, app *Application, m Manifest) (string, error) {
+	limit := currentConfig().OpenPRLimit
+	if limit.Max <= 0 {
+		return "", nil
+	}
+
+	repo := gitbot.NewRepo(app.ManifestOwner, app.ManifestName, app.baseBranch(m))
+	repo.SetHTTPClient(f.httpClient)
+	count, err := repo.CountOpenPRs(ctx, f.token(ctx), currentConfig().prLabel())
+	if err != nil {
+		return "", err
+	}
+	if count < limit.Max {
+		return "", nil
+	}
+
+	msg := fmt.Sprintf("%s has %d open PRs of Flow, the open_pr_limit is %d", repo.FullName(), count, limit.Max)
+	if limit.Pause {
+		msg += ", no PR is opened until some are merged or closed"
+	}
+	fmt.Fprintf(os.Stderr, "Warning: %s\n", msg)
+
+	if notify, _ := f.openPRWarnings.check(repo.FullName(), f.now()); notify {
+		f.post(ctx, slackChannel(app, &m), slackbot.MessageDetail{
+			IsSuccess:    false,
+			AppName:      app.Name,
+			ErrorMessage: msg,
+		})
+	}
+
+	if !limit.Pause {
+		return "", nil
+	}
+	return fmt.Sprintf("paused by the open_pr_limit, %s has %d open PRs", repo.FullName(), count), nil
+}
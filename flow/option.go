@@ -0,0 +1,86 @@
+package flow
+
+import (
+	"net/http"
+	"time"
+)
+
+const defaultHTTPTimeout = 30 * time.Second
+
+// Option customizes Flow in New
+type Option func(*Flow)
+
+// WithHTTPClient sets the client of every call to GitHub and Slack,
+// its transport is where mTLS, tracing, rate limiting or retries hook in
+func WithHTTPClient(c *http.Client) Option {
+	return func(f *Flow) {
+		f.httpClient = c
+	}
+}
+
+// WithGitHubToken reads the GitHub token from the provider, which is called again
+// once refresh has passed so that rotated tokens are picked up
+func WithGitHubToken(p TokenProvider, refresh time.Duration) Option {
+	return func(f *Flow) {
+		f.githubToken = newRefreshingToken(p, refresh)
+	}
+}
+
+// WithRedactor adds the redactor to the ones of the logs and the recorded errors,
+// e.g. to mask the secrets of a vault which have no fixed shape
+func WithRedactor(r Redactor) Option {
+	return func(f *Flow) {
+		f.redactors = append(f.redactors, r)
+	}
+}
+
+// WithNotifier replaces the notifiers of the config
+func WithNotifier(n Notifier) Option {
+	return func(f *Flow) {
+		f.notifier = n
+	}
+}
+
+// WithReleaser replaces GitHub, e.g. with a fake of the flowtest package
+func WithReleaser(r Releaser) Option {
+	return func(f *Flow) {
+		f.releaser = r
+	}
+}
+
+// WithAppResolver resolves the apps of the events instead of the applications of the config
+func WithAppResolver(r AppResolver) Option {
+	return func(f *Flow) {
+		f.resolver = r
+	}
+}
+
+// WithVersionResolver reads the version_label of the apps instead of the registries
+func WithVersionResolver(r VersionResolver) Option {
+	return func(f *Flow) {
+		f.versions = r
+	}
+}
+
+// WithClock replaces time.Now of the cooldowns and the release times, e.g. in tests
+func WithClock(now func() time.Time) Option {
+	return func(f *Flow) {
+		f.now = now
+	}
+}
+
+// WithStateClassifier replaces DefaultStateClassifier
+func WithStateClassifier(c StateClassifier) Option {
+	return func(f *Flow) {
+		f.classify = c
+	}
+}
+
+// WithEnv sets what FLOW_ENV, FLOW_GCP_PROJECT_ID and FLOW_SLACK_BOT_TOKEN set
+func WithEnv(env, projectID, slackBotToken string) Option {
+	return func(f *Flow) {
+		f.Env = env
+		f.projectID = projectID
+		f.slackBotToken = slackBotToken
+	}
+}
@@ -0,0 +1,35 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+)
+
+// Pin holds the env of the app at the version, Flow skips releasing any other version
+// until Unpin. It takes precedence over Manifest.PinnedVersion.
+func (f *Flow) Pin(ctx context.Context, appName, env, version string) error {
+	if _, _, err := getManifest(appName, env); err != nil {
+		return err
+	}
+	return f.store.SetPin(ctx, appName, env, version)
+}
+
+// Unpin resumes the releases of the env, except for the pin of the config
+func (f *Flow) Unpin(ctx context.Context, appName, env string) error {
+	if _, _, err := getManifest(appName, env); err != nil {
+		return err
+	}
+	return f.store.SetPin(ctx, appName, env, "")
+}
+
+// getPin returns the version the env is pinned at, empty when it's not pinned
+func (f *Flow) getPin(ctx context.Context, app *Application, m Manifest) (string, error) {
+	pin, err := f.store.GetPin(ctx, app.Name, m.Env)
+	if err != nil {
+		return "", fmt.Errorf("could not get the pin of %s %s: %s", app.Name, m.Env, err)
+	}
+	if pin != "" {
+		return pin, nil
+	}
+	return m.PinnedVersion, nil
+}
@@ -0,0 +1,134 @@
+package flow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/sakajunquality/flow/gitbot"
+)
+
+const (
+	postMergePollInterval   = time.Minute
+	defaultPostMergeTimeout = 24 * time.Hour
+)
+
+// postMergeData is what the PostMerge templates render from
+type postMergeData struct {
+	App     string `json:"app"`
+	Env     string `json:"env"`
+	Version string `json:"version"`
+	PRURL   string `json:"pr_url"`
+}
+
+// watchMerge calls the post_merge hook of the manifest once the PR is merged. The PRs which
+// weren't merged right away are polled in the background until the timeout, or until ctx is done
+// when Flow stops.
+func (f *Flow) watchMerge(ctx context.Context, app *Application, m Manifest, version string, result *gitbot.Result) {
+	if m.PostMerge == nil || f.DryRun {
+		return
+	}
+
+	d := postMergeData{App: app.Name, Env: m.target(), Version: version, PRURL: result.URL}
+	if result.Merge == gitbot.MergeMerged {
+		go f.callPostMerge(*m.PostMerge, d)
+		return
+	}
+
+	repo := gitbot.NewRepo(app.ManifestOwner, app.ManifestName, app.baseBranch(m))
+	repo.SetHTTPClient(f.httpClient)
+	go f.pollMerge(ctx, repo, result.Number, *m.PostMerge, d)
+}
+
+func (f *Flow) pollMerge(ctx context.Context, repo *gitbot.Repo, number int, hook PostMerge, d postMergeData) {
+	ctx, cancel := context.WithTimeout(ctx, hook.timeout())
+	defer cancel()
+
+	ticker := time.NewTicker(postMergePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				fmt.Fprintf(os.Stdout, "%s was not merged within %s, skipping the post_merge hook\n", d.PRURL, hook.timeout())
+			} else {
+				fmt.Fprintf(os.Stdout, "Stopped watching %s, skipping the post_merge hook\n", d.PRURL)
+			}
+			return
+		}
+
+		state, err := repo.GetPRState(ctx, f.token(ctx), number)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error getting the state of %s: %s\n", d.PRURL, err)
+			continue
+		}
+		switch state {
+		case gitbot.PRMerged:
+			f.callPostMerge(hook, d)
+			return
+		case gitbot.PRClosed:
+			fmt.Fprintf(os.Stdout, "%s was closed without being merged, skipping the post_merge hook\n", d.PRURL)
+			return
+		}
+	}
+}
+
+// callPostMerge requests the hook, errors are only logged since the release is already merged
+func (f *Flow) callPostMerge(hook PostMerge, d postMergeData) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultHTTPTimeout)
+	defer cancel()
+
+	if err := f.requestPostMerge(ctx, hook, d); err != nil {
+		fmt.Fprintf(os.Stderr, "Error calling the post_merge hook of %s %s: %s\n", d.App, d.Env, f.redact(err.Error()))
+		return
+	}
+	fmt.Fprintf(os.Stdout, "Called the post_merge hook of %s %s %s\n", d.App, d.Env, d.Version)
+}
+
+func (f *Flow) requestPostMerge(ctx context.Context, hook PostMerge, d postMergeData) error {
+	url, err := renderTemplate("post_merge.url", hook.URL, d)
+	if err != nil {
+		return err
+	}
+
+	var body []byte
+	if hook.Body != "" {
+		rendered, err := renderTemplate("post_merge.body", hook.Body, d)
+		if err != nil {
+			return err
+		}
+		body = []byte(rendered)
+	} else if body, err = json.Marshal(d); err != nil {
+		return err
+	}
+
+	method := hook.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if hook.TokenEnv != "" {
+		req.Header.Set("Authorization", "Bearer "+os.Getenv(hook.TokenEnv))
+	}
+
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("post_merge hook responded %s", resp.Status)
+	}
+	return nil
+}
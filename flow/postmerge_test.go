@@ -0,0 +1,35 @@
+package flow
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sakajunquality/flow/gitbot"
+)
+
+func TestPollMergeStopped(t *testing.T) {
+	github := newGitHubServer(nil)
+	defer github.Close()
+
+	f := newTestFlow()
+	repo := gitbot.NewRepo("owner", "manifests", "main")
+	repo.SetHTTPClient(github.Client())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f.pollMerge(ctx, repo, 1, PostMerge{URL: "https://hooks.example.com/deployed"}, postMergeData{App: "app"})
+	}()
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("kept polling after the context was done")
+	}
+	if requests := github.Requests(); len(requests) > 0 {
+		t.Errorf("requested %q after the context was done", requests)
+	}
+}
@@ -0,0 +1,39 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sakajunquality/flow/gitbot"
+)
+
+// PreviewRelease computes the file changes of releasing the version of the app to the env
+// without opening a PR
+func (f *Flow) PreviewRelease(ctx context.Context, appName, env, version string) ([]gitbot.FileChange, error) {
+	app, m, err := getManifest(appName, env)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := f.newRelease(ctx, Event{}, version, version, *app, *m)
+	if err != nil {
+		return nil, err
+	}
+
+	return release.Preview(ctx, f.token(ctx))
+}
+
+func getManifest(appName, env string) (*Application, *Manifest, error) {
+	for _, app := range currentConfig().ApplicationList {
+		if app.Name != appName {
+			continue
+		}
+		for _, m := range app.Manifests {
+			if m.Env == env {
+				return &app, &m, nil
+			}
+		}
+		return nil, nil, fmt.Errorf("No manifest found for %s %s", appName, env)
+	}
+	return nil, nil, fmt.Errorf("No application found for %s", appName)
+}
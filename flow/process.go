@@ -7,74 +7,417 @@ import (
 	"os"
 	"strings"
 
-	"github.com/sakajunquality/cloud-pubsub-events/cloudbuildevent"
 	"github.com/sakajunquality/flow/gitbot"
-	"github.com/sakajunquality/flow/slackbot"
 )
 
 type PullRequests []PullRequest
 
+// prStatus is what Flow decided for an env
+type prStatus string
+
+const (
+	prCreated prStatus = "created"
+	// prFiltered envs don't take the build, e.g. by the filters or the allowed branches
+	prFiltered prStatus = "filtered"
+	// prSkipped envs take the build but are held, e.g. by a pin
+	prSkipped prStatus = "skipped"
+	// prUnchanged envs already run the version
+	prUnchanged prStatus = "unchanged"
+	prFailed    prStatus = "failed"
+)
+
 type PullRequest struct {
-	env string
-	url string
-	err error
+	app     string
+	env     string
+	version string
+	// location is the region and the cluster of the env, see Manifest.location
+	location string
+	status   prStatus
+	channel  string
+	url      string
+	merge    gitbot.MergeState
+	mergeErr error
+	// amended is set when the open PR of an older version was updated in place
+	amended bool
+	// reopened is set when the closed PR of the version was reopened
+	reopened bool
+	// skipped is why no PR was created
+	skipped string
+	err     error
+
+	// number and key are kept to roll the PR back
+	number int
+	key    string
+	// rolledBack is why the PR was closed by AtomicRelease
+	rolledBack string
 }
 
-func (f *Flow) process(ctx context.Context, e cloudbuildevent.Event) error {
-	if !e.IsFinished() { // Notify only the finished
-		fmt.Fprintf(os.Stdout, "Build hasn't finished\n")
-		return nil
+func (f *Flow) process(ctx context.Context, e Event) (PullRequests, error) {
+	if f.classify(e) == StateIgnore { // Notify only the finished
+		fmt.Fprintf(os.Stdout, "Ignoring build %s with status %s\n", e.ID, e.Status)
+		return nil, nil
 	}
 
-	if e.TriggerID == nil {
-		return errors.New("Only the triggered build is supported")
+	if f.buildProcessed(ctx, e) {
+		fmt.Fprintf(os.Stdout, "Build %s has already been processed\n", e.ID)
+		return nil, nil
 	}
 
-	app, err := getApplicationByEventTriggerID(*e.TriggerID)
+	prs, err := f.processBuild(ctx, e)
+	if err == nil && ctx.Err() == nil {
+		f.markBuildProcessed(ctx, e, prs)
+	}
+	return prs, err
+}
+
+func (f *Flow) processBuild(ctx context.Context, e Event) (PullRequests, error) {
+	apps, err := f.resolver.Resolve(ctx, e)
 	if err != nil {
-		return fmt.Errorf("No app is configured for %s", e.TriggerID)
+		return nil, err
+	}
+
+	var prs PullRequests
+	for i := range apps {
+		appPRs, err := f.processApp(ctx, e, &apps[i])
+		if err != nil {
+			return prs, err
+		}
+		prs = append(prs, appPRs...)
 	}
+	return prs, nil
+}
 
-	if !e.IsSuuccess() { // CloudBuild Failure
-		return f.notifyFalure(e, "", nil)
+func (f *Flow) processApp(ctx context.Context, e Event, app *Application) (PullRequests, error) {
+	if !f.appEnabled(app.Name) {
+		fmt.Fprintf(os.Stdout, "Skipping the event of %s, which is filtered out by FLOW_ONLY_APPS/FLOW_SKIP_APPS\n", app.Name)
+		return nil, nil
+	}
+
+	state := app.classifyApp(e, f.classify(e))
+	if state == StateFailure { // CloudBuild Failure
+		f.notifyFalure(ctx, e, classBuild, "", app, nil)
+		if app.FailureIssue {
+			f.openFailureIssue(ctx, e, app)
+		}
+		err := fmt.Errorf("build %s", e.Status)
+		if e.IsSuuccess() {
+			err = errors.New("a required step of the build failed, see build_success")
+		}
+		f.recordStatus(ctx, app, resultBuildFailure, err)
+		return appFailedPRs(app, err), nil
+	}
+
+	if state == StateDeploy || app.DeployOnly && len(e.Images) == 0 {
+		f.notifyDeploy(ctx, e, app)
+		f.recordStatus(ctx, app, resultDeployed, nil)
+		return nil, nil
+	}
+
+	if len(e.Images) == 0 && app.NoImages == noImagesIgnore && app.versionFromImage() {
+		fmt.Fprintf(os.Stdout, "Ignoring the build of %s without images\n", app.Name)
+		f.recordStatus(ctx, app, resultIgnored, nil)
+		return nil, nil
+	}
+
+	if err := app.verifySource(e); err != nil {
+		f.notifyFalure(ctx, e, classSource, err.Error(), app, nil)
+		f.recordStatus(ctx, app, resultError, err)
+		return appFailedPRs(app, err), nil
 	}
 
 	var prs PullRequests
 
-	version, err := getVersionFromImage(e.Images)
+	// The releases of the group are notified together once its window has passed
+	group := currentConfig().groupOf(app)
+	if f.batcher == nil {
+		group = nil
+	}
+
+	tag, fromImage, err := app.sourceTag(e)
 	if err != nil {
-		return f.notifyFalure(e, fmt.Sprintf("Could not ditermine version from image: %s", err), nil)
+		f.notifyFalure(ctx, e, classVersion, fmt.Sprintf("Could not ditermine version from %s: %s", app.versionSourceName(), err), app, nil)
+		f.recordStatus(ctx, app, resultError, err)
+		return appFailedPRs(app, err), nil
 	}
 
-	for _, manifest := range app.Manifests {
-		if !shouldCreatePR(manifest, version) {
+	// The filtered envs are notified to the channel of the app
+	filtered := func(m Manifest, reason string) {
+		prs = append(prs, PullRequest{env: m.target(), status: prFiltered, channel: slackChannel(app, nil), skipped: reason})
+	}
+
+	// The releases are collected first so that none is created when there are too many
+	type candidate struct {
+		tag      string
+		version  string
+		manifest Manifest
+	}
+	var candidates []candidate
+	// labels are the version_label of each tag, read once per event
+	labels := map[string]string{}
+
+	for _, manifest := range app.targets() {
+		if !branchAllowed(manifest, e.BranchName) {
+			filtered(manifest, "the branch is not allowed")
+			continue
+		}
+
+		images := e.Images
+		if !fromImage {
+			images = nil
+		}
+		tag, ok := getManifestTag(manifest, images, tag)
+		if !ok {
+			filtered(manifest, fmt.Sprintf("no image is tagged with %s", manifest.TagPrefix))
+			continue
+		}
+
+		if _, ok := labels[tag]; !ok && app.VersionLabel != "" && fromImage {
+			labels[tag] = f.labelVersion(ctx, e, app, tag)
+		}
+		version := labels[tag]
+		var err error
+		if version == "" {
+			version, err = app.extractVersion(strings.TrimPrefix(tag, manifest.TagPrefix))
+		}
+		if err != nil {
+			f.notifyFalure(ctx, e, classVersion, fmt.Sprintf("Could not ditermine version from tag: %s", err), app, &manifest)
+			f.recordStatus(ctx, app, resultError, err)
+			return appFailedPRs(app, err), nil
+		}
+		if err := app.validateVersion(version); err != nil {
+			f.notifyFalure(ctx, e, classVersion, fmt.Sprintf("Invalid version of tag %s: %s", tag, err), app, &manifest)
+			f.recordStatus(ctx, app, resultError, err)
+			return appFailedPRs(app, err), nil
+		}
+		if !shouldCreatePR(manifest, version, e.BranchName) {
+			filtered(manifest, fmt.Sprintf("%s is filtered out", version))
 			continue
 		}
 
-		prURL, err := f.createRelasePR(ctx, version, *app, manifest)
+		candidates = append(candidates, candidate{tag: tag, version: version, manifest: manifest})
+	}
+
+	if limit := app.maxPRs(); len(candidates) > limit {
+		err := fmt.Errorf("%d releases exceed max_prs_per_event %d, none was created", len(candidates), limit)
+		f.notifyFalure(ctx, e, classLimit, err.Error(), app, nil)
+		f.recordStatus(ctx, app, resultError, err)
+		return appFailedPRs(app, err), nil
+	}
 
+	// Another instance releasing the app would race on the same envs
+	unlease := func() {}
+	if group == nil && len(candidates) > 0 {
+		release, err := f.leaseApp(ctx, app.Name)
 		if err != nil {
-			prs = append(prs, PullRequest{
-				env: manifest.Env,
-				err: err,
-			})
+			return nil, err
+		}
+		unlease = release
+	}
+
+	if app.PRMode == prModeSingle && group == nil && len(candidates) > 0 {
+		var releases []batchedRelease
+		for _, c := range candidates {
+			releases = append(releases, batchedRelease{e: e, tag: c.tag, version: c.version, app: app, manifest: c.manifest})
+		}
+		prs = append(prs, f.releaseSingle(ctx, app, releases)...)
+		candidates = nil
+	}
+
+	for _, c := range candidates {
+		if group != nil {
+			fmt.Fprintf(os.Stdout, "Batching %s %s %s into %s\n", app.Name, c.manifest.target(), c.version, group.Name)
+			f.batcher.add(*group, batchedRelease{e: e, tag: c.tag, version: c.version, app: app, manifest: c.manifest})
 			continue
 		}
 
-		prs = append(prs, PullRequest{
-			env: manifest.Env,
-			url: prURL,
-		})
+		if pr := f.release(ctx, e, c.tag, c.version, app, c.manifest); pr != nil {
+			prs = append(prs, *pr)
+		}
+	}
+
+	if group != nil {
+		f.recordStatus(ctx, app, resultBatched, nil)
+		return nil, nil
+	}
+
+	// The envs released together by pr_mode single have their locations already
+	for i := range prs {
+		prs[i].app = app.Name
+		if m := app.manifest(prs[i].env); m != nil {
+			prs[i].location = m.location()
+		}
+	}
+
+	if app.AtomicRelease && prs.failed() {
+		f.rollback(ctx, app, prs)
+	}
+	unlease()
+
+	f.notifyRelasePR(ctx, e, prs, app)
+	f.postSourceStatus(ctx, e, app, prs)
+	if prs.created() {
+		f.updateStatusMessage(ctx, app)
+	}
+	result, err := releaseResult(prs)
+	f.recordStatus(ctx, app, result, err)
+	return prs, nil
+}
+
+// release creates the PR of a single manifest, claiming it so that it's released only once.
+// It returns nil when the version has already been released.
+func (f *Flow) release(ctx context.Context, e Event, tag, version string, app *Application, manifest Manifest) *PullRequest {
+	pr := f.createRelease(ctx, e, tag, version, app, manifest)
+	if pr != nil {
+		pr.channel = slackChannel(app, &manifest)
+		pr.version = version
+	}
+	return pr
+}
+
+func (f *Flow) createRelease(ctx context.Context, e Event, tag, version string, app *Application, manifest Manifest) *PullRequest {
+	env := manifest.target()
+	if pr := f.releaseHeld(ctx, tag, version, app, manifest); pr != nil {
+		return pr
+	}
+
+	if manifest.ForceDryRun && !f.DryRun {
+		return f.forceDryRun(ctx, e, tag, version, app, manifest)
 	}
 
+	if f.DryRun {
+		result, err := f.createRelasePR(ctx, e, tag, version, *app, manifest)
+		if errors.Is(err, errUnchanged) {
+			return unchangedPR(env, version)
+		}
+		if err != nil {
+			return failedPR(env, err)
+		}
+		return &PullRequest{env: env, status: prCreated, url: result.URL}
+	}
+
+	paused, err := f.checkOpenPRs(ctx, app, manifest)
 	if err != nil {
-		f.notifyFalure(e, err.Error(), app)
-		return err
+		return failedPR(env, err)
+	}
+	if paused != "" {
+		return &PullRequest{env: env, status: prSkipped, skipped: fmt.Sprintf("%s %s", version, paused)}
+	}
+
+	// Another instance (or a redelivery) already released this version
+	key := fmt.Sprintf("%s/%s/%s", app.Name, env, version)
+	claimed, err := f.store.Claim(ctx, key, currentConfig().claimTTL())
+	if err != nil {
+		return failedPR(env, err)
+	}
+	if !claimed {
+		fmt.Fprintf(os.Stdout, "%s has already been released\n", key)
+		return nil
+	}
+
+	result, err := f.createRelasePR(ctx, e, tag, version, *app, manifest)
+	if errors.Is(err, errUnchanged) {
+		// The claim is kept since there is nothing to release
+		f.completeClaims(ctx, []string{key})
+		return unchangedPR(env, version)
+	}
+	if err != nil {
+		if err := f.store.Unclaim(ctx, key); err != nil {
+			fmt.Fprintf(os.Stderr, "Error unclaiming %s: %s\n", key, err)
+		}
+		return failedPR(env, err)
+	}
+	f.completeClaims(ctx, []string{key})
+
+	if err := f.store.SetLastRelease(ctx, app.Name, env, version, f.now()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving the release of %s: %s\n", key, err)
+	}
+	f.audit(app.Name, env, version, result.URL)
+	f.watchMerge(ctx, app, manifest, version, result)
+
+	return &PullRequest{
+		env:      env,
+		status:   prCreated,
+		url:      result.URL,
+		merge:    result.Merge,
+		mergeErr: result.MergeError,
+		amended:  result.Amended,
+		reopened: result.Reopened,
+		number:   result.Number,
+		key:      key,
+	}
+}
+
+// releaseHeld returns the skipped PR of a version which is held back by the pin, the cooldown
+// or the promotion of the env, nil when it may be released
+func (f *Flow) releaseHeld(ctx context.Context, tag, version string, app *Application, manifest Manifest) *PullRequest {
+	env := manifest.target()
+	pin, err := f.getPin(ctx, app, manifest)
+	if err != nil {
+		return failedPR(env, err)
+	}
+	if pin != "" && pin != version {
+		return &PullRequest{env: env, status: prSkipped, skipped: fmt.Sprintf("pinned at %s", pin)}
+	}
+
+	remaining, err := f.cooldown(ctx, app, manifest)
+	if err != nil {
+		return failedPR(env, err)
+	}
+	if remaining > 0 {
+		return &PullRequest{env: env, status: prSkipped, skipped: fmt.Sprintf("%s deferred due to cooldown, re-run the build after %s", version, remaining)}
+	}
+
+	blocked, err := f.promotionBlocked(ctx, app, manifest, tag)
+	if err != nil {
+		return failedPR(env, err)
+	}
+	if blocked != "" {
+		return &PullRequest{env: env, status: prSkipped, skipped: fmt.Sprintf("%s is not promoted, %s", version, blocked)}
+	}
+	return nil
+}
+
+// forceDryRun computes the release of the env of force_dry_run without opening its PR,
+// so that a failing release shows up before the env is enabled again
+func (f *Flow) forceDryRun(ctx context.Context, e Event, tag, version string, app *Application, manifest Manifest) *PullRequest {
+	env := manifest.target()
+	_, err := f.createRelasePR(ctx, e, tag, version, *app, manifest)
+	if errors.Is(err, errUnchanged) {
+		return unchangedPR(env, version)
+	}
+	if err != nil {
+		return failedPR(env, err)
+	}
+	return &PullRequest{env: env, status: prSkipped, skipped: fmt.Sprintf("dry-run by force_dry_run, %s was not released", version)}
+}
+
+// completeClaims keeps the claims of the done releases, failing it only lets them expire by claim_ttl
+func (f *Flow) completeClaims(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := f.store.CompleteClaim(ctx, key); err != nil {
+			fmt.Fprintf(os.Stderr, "Error completing the claim %s: %s\n", key, err)
+		}
 	}
-	return f.notifyRelasePR(e, prs, app)
 }
 
-func shouldCreatePR(m Manifest, version string) bool {
+func failedPR(env string, err error) *PullRequest {
+	return &PullRequest{env: env, status: prFailed, err: err}
+}
+
+// appFailedPRs is the failure of the whole app, e.g. of its build, which has no env and is already notified
+func appFailedPRs(app *Application, err error) PullRequests {
+	return PullRequests{{app: app.Name, status: prFailed, err: err}}
+}
+
+func unchangedPR(env, version string) *PullRequest {
+	return &PullRequest{env: env, status: prUnchanged, skipped: fmt.Sprintf("already at %s", version)}
+}
+
+func shouldCreatePR(m Manifest, version string, branch *string) bool {
+	if !m.Filters.branchMatches(branch) {
+		return false
+	}
+
 	for _, prefix := range m.Filters.ExcludePrefixes {
 		if strings.HasPrefix(version, prefix) {
 			return false
@@ -95,110 +438,269 @@ func shouldCreatePR(m Manifest, version string) bool {
 }
 
 // createRelasePR submits release PullRequest to manifest repository
-func (f *Flow) createRelasePR(ctx context.Context, version string, a Application, m Manifest) (string, error) {
-	baseBranch := a.ManifestBaseBranch
-	if m.BaseBranch != "" {
-		baseBranch = m.BaseBranch
+func (f *Flow) createRelasePR(ctx context.Context, e Event, tag, version string, a Application, m Manifest) (*gitbot.Result, error) {
+	fetchCtx, cancel := withFetchTimeout(ctx)
+	defer cancel()
+
+	release, err := f.newRelease(fetchCtx, e, tag, version, a, m)
+	if err != nil {
+		return nil, err
 	}
 
-	repo := gitbot.NewRepo(a.ManifestOwner, a.ManifestName, baseBranch)
+	// Nothing to release when the files already reference the version
+	changes, err := release.PreviewFrom(func(filePath string) (string, error) {
+		return f.getContent(fetchCtx, &release.Repo, filePath)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !anyChanged(changes) {
+		return nil, errUnchanged
+	}
+
+	if f.DryRun || m.ForceDryRun {
+		fmt.Fprintf(os.Stdout, "dry-run: skipping the release of %s %s %s\n", a.Name, m.target(), version)
+		return &gitbot.Result{URL: "dry-run"}, nil
+	}
+
+	unlock, err := lockRepo(ctx, release.Repo.FullName())
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// Create a release PullRequest
+	return f.releaser.Create(ctx, release, f.token(ctx))
+}
+
+// releaseLink is the URL of the GitHub release of the tag, empty when it's not linked
+func (f *Flow) releaseLink(ctx context.Context, a Application, tag string) string {
+	if a.IncludeReleaseLink != nil && !*a.IncludeReleaseLink {
+		return ""
+	}
+
+	if a.CheckReleaseLink {
+		repo := gitbot.NewRepo(a.SourceOwner, a.SourceName, "")
+		repo.SetHTTPClient(f.httpClient)
+		ok, err := repo.ReleaseExists(ctx, f.token(ctx), tag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error checking the release %s of %s, not linking it: %s\n", tag, a.Name, err)
+			return ""
+		}
+		if !ok {
+			return ""
+		}
+	}
+	return fmt.Sprintf("https://github.com/%s/%s/releases/tag/%s", a.SourceOwner, a.SourceName, tag)
+}
+
+// newRelease prepares the release of the manifest without writing anything,
+// the version is written to the files while the original tag is linked from the PR
+func (f *Flow) newRelease(ctx context.Context, e Event, tag, version string, a Application, m Manifest) (*gitbot.Release, error) {
+	repo := gitbot.NewRepo(a.ManifestOwner, a.ManifestName, a.baseBranch(m))
+	repo.SetHTTPClient(f.httpClient)
 
 	// Create PR Body with tag page URL
-	prBody := fmt.Sprintf("https://github.com/%s/%s/releases/tag/%s", a.SourceOwner, a.SourceName, version)
-	if m.PRBody != "" {
-		prBody += fmt.Sprintf("\n\n%s", m.PRBody)
+	prBody := f.releaseLink(ctx, a, tag)
+	data := prBodyData{
+		App:           a.Name,
+		Env:           m.Env,
+		Version:       version,
+		Substitutions: e.Substitutions,
+	}
+	body, err := prBodySections(a, m, data)
+	if err != nil {
+		return nil, err
 	}
-	release := gitbot.NewRelease(*repo, a.Name, m.Env, version, prBody)
+	if prBody != "" && body != "" {
+		prBody += "\n\n"
+	}
+	prBody += body
+	release := gitbot.NewRelease(*repo, a.Name, m.target(), version, prBody)
 
-	for _, filePath := range m.Files {
-		release.AddChanges(filePath, fmt.Sprintf("%s:.*", a.ImageName), fmt.Sprintf("%s:%s", a.ImageName, version))
+	if within := currentConfig().ReopenClosedWithin; within > 0 {
+		release.ReopenClosedPR(within)
 	}
 
-	// Add Commit Author
-	release.AddAuthor(cfg.GitAuthor.Name, cfg.GitAuthor.Email)
+	// The branches of the app are told apart from the ones of the other apps to be amended
+	if m.OpenPR == openPRAmend {
+		release.SetPullRequest(fmt.Sprintf("release/%s/%s/%s", a.Name, m.target(), version), release.Title(), prBody)
+		release.AmendOpenPR(fmt.Sprintf("release/%s/%s/", a.Name, m.target()))
+	}
 
-	fmt.Printf("%#v", release)
+	digest := e.imageDigest(tag)
+	if m.PinBy == pinByDigest && digest == "" {
+		return nil, fmt.Errorf("No digest of %s:%s was pushed by the build", a.ImageName, tag)
+	}
+	// The versions of the labels are not tags of the image
+	imageTag := version
+	if a.VersionLabel != "" && tag != "" {
+		imageTag = tag
+	}
+	imageRef, err := a.imageRef(imageTag, digest, m.PinBy == pinByDigest)
+	if err != nil {
+		return nil, err
+	}
 
-	// Create a release PullRequest
-	prURL, err := release.Create(ctx, f.githubToken)
+	forms, err := a.imageForms(imageRef)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return *prURL, nil
-}
 
-func (f *Flow) notifyRelasePR(e cloudbuildevent.Event, prs PullRequests, app *Application) error {
-	var prURL string
+	var custom imageForm
+	if m.ImagePattern != nil {
+		if custom, err = a.patternForm(*m.ImagePattern, imageRef, version); err != nil {
+			return nil, err
+		}
+	}
 
-	for _, pr := range prs {
-		if pr.err != nil {
-			prURL += fmt.Sprintf("`%s`\n```%s```\n", pr.env, pr.err)
+	files, err := m.files(a)
+	if err != nil {
+		return nil, err
+	}
+	if limit := currentConfig().fetchLimits().MaxFiles; len(files) > limit {
+		return nil, fmt.Errorf("%s %s has %d files, more than the fetch max_files %d", a.Name, m.target(), len(files), limit)
+	}
+
+	for _, filePath := range files {
+		// Skip files which no longer reference the image (stale config)
+		content, err := f.getContent(ctx, repo, filePath)
+		if err != nil {
+			return nil, err
+		}
+		fileForms := forms
+		if m.ImagePattern.usedFor(filePath) {
+			fileForms = []imageForm{custom}
+		}
+		var matched []imageForm
+		for _, form := range fileForms {
+			if form.re.MatchString(content) {
+				matched = append(matched, form)
+			}
+		}
+		if len(matched) == 0 && m.Bootstrap != nil {
+			u, err := bootstrapUpdater(version, imageRef, a, m)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(os.Stdout, "Bootstrapping %s of %s %s\n", filePath, a.Name, m.Env)
+			release.AddUpdate(filePath, u)
+			continue
+		}
+		if len(matched) == 0 {
+			fmt.Fprintf(os.Stderr, "Warning: %s does not contain %s, skipping\n", filePath, a.ImageName)
 			continue
 		}
 
-		prURL += fmt.Sprintf("`%s`\n```%s```\n", pr.env, pr.url)
+		for _, form := range matched {
+			u := form.updater(m.UpdateStrategy)
+			if m.Replace == replaceFirst {
+				u = gitbot.FirstMatchOnly(u)
+			}
+			release.AddUpdate(filePath, u)
+		}
 	}
 
-	d := slackbot.MessageDetail{
-		IsSuccess:  true,
-		IsPrNotify: true,
-		LogURL:     e.LogURL,
-		AppName:    app.Name,
-		Images:     e.Images,
-		TagName:    e.TagName,
-		BranchName: e.BranchName,
-		PrURL:      prURL,
+	if len(release.Changes) == 0 {
+		return nil, fmt.Errorf("None of the files contain %s: %s", a.ImageName, strings.Join(files, ", "))
 	}
 
-	return slackbot.NewSlackMessage(f.slackBotToken, cfg.SlackNotifiyChannel, d).Post()
-}
+	if a.Marker != nil {
+		p, content, err := a.markerFile(m, version, e.Substitutions)
+		if err != nil {
+			return nil, err
+		}
+		release.AddFile(p, content)
+	}
 
-func (f *Flow) notifyDeploy(e cloudbuildevent.Event) error {
-	d := slackbot.MessageDetail{
-		IsSuccess:  true,
-		IsPrNotify: false,
-		LogURL:     e.LogURL,
-		AppName:    *e.RepoName,
-		TagName:    e.TagName,
-		BranchName: e.BranchName,
+	// Add Commit Author
+	author, err := f.author(ctx, &a)
+	if err != nil {
+		return nil, err
 	}
+	release.AddAuthor(author.Name, author.Email)
+	c := currentConfig()
+	if c.CommitDate == commitDateBuild && e.FinishTime != nil {
+		release.SetCommitDate(*e.FinishTime)
+	}
+	release.AddLabel(c.prLabel())
 
-	return slackbot.NewSlackMessage(f.slackBotToken, cfg.SlackNotifiyChannel, d).Post()
-}
+	reviewers := m.Reviewers
+	if m.ReviewerCount > 0 && m.ReviewerCount < len(reviewers) {
+		reviewers = reviewers[:m.ReviewerCount]
+	}
+	teamReviewers := m.TeamReviewers
+	if m.CodeOwners != "" {
+		reviewers, teamReviewers, err = f.addCodeOwners(ctx, repo, release, a, m, reviewers, teamReviewers)
+		if err != nil {
+			return nil, err
+		}
+	}
+	release.AddReviewers(reviewers, teamReviewers)
 
-func (f *Flow) notifyFalure(e cloudbuildevent.Event, errorMessage string, app *Application) error {
-	d := slackbot.MessageDetail{
-		IsSuccess:    false,
-		LogURL:       e.LogURL,
-		Images:       e.Images,
-		ErrorMessage: errorMessage,
-		TagName:      e.TagName,
-		BranchName:   e.BranchName,
+	if m.ReleaseTag != "" {
+		tag, err := renderTemplate("release_tag", m.ReleaseTag, prBodyData{App: a.Name, Env: m.Env, Version: version})
+		if err != nil {
+			return nil, err
+		}
+		release.AddTag(tag, m.MoveReleaseTag)
 	}
 
-	if app != nil {
-		d.AppName = app.Name
+	if m.AutoMerge {
+		release.EnableAutoMerge(m.RequiredChecks, m.ChecksTimeout)
+
+		title, err := renderTemplate("merge_commit_title", m.MergeCommitTitle, data)
+		if err != nil {
+			return nil, err
+		}
+		commitBody, err := renderTemplate("merge_commit_body", m.MergeCommitBody, data)
+		if err != nil {
+			return nil, err
+		}
+		release.SetMergeCommit(strings.TrimSpace(title), strings.TrimSpace(commitBody))
 	}
 
-	return slackbot.NewSlackMessage(f.slackBotToken, cfg.SlackNotifiyChannel, d).Post()
+	return release, nil
 }
 
-func getApplicationByEventRepoName(eventRepoName string) (*Application, error) {
-	for _, app := range cfg.ApplicationList {
-		// CloudBuild Repo Names
-		if eventRepoName == fmt.Sprintf("github-%s-%s", app.SourceOwner, app.SourceName) {
-			return &app, nil
+// isSourceRepo tells whether the Cloud Build repository name is the one of the source of the app,
+// or of one of its build_repos
+func (a *Application) isSourceRepo(repoName string) bool {
+	repos := append([]string{a.SourceOwner + "/" + a.SourceName}, a.BuildRepos...)
+	for _, repo := range repos {
+		for _, name := range cloudBuildRepoNames(repo) {
+			if repoName == name {
+				return true
+			}
 		}
 	}
+	return false
+}
+
+// verifySource fails the builds of another repository than the source of the app, e.g. of a
+// mis-wired trigger. The builds without a repository, e.g. the manual ones, can't be verified.
+func (a *Application) verifySource(e Event) error {
+	if a.VerifySource != nil && !*a.VerifySource {
+		return nil
+	}
+	if e.RepoName == nil || *e.RepoName == "" || a.isSourceRepo(*e.RepoName) {
+		return nil
+	}
+	return fmt.Errorf("the build is of %s instead of %s/%s, check the trigger, build_repos or set verify_source: false", *e.RepoName, a.SourceOwner, a.SourceName)
+}
+
+func getApplicationByEventRepoName(eventRepoName string) (*Application, error) {
+	c := currentConfig()
+	if app := c.indexedApp(c.index.byRepoName, eventRepoName); app != nil {
+		return app, nil
+	}
 	return nil, errors.New("No application found for " + eventRepoName)
 }
 
 func getApplicationByEventTriggerID(eventTriggerID string) (*Application, error) {
-	for _, app := range cfg.ApplicationList {
-		// CloudBuild Repo Names
-		if eventTriggerID == app.TriggerID {
-			return &app, nil
-		}
+	c := currentConfig()
+	if app := c.indexedApp(c.index.byTriggerID, eventTriggerID); app != nil {
+		return app, nil
 	}
 	return nil, errors.New("No application found for " + eventTriggerID)
 }
@@ -209,6 +711,50 @@ func getVersionFromImage(images []string) (string, error) {
 		return "", errors.New("no images found")
 	}
 	// does not support multiple images
-	tags := strings.Split(images[0], ":")
-	return tags[1], nil
+	tag := getTagFromImage(images[0])
+	if tag == "" {
+		return "", fmt.Errorf("%s has no tag", images[0])
+	}
+	return tag, nil
+}
+
+// getManifestTag selects the image tagged with the TagPrefix of the manifest among
+// all the images, manifests without TagPrefix use the tag as is. Without images,
+// e.g. of the versions from the tag of the build, the tag itself must have the prefix.
+func getManifestTag(m Manifest, images []string, tag string) (string, bool) {
+	if m.TagPrefix == "" {
+		return tag, true
+	}
+	if images == nil {
+		return tag, strings.HasPrefix(tag, m.TagPrefix)
+	}
+
+	for _, image := range images {
+		t := getTagFromImage(image)
+		if strings.HasPrefix(t, m.TagPrefix) {
+			return t, true
+		}
+	}
+	return "", false
+}
+
+func getTagFromImage(image string) string {
+	// the registry host may have a port
+	i := strings.LastIndex(image, ":")
+	if i < 0 || strings.Contains(image[i:], "/") {
+		return ""
+	}
+	return image[i+1:]
+}
+
+// errUnchanged is returned when the files already reference the version
+var errUnchanged = errors.New("the files are unchanged")
+
+func anyChanged(changes []gitbot.FileChange) bool {
+	for _, c := range changes {
+		if c.Changed {
+			return true
+		}
+	}
+	return false
 }
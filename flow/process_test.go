@@ -0,0 +1,185 @@
+package flow
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sakajunquality/cloud-pubsub-events/cloudbuildevent"
+)
+
+func TestGetManifestTag(t *testing.T) {
+	images := []string{"gcr.io/project/app:staging-1.4.0", "gcr.io/project/app:prod-1.4.0"}
+
+	tests := []struct {
+		name   string
+		prefix string
+		want   string
+		ok     bool
+	}{
+		{"without prefix", "", "staging-1.4.0", true},
+		{"prod image", "prod-", "prod-1.4.0", true},
+		{"staging image", "staging-", "staging-1.4.0", true},
+		{"no image of the env", "dev-", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := getManifestTag(Manifest{TagPrefix: tt.prefix}, images, "staging-1.4.0")
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: getManifestTag = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestGetTagFromImage(t *testing.T) {
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{"gcr.io/project/app:v1.0.0", "v1.0.0"},
+		{"localhost:5000/app:v1.0.0", "v1.0.0"},
+		{"localhost:5000/app", ""},
+		{"app", ""},
+	}
+	for _, tt := range tests {
+		if got := getTagFromImage(tt.image); got != tt.want {
+			t.Errorf("getTagFromImage(%q) = %q, want %q", tt.image, got, tt.want)
+		}
+	}
+}
+
+// testEvent is a finished build of the trigger
+func testEvent(status string, images []string, branch, tag string) Event {
+	finished := time.Now()
+	trigger := "trigger"
+	e := cloudbuildevent.Event{
+		ID:         "build",
+		Status:     status,
+		LogURL:     "https://console.cloud.google.com/cloud-build/builds/build",
+		FinishTime: &finished,
+		TriggerID:  &trigger,
+	}
+	e.Images = images
+	if branch != "" {
+		e.BranchName = &branch
+	}
+	if tag != "" {
+		e.TagName = &tag
+	}
+	return Event{Event: e}
+}
+
+func TestDeployOnly(t *testing.T) {
+	slackAPI := newSlackServer()
+	defer slackAPI.Close()
+
+	setConfig(&Config{
+		SlackNotifiyChannel: "#deploy",
+		ApplicationList:     []Application{{Name: "app", TriggerID: "trigger", DeployOnly: true}},
+	})
+	f := newTestFlow()
+
+	tests := []struct {
+		name   string
+		event  Event
+		title  string
+		fields map[string]string
+	}{
+		{"branch deploy", testEvent("SUCCESS", nil, "main", ""), "Build Success", map[string]string{"App": "app", "Branch": "main"}},
+		{"tag deploy", testEvent("SUCCESS", nil, "", "v1.0.0"), "Build Success", map[string]string{"App": "app", "Tag": "v1.0.0"}},
+		{"failed deploy", testEvent("FAILURE", nil, "main", ""), "Build Failure", map[string]string{"Branch": "main"}},
+	}
+	for _, tt := range tests {
+		if _, err := f.process(context.Background(), tt.event); err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+
+		posts := slackAPI.Posts()
+		if len(posts) != 1 {
+			t.Errorf("%s: posted %+v, want one message", tt.name, posts)
+			continue
+		}
+		p := posts[0]
+		if p.Channel != "#deploy" || p.Title != tt.title {
+			t.Errorf("%s: posted %q to %s, want %q to #deploy", tt.name, p.Title, p.Channel, tt.title)
+		}
+		for title, want := range tt.fields {
+			if p.Fields[title] != want {
+				t.Errorf("%s: %s is %q, want %q", tt.name, title, p.Fields[title], want)
+			}
+		}
+		if _, ok := p.Fields["Deploy Pull Request"]; ok {
+			t.Errorf("%s: posted a release PR: %+v", tt.name, p)
+		}
+	}
+}
+
+func TestSlackChannel(t *testing.T) {
+	slackAPI := newSlackServer()
+	defer slackAPI.Close()
+
+	setConfig(&Config{
+		SlackNotifiyChannel: "#deploy",
+		ApplicationList: []Application{
+			{Name: "app", TriggerID: "trigger", SlackChannel: "#app"},
+		},
+	})
+	f := newTestFlow()
+
+	tests := []struct {
+		name  string
+		event Event
+		title string
+	}{
+		{"failed build", testEvent("FAILURE", []string{"gcr.io/project/app:v1.0.0"}, "", "v1.0.0"), "Build Failure"},
+		{"no images", testEvent("SUCCESS", nil, "", "v1.0.0"), "Build Failure"},
+		{"no release", testEvent("SUCCESS", []string{"gcr.io/project/app:v1.0.0"}, "", "v1.0.0"), "Build Success"},
+	}
+	for _, tt := range tests {
+		if _, err := f.process(context.Background(), tt.event); err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+
+		posts := slackAPI.Posts()
+		if len(posts) != 1 || posts[0].Channel != "#app" || posts[0].Title != tt.title {
+			t.Errorf("%s: posted %+v, want %q to #app", tt.name, posts, tt.title)
+		}
+	}
+}
+
+func TestShouldCreatePR(t *testing.T) {
+	main, feature, release := "main", "feature/login", "release/1.4"
+	filters := Filters{
+		IncludePrefixes: []string{"v1."},
+		ExcludePrefixes: []string{"v1.0."},
+		IncludeBranches: []string{"main", "release/*"},
+		ExcludeBranches: []string{"release/0.*"},
+	}
+
+	tests := []struct {
+		name    string
+		filters Filters
+		version string
+		branch  *string
+		want    bool
+	}{
+		{"no filters", Filters{}, "v2.0.0", &feature, true},
+		{"included version and branch", filters, "v1.4.0", &main, true},
+		{"branch pattern", filters, "v1.4.0", &release, true},
+		{"branch not included", filters, "v1.4.0", &feature, false},
+		{"excluded version on an included branch", filters, "v1.0.1", &main, false},
+		{"version not included on an included branch", filters, "v2.0.0", &main, false},
+		{"tag build without a branch", filters, "v1.4.0", nil, true},
+		{"tag build of an excluded version", filters, "v1.0.1", nil, false},
+		{"excluded branch only", Filters{ExcludeBranches: []string{"feature/*"}}, "v1.4.0", &feature, false},
+		{"build metadata of an included version", filters, "v1.4.0+build.27", &main, true},
+		{"build metadata of an excluded version", filters, "v1.0.1+build.27", &main, false},
+		{"build metadata never matches a prefix", Filters{ExcludePrefixes: []string{"build"}}, "v1.4.0+build.27", &main, true},
+	}
+	for _, tt := range tests {
+		if got := shouldCreatePR(Manifest{Filters: tt.filters}, tt.version, tt.branch); got != tt.want {
+			t.Errorf("%s: shouldCreatePR = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sakajunquality/flow/gitbot"
+)
+
+// promotionBlocked returns why the GitHub release of the tag doesn't promote the version to the env,
+// empty when it does or the env has no promotion
+func (f *Flow) promotionBlocked(ctx context.Context, a *Application, m Manifest, tag string) (string, error) {
+	p := m.Promotion
+	if p == nil {
+		return "", nil
+	}
+
+	repo := gitbot.NewRepo(a.SourceOwner, a.SourceName, "")
+	repo.SetHTTPClient(f.httpClient)
+	release, err := repo.GetRelease(ctx, f.token(ctx), tag)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case release == nil:
+		return fmt.Sprintf("%s has no GitHub release to promote it", tag), nil
+	case release.Draft:
+		return fmt.Sprintf("the release %s is a draft", tag), nil
+	case p.Stable && release.Prerelease:
+		return fmt.Sprintf("the release %s is a prerelease", tag), nil
+	case p.Marker != "" && !strings.Contains(release.Name, p.Marker) && !strings.Contains(release.Body, p.Marker):
+		return fmt.Sprintf("the release %s is not marked %s", tag, p.Marker), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,254 @@
+package flow
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"golang.org/x/oauth2/google"
+)
+
+// VersionResolver reads the version of a pushed image, e.g. from a label of its config.
+// The ref is the tag or the digest of the image, an empty version falls back to the tag.
+type VersionResolver interface {
+	ResolveVersion(ctx context.Context, image, ref, label string) (string, error)
+}
+
+const (
+	dockerHubRegistry = "registry-1.docker.io"
+	// maxRegistryResponse limits the manifests and the configs read from the registries
+	maxRegistryResponse = 4 << 20
+)
+
+// manifestMediaTypes are the manifests and the indexes of the platforms the registries may respond
+var manifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.image.index.v1+json",
+}
+
+var authParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// registryVersionResolver reads the labels of the image config with the Docker Registry HTTP API v2
+type registryVersionResolver struct {
+	httpClient *http.Client
+	auth       RegistryAuth
+}
+
+type registryManifest struct {
+	Config struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+	// Manifests are of the platforms when the manifest is an index
+	Manifests []struct {
+		Digest   string `json:"digest"`
+		Platform struct {
+			OS           string `json:"os"`
+			Architecture string `json:"architecture"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+func (r registryVersionResolver) ResolveVersion(ctx context.Context, image, ref, label string) (string, error) {
+	host, repo := splitImageName(image)
+
+	// The authorization of the first request is reused by the next ones
+	var authorization string
+	var m registryManifest
+	accept := strings.Join(manifestMediaTypes, ", ")
+	if err := r.get(ctx, host, repo, "manifests/"+ref, accept, &authorization, &m); err != nil {
+		return "", err
+	}
+
+	// The labels of an index are the ones of linux/amd64, or of the first platform
+	if len(m.Manifests) > 0 {
+		digest := m.Manifests[0].Digest
+		for _, p := range m.Manifests {
+			if p.Platform.OS == "linux" && p.Platform.Architecture == "amd64" {
+				digest = p.Digest
+				break
+			}
+		}
+		m = registryManifest{}
+		if err := r.get(ctx, host, repo, "manifests/"+digest, accept, &authorization, &m); err != nil {
+			return "", err
+		}
+	}
+	if m.Config.Digest == "" {
+		return "", fmt.Errorf("the manifest of %s has no config", ref)
+	}
+
+	var config struct {
+		Config struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"config"`
+	}
+	if err := r.get(ctx, host, repo, "blobs/"+m.Config.Digest, "", &authorization, &config); err != nil {
+		return "", err
+	}
+	return config.Config.Labels[label], nil
+}
+
+// get requests the registry with the authorization, anonymously at first, and authenticates as the
+// challenge of the registry asks, i.e. with a bearer token of its token service or with the basic credentials
+func (r registryVersionResolver) get(ctx context.Context, host, repo, path, accept string, authorization *string, v interface{}) error {
+	u := fmt.Sprintf("https://%s/v2/%s/%s", host, repo, path)
+
+	resp, err := r.do(ctx, u, accept, *authorization)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("Www-Authenticate")
+		resp.Body.Close()
+
+		if *authorization, err = r.authorize(ctx, challenge); err != nil {
+			return err
+		}
+		if resp, err = r.do(ctx, u, accept, *authorization); err != nil {
+			return err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded %s", u, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxRegistryResponse)).Decode(v)
+}
+
+func (r registryVersionResolver) do(ctx context.Context, u, accept, authorization string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	return r.httpClient.Do(req)
+}
+
+// authorize returns the Authorization header answering the challenge
+func (r registryVersionResolver) authorize(ctx context.Context, challenge string) (string, error) {
+	user, password, err := r.credentials(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := map[string]string{}
+	for _, m := range authParam.FindAllStringSubmatch(challenge, -1) {
+		params[m[1]] = m[2]
+	}
+
+	switch {
+	case strings.HasPrefix(challenge, "Basic"):
+		if user == "" {
+			return "", errors.New("the registry requires credentials, see registry in the config")
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password)), nil
+	case strings.HasPrefix(challenge, "Bearer") && params["realm"] != "":
+	default:
+		return "", fmt.Errorf("unknown authentication of the registry: %q", challenge)
+	}
+
+	q := url.Values{}
+	for _, key := range []string{"service", "scope"} {
+		if params[key] != "" {
+			q.Set(key, params[key])
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, params["realm"]+"?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if user != "" {
+		req.SetBasicAuth(user, password)
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("the token service of the registry responded %s: %s", resp.Status, body)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxRegistryResponse)).Decode(&token); err != nil {
+		return "", err
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	return "Bearer " + token.Token, nil
+}
+
+// credentials are of the registry config, anonymous when it's empty
+func (r registryVersionResolver) credentials(ctx context.Context) (string, string, error) {
+	if r.auth.Google {
+		ts, err := google.DefaultTokenSource(ctx, "https://www.googleapis.com/auth/cloud-platform")
+		if err != nil {
+			return "", "", err
+		}
+		t, err := ts.Token()
+		if err != nil {
+			return "", "", err
+		}
+		return "oauth2accesstoken", t.AccessToken, nil
+	}
+	if r.auth.Username == "" {
+		return "", "", nil
+	}
+	return r.auth.Username, os.Getenv(r.auth.PasswordEnv), nil
+}
+
+// splitImageName splits the image into the registry host and the repository,
+// the images without a host are of Docker Hub
+func splitImageName(image string) (string, string) {
+	i := strings.Index(image, "/")
+	if i < 0 {
+		return dockerHubRegistry, "library/" + image
+	}
+	host := image[:i]
+	if !strings.ContainsAny(host, ".:") && host != "localhost" {
+		return dockerHubRegistry, image
+	}
+	return host, image[i+1:]
+}
+
+// labelVersion reads the version_label of the image pushed with the tag. It's empty when the label
+// is missing or can't be read, and the version is then extracted from the tag.
+func (f *Flow) labelVersion(ctx context.Context, e Event, app *Application, tag string) string {
+	ref := tag
+	if digest := e.imageDigest(tag); digest != "" {
+		ref = digest
+	}
+
+	version, err := f.versions.ResolveVersion(ctx, app.ImageName, ref, app.VersionLabel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not read the label %s of %s:%s, using the tag: %s\n", app.VersionLabel, app.ImageName, tag, err)
+		return ""
+	}
+	if version == "" {
+		fmt.Fprintf(os.Stderr, "Warning: %s:%s has no label %s, using the tag\n", app.ImageName, tag, app.VersionLabel)
+	}
+	return version
+}
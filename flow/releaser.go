@@ -0,0 +1,47 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sakajunquality/flow/gitbot"
+)
+
+// Releaser reads the manifest repository and opens the release PRs, GitHub by default.
+// See the flowtest package for a fake.
+type Releaser interface {
+	GetContent(ctx context.Context, repo *gitbot.Repo, token, filePath string) (string, error)
+	Create(ctx context.Context, release *gitbot.Release, token string) (*gitbot.Result, error)
+}
+
+// getContent reads the file within the FetchLimits
+func (f *Flow) getContent(ctx context.Context, repo *gitbot.Repo, filePath string) (string, error) {
+	limits := currentConfig().fetchLimits()
+	content, err := f.releaser.GetContent(ctx, repo, f.token(ctx), filePath)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", fmt.Errorf("reading %s exceeded the fetch timeout %s", filePath, limits.Timeout)
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(content) > limits.MaxFileSize {
+		return "", fmt.Errorf("%s is %d bytes, larger than the fetch max_file_size %d", filePath, len(content), limits.MaxFileSize)
+	}
+	return content, nil
+}
+
+// withFetchTimeout limits the reads of the files of a release to the fetch timeout
+func withFetchTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, currentConfig().fetchLimits().Timeout)
+}
+
+type githubReleaser struct{}
+
+func (githubReleaser) GetContent(ctx context.Context, repo *gitbot.Repo, token, filePath string) (string, error) {
+	return repo.GetContent(ctx, token, filePath)
+}
+
+func (githubReleaser) Create(ctx context.Context, release *gitbot.Release, token string) (*gitbot.Result, error) {
+	return release.Create(ctx, token)
+}
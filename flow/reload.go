@@ -0,0 +1,112 @@
+package flow
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v2"
+)
+
+// maxApplicationSize bounds the body of ApplicationHandler
+const maxApplicationSize = 1 << 20
+
+// cfgMu serializes the changes of the config
+var cfgMu sync.Mutex
+
+// cfgValue holds the *Config, the readers take it once with currentConfig and keep using it
+var cfgValue atomic.Value
+
+// currentConfig is the config at the time of the call. The events resolve their apps once, and
+// ReplaceApplication only replaces the apps, so the other settings are the same in every config.
+func currentConfig() *Config {
+	c, _ := cfgValue.Load().(*Config)
+	return c
+}
+
+// setConfig indexes the apps of the config and publishes it
+func setConfig(c *Config) {
+	c.index = newAppIndex(c.ApplicationList)
+	cfgValue.Store(c)
+}
+
+// ReplaceApplication replaces the app of the same name in a copy of the config, which is validated
+// and indexed before it's swapped in. The events being processed keep the app they resolved.
+func (f *Flow) ReplaceApplication(app Application) error {
+	cfgMu.Lock()
+	defer cfgMu.Unlock()
+
+	c := *currentConfig()
+	c.ApplicationList = append([]Application(nil), c.ApplicationList...)
+
+	replaced := false
+	for i := range c.ApplicationList {
+		if c.ApplicationList[i].Name == app.Name {
+			c.ApplicationList[i] = app
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		return fmt.Errorf("%w named %s", ErrNoApplication, app.Name)
+	}
+
+	if err := c.validate(); err != nil {
+		return err
+	}
+	setConfig(&c)
+	return nil
+}
+
+// ApplicationHandler replaces an app by PUT /applications/<name> with its YAML definition, like in
+// the config. It requires the FLOW_ADMIN_TOKEN as the bearer token, it's disabled without one.
+func (f *Flow) ApplicationHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !f.authorizedAdmin(r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodPut {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := strings.TrimPrefix(r.URL.Path, "/applications/")
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxApplicationSize))
+		if err != nil {
+			http.Error(w, "could not read the application", http.StatusBadRequest)
+			return
+		}
+
+		var app Application
+		if err := yaml.UnmarshalStrict(body, &app); err != nil {
+			http.Error(w, fmt.Sprintf("invalid application: %s", err), http.StatusBadRequest)
+			return
+		}
+		if app.Name != name {
+			http.Error(w, fmt.Sprintf("the name %s is not the one of the path %s", app.Name, name), http.StatusBadRequest)
+			return
+		}
+
+		if err := f.ReplaceApplication(app); err != nil {
+			fmt.Fprintf(os.Stderr, "Error replacing the application %s from %s: %s\n", name, r.RemoteAddr, err)
+			http.Error(w, f.redact(err.Error()), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(os.Stdout, "Replaced the application %s from %s\n", name, r.RemoteAddr)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func (f *Flow) authorizedAdmin(r *http.Request) bool {
+	if f.adminToken == "" {
+		return false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(f.adminToken)) == 1
+}
@@ -0,0 +1,38 @@
+package flow
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+)
+
+// TestReplaceApplicationWhileProcessing is meant for -race, the events read the config being replaced
+func TestReplaceApplicationWhileProcessing(t *testing.T) {
+	slackAPI := newSlackServer()
+	defer slackAPI.Close()
+
+	setConfig(&Config{
+		SlackNotifiyChannel: "#deploy",
+		ApplicationList:     []Application{{Name: "app", TriggerID: "trigger"}},
+	})
+	f := newTestFlow()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			if err := f.ReplaceApplication(Application{Name: "app", TriggerID: "trigger"}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	e := testEvent("FAILURE", []string{"gcr.io/project/app:v1.0.0"}, "", "v1.0.0")
+	for i := 0; i < 20; i++ {
+		if _, err := f.ProcessOnce(context.Background(), e, ioutil.Discard); err == nil {
+			t.Error("processed the failed build without an error")
+		}
+	}
+	<-done
+}
@@ -0,0 +1,50 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrNoApplication is returned by the AppResolver when no app takes the event, the event is acked
+var ErrNoApplication = errors.New("no application is configured")
+
+// AppResolver returns the apps of the event. The errors other than ErrNoApplication
+// are taken as temporary, the event is redelivered.
+type AppResolver interface {
+	Resolve(ctx context.Context, e Event) ([]Application, error)
+}
+
+// configResolver resolves the apps of the config by the trigger ID or name, or by the repository
+// of the builds which were not triggered
+type configResolver struct{}
+
+func (configResolver) Resolve(ctx context.Context, e Event) ([]Application, error) {
+	// Looked up in a single config, which ReplaceApplication may replace meanwhile
+	c := currentConfig()
+	if e.TriggerID != nil {
+		app := c.indexedApp(c.index.byTriggerID, *e.TriggerID)
+		if app == nil && e.Substitutions["TRIGGER_NAME"] != "" {
+			app = c.indexedApp(c.index.byTriggerID, e.Substitutions["TRIGGER_NAME"])
+		}
+		if app == nil {
+			return nil, fmt.Errorf("%w for %s", ErrNoApplication, *e.TriggerID)
+		}
+		return []Application{*app}, nil
+	}
+
+	if e.RepoName != nil {
+		app := c.indexedApp(c.index.byRepoName, *e.RepoName)
+		if app == nil {
+			return nil, fmt.Errorf("%w for %s", ErrNoApplication, *e.RepoName)
+		}
+		return []Application{*app}, nil
+	}
+
+	return nil, fmt.Errorf("%w for the build without trigger nor repository", ErrNoApplication)
+}
+
+// retryable tells whether the event should be redelivered instead of being acked
+func retryable(err error) bool {
+	return err != nil && !errors.Is(err, ErrNoApplication)
+}
@@ -0,0 +1,108 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// resultSchema is the version of the EventResult published to the result_topic, the fields are
+// only ever added so the consumers of a version keep working
+const resultSchema = "v1"
+
+// EventResult is the machine readable summary of a processed event
+type EventResult struct {
+	BuildID string      `json:"build_id"`
+	Apps    []AppResult `json:"apps"`
+	// Error is why the event failed, the apps are the ones processed until then
+	Error string `json:"error,omitempty"`
+}
+
+// AppResult is the result of each env of an app
+type AppResult struct {
+	App  string      `json:"app"`
+	Envs []EnvResult `json:"envs"`
+}
+
+// EnvResult is the result of an env, Status is one of created, filtered, skipped, unchanged and failed.
+// The failures of the whole app, e.g. of its build, are failed without Env.
+type EnvResult struct {
+	Env     string `json:"env"`
+	Version string `json:"version,omitempty"`
+	Status  string `json:"status"`
+	PRURL   string `json:"pr_url,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// newEventResult groups the results by app, in the order the apps were processed
+func (f *Flow) newEventResult(e Event, prs PullRequests) *EventResult {
+	result := &EventResult{BuildID: e.ID, Apps: []AppResult{}}
+
+	index := map[string]int{}
+	for _, pr := range prs {
+		i, ok := index[pr.app]
+		if !ok {
+			i = len(result.Apps)
+			index[pr.app] = i
+			result.Apps = append(result.Apps, AppResult{App: pr.app})
+		}
+
+		env := EnvResult{
+			Env:     pr.env,
+			Version: pr.version,
+			Status:  string(pr.status),
+			PRURL:   pr.url,
+			Reason:  pr.skipped,
+		}
+		if pr.err != nil {
+			env.Error = f.redact(pr.err.Error())
+		}
+		result.Apps[i].Envs = append(result.Apps[i].Envs, env)
+	}
+	return result
+}
+
+// publishResult publishes the result of the event to the result_topic, with the build_id and
+// the schema attributes. The client retries the publish in the background, failing it is only logged.
+func (f *Flow) publishResult(ctx context.Context, e Event, prs PullRequests, err error) {
+	if f.resultTopic == nil {
+		return
+	}
+
+	result := f.newEventResult(e, prs)
+	if err != nil {
+		result.Error = f.redact(err.Error())
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error encoding the result of %s: %s\n", e.ID, err)
+		return
+	}
+
+	published := f.resultTopic.Publish(ctx, &pubsub.Message{
+		Data: b,
+		Attributes: map[string]string{
+			"build_id": e.ID,
+			"schema":   resultSchema,
+		},
+	})
+	go func() {
+		if _, err := published.Get(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "Error publishing the result of %s: %s\n", e.ID, err)
+		}
+	}()
+}
+
+// printResult writes the result to stdout as a JSON line, see Flow.JSONResults
+func printResult(result *EventResult) {
+	b, err := json.Marshal(result)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error encoding the result of %s: %s\n", result.BuildID, err)
+		return
+	}
+	fmt.Fprintf(os.Stdout, "%s\n", b)
+}
@@ -0,0 +1,80 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/sakajunquality/flow/gitbot"
+)
+
+// failed tells whether any of the envs failed
+func (prs PullRequests) failed() bool {
+	for _, pr := range prs {
+		if pr.err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// rollback closes the PRs opened for the event so that none of the envs is released,
+// the merged PRs can't be rolled back and are left as is
+func (f *Flow) rollback(ctx context.Context, app *Application, prs PullRequests) {
+	if f.DryRun {
+		return
+	}
+
+	var failed []string
+	for _, pr := range prs {
+		if pr.err != nil {
+			failed = append(failed, pr.env)
+		}
+	}
+	comment := fmt.Sprintf("Closed by Flow since the release to %v failed (atomic_release)", failed)
+
+	for i := range prs {
+		pr := &prs[i]
+		if pr.status != prCreated || pr.number == 0 {
+			continue
+		}
+		if pr.merge == gitbot.MergeMerged {
+			pr.rolledBack = "already merged, could not roll back"
+			continue
+		}
+
+		baseBranch := app.ManifestBaseBranch
+		if m := app.manifest(pr.env); m != nil && m.BaseBranch != "" {
+			baseBranch = m.BaseBranch
+		}
+		repo := gitbot.NewRepo(app.ManifestOwner, app.ManifestName, baseBranch)
+		repo.SetHTTPClient(f.httpClient)
+
+		unlock, err := lockRepo(ctx, repo.FullName())
+		if err == nil {
+			err = repo.ClosePullRequest(ctx, f.token(ctx), pr.number, comment)
+			unlock()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error rolling back %s: %s\n", pr.url, err)
+			pr.rolledBack = fmt.Sprintf("could not roll back: %s", err)
+			continue
+		}
+		pr.rolledBack = "rolled back"
+
+		// The version can be released again
+		if err := f.store.Unclaim(ctx, pr.key); err != nil {
+			fmt.Fprintf(os.Stderr, "Error unclaiming %s: %s\n", pr.key, err)
+		}
+	}
+}
+
+func (a *Application) manifest(env string) *Manifest {
+	targets := a.targets()
+	for i := range targets {
+		if targets[i].target() == env {
+			return &targets[i]
+		}
+	}
+	return nil
+}
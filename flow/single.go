@@ -0,0 +1,167 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/sakajunquality/flow/gitbot"
+)
+
+// Modes of the PRs of the envs of an app, see Application.PRMode
+const (
+	prModePerEnv = "per_env"
+	prModeSingle = "single"
+)
+
+// releaseSingle releases the envs of the app with a single PR reported as one result,
+// the envs which are held back or dry-run by force_dry_run are reported apart
+func (f *Flow) releaseSingle(ctx context.Context, app *Application, releases []batchedRelease) PullRequests {
+	var prs PullRequests
+	var claimed []batchedRelease
+	for _, r := range releases {
+		pr := f.releaseHeld(ctx, r.tag, r.version, app, r.manifest)
+		if pr == nil && r.manifest.ForceDryRun && !f.DryRun {
+			pr = f.forceDryRun(ctx, r.e, r.tag, r.version, app, r.manifest)
+		}
+		if pr != nil {
+			pr.channel = slackChannel(app, &r.manifest)
+			pr.version = r.version
+			prs = append(prs, *pr)
+			continue
+		}
+		claimed = append(claimed, r)
+	}
+	if len(claimed) == 0 {
+		return prs
+	}
+
+	var envs, locations []string
+	for _, r := range claimed {
+		envs = append(envs, r.manifest.target())
+		if location := r.manifest.location(); location != "" {
+			locations = append(locations, location)
+		}
+	}
+	versions := singleVersions(claimed)
+	pr := PullRequest{
+		env:      strings.Join(envs, ", "),
+		version:  versions,
+		location: strings.Join(locations, ", "),
+		status:   prFailed,
+		channel:  slackChannel(app, &claimed[0].manifest),
+	}
+
+	if !f.DryRun {
+		paused, err := f.checkOpenPRs(ctx, app, claimed[0].manifest)
+		if err != nil {
+			pr.err = err
+			return append(prs, pr)
+		}
+		if paused != "" {
+			pr.status, pr.skipped = prSkipped, fmt.Sprintf("%s %s", versions, paused)
+			return append(prs, pr)
+		}
+	}
+
+	// Another instance (or a redelivery) already released the versions, the envs are claimed together
+	var keys []string
+	if !f.DryRun {
+		key := fmt.Sprintf("%s/%s/%s", app.Name, strings.Join(envs, "+"), versions)
+		ok, err := f.store.Claim(ctx, key, currentConfig().claimTTL())
+		if err != nil {
+			pr.err = err
+			return append(prs, pr)
+		}
+		if !ok {
+			fmt.Fprintf(os.Stdout, "%s has already been released\n", key)
+			return prs
+		}
+		keys = append(keys, key)
+		pr.key = key
+	}
+
+	result, err := f.createSingleRelasePR(ctx, app, claimed)
+	if errors.Is(err, errUnchanged) {
+		f.completeClaims(ctx, keys)
+		pr.status, pr.skipped = prUnchanged, "already at "+versions
+		return append(prs, pr)
+	}
+	if err != nil {
+		f.unclaim(ctx, keys)
+		pr.err = err
+		return append(prs, pr)
+	}
+	f.completeClaims(ctx, keys)
+
+	if !f.DryRun {
+		for _, r := range claimed {
+			env := r.manifest.target()
+			if err := f.store.SetLastRelease(ctx, app.Name, env, r.version, f.now()); err != nil {
+				fmt.Fprintf(os.Stderr, "Error saving the release of %s %s %s: %s\n", app.Name, env, r.version, err)
+			}
+			f.audit(app.Name, env, r.version, result.URL)
+			f.watchMerge(ctx, app, r.manifest, r.version, result)
+		}
+	}
+
+	pr.status = prCreated
+	pr.url = result.URL
+	pr.merge = result.Merge
+	pr.mergeErr = result.MergeError
+	pr.amended = result.Amended
+	pr.reopened = result.Reopened
+	pr.number = result.Number
+	return append(prs, pr)
+}
+
+// createSingleRelasePR releases the envs of the app with a single PR
+func (f *Flow) createSingleRelasePR(ctx context.Context, app *Application, releases []batchedRelease) (*gitbot.Result, error) {
+	var body []string
+	for _, r := range releases {
+		body = append(body, fmt.Sprintf("- %s %s", r.manifest.target(), r.version))
+	}
+	if link := f.releaseLink(ctx, *app, releases[0].tag); link != "" {
+		body = append(body, "", link)
+	}
+
+	versions := singleVersions(releases)
+	branch := fmt.Sprintf("release/%s-%s", app.Name, versions)
+	subject := fmt.Sprintf("%s %s Release", app.Name, versions)
+	return f.createCombinedPR(ctx, releases, branch, subject, strings.Join(body, "\n"))
+}
+
+// singleVersions are the versions of the envs without duplicates, which are usually all the same
+func singleVersions(releases []batchedRelease) string {
+	var versions []string
+	seen := map[string]bool{}
+	for _, r := range releases {
+		if !seen[r.version] {
+			seen[r.version] = true
+			versions = append(versions, r.version)
+		}
+	}
+	sort.Strings(versions)
+	return strings.Join(versions, "-")
+}
+
+// validateSingle makes sure the envs of the app can be released with a single PR
+func (a *Application) validateSingle(c *Config) error {
+	if c.groupOf(a) != nil {
+		return fmt.Errorf("pr_mode single of %s can't be batched by an app group", a.Name)
+	}
+
+	targets := a.targets()
+	for _, m := range targets {
+		if a.baseBranch(m) != a.baseBranch(targets[0]) {
+			return fmt.Errorf("pr_mode single of %s needs the envs on the same base branch", a.Name)
+		}
+		if m.OpenPR == openPRAmend {
+			return fmt.Errorf("pr_mode single of %s can't amend the PRs of %s", a.Name, m.Env)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package flow
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+// slackPost is a message posted to the fake Slack API
+type slackPost struct {
+	Method  string
+	Channel string
+	Title   string
+	// Fields are the values of the attachment fields by title
+	Fields map[string]string
+}
+
+// slackServer fakes the Slack API, the messages are recorded instead of posted
+type slackServer struct {
+	server *httptest.Server
+	api    string
+
+	mu    sync.Mutex
+	posts []slackPost
+	// replies are the texts posted in the threads of the messages
+	replies []string
+}
+
+func newSlackServer() *slackServer {
+	s := &slackServer{api: slack.SLACK_API}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serve))
+	slack.SLACK_API = s.server.URL + "/"
+	return s
+}
+
+func (s *slackServer) Close() {
+	slack.SLACK_API = s.api
+	s.server.Close()
+}
+
+func (s *slackServer) serve(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	if r.PostForm.Get("thread_ts") != "" {
+		s.mu.Lock()
+		s.replies = append(s.replies, r.PostForm.Get("text"))
+		s.mu.Unlock()
+		s.ok(w)
+		return
+	}
+
+	post := slackPost{Method: r.URL.Path[1:], Channel: r.PostForm.Get("channel"), Fields: map[string]string{}}
+
+	var attachments []slack.Attachment
+	json.Unmarshal([]byte(r.PostForm.Get("attachments")), &attachments)
+	for _, a := range attachments {
+		post.Title = a.Title
+		for _, field := range a.Fields {
+			post.Fields[field.Title] = field.Value
+		}
+	}
+
+	s.mu.Lock()
+	s.posts = append(s.posts, post)
+	s.mu.Unlock()
+	s.ok(w)
+}
+
+func (s *slackServer) ok(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1500000000.000100"}`))
+}
+
+// Posts returns the messages posted since the last call
+func (s *slackServer) Posts() []slackPost {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	posts := s.posts
+	s.posts = nil
+	return posts
+}
+
+// Replies returns the texts posted in the threads since the last call
+func (s *slackServer) Replies() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	replies := s.replies
+	s.replies = nil
+	return replies
+}
+
+// newTestFlow is a Flow notifying the fake Slack, with the state in memory
+func newTestFlow() *Flow {
+	return &Flow{
+		notifier:        &slackNotifier{token: "slack-token"},
+		githubToken:     newRefreshingToken(StaticToken("github-token"), time.Hour),
+		store:           NewMemoryStore(),
+		resolver:        configResolver{},
+		classify:        DefaultStateClassifier,
+		releaseMessages: newReleaseMessages(),
+		openPRWarnings:  newFailureDeduper(openPRWarnInterval),
+		now:             time.Now,
+	}
+}
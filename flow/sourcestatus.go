@@ -0,0 +1,104 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/sakajunquality/flow/gitbot"
+)
+
+func (s SourceStatus) context() string {
+	if s.Context == "" {
+		return defaultSourceStatusContext
+	}
+	return s.Context
+}
+
+// commitSHA is the source commit of the build, empty when the build has none, e.g. of a manual build
+func (e Event) commitSHA() string {
+	if sha := e.Substitutions["COMMIT_SHA"]; sha != "" {
+		return sha
+	}
+	return e.SourceProvenance.ResolvedRepoSource.CommitSha
+}
+
+// postSourceStatus posts the outcome of the releases to the source commit, the releases are
+// done whatever happens to it so errors, e.g. of a token without the permission, are only logged
+func (f *Flow) postSourceStatus(ctx context.Context, e Event, app *Application, prs PullRequests) {
+	if app.SourceStatus == nil {
+		return
+	}
+	sha := e.commitSHA()
+	if sha == "" {
+		fmt.Fprintf(os.Stdout, "The build %s of %s has no commit, skipping the source status\n", e.ID, app.Name)
+		return
+	}
+
+	s := sourceStatusOf(e, prs)
+	s.Context = app.SourceStatus.context()
+	if e.BranchName != nil {
+		s.Branch = *e.BranchName
+	}
+
+	if f.DryRun {
+		fmt.Fprintf(os.Stdout, "dry-run: skipping the source status %s %s of %s\n", s.Context, s.State, sha)
+		return
+	}
+
+	repo := gitbot.NewRepo(app.SourceOwner, app.SourceName, "")
+	repo.SetHTTPClient(f.httpClient)
+
+	var err error
+	if app.SourceStatus.Target == sourceStatusCheckRun {
+		err = repo.CreateCheckRun(ctx, f.token(ctx), sha, s)
+	} else {
+		err = repo.SetCommitStatus(ctx, f.token(ctx), sha, s)
+	}
+	if errors.Is(err, gitbot.ErrUnauthorized) || errors.Is(err, gitbot.ErrNotFound) {
+		fmt.Fprintf(os.Stderr, "The token can't post the source status of %s, check its permissions: %s\n", app.Name, err)
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error posting the source status of %s: %s\n", app.Name, err)
+	}
+}
+
+// sourceStatusOf summarizes the releases, linking the PR when a single one was created
+func sourceStatusOf(e Event, prs PullRequests) gitbot.CommitStatus {
+	s := gitbot.CommitStatus{State: "success", TargetURL: e.LogURL}
+
+	var created, failed int
+	for _, pr := range prs {
+		switch {
+		case pr.err != nil:
+			failed++
+			s.Summary += fmt.Sprintf("- `%s` failed: %s\n", pr.env, pr.err)
+		case pr.status == prCreated:
+			created++
+			s.Summary += fmt.Sprintf("- `%s` %s\n", pr.env, pr.url)
+		default:
+			s.Summary += fmt.Sprintf("- `%s` %s\n", pr.env, pr.skipped)
+		}
+	}
+
+	switch {
+	case failed > 0:
+		s.State = "failure"
+		s.Description = fmt.Sprintf("%d of %d releases failed", failed, len(prs))
+	case created == 0:
+		s.Description = "nothing to release"
+	default:
+		s.Description = fmt.Sprintf("%d release PRs opened", created)
+	}
+
+	if created == 1 && failed == 0 {
+		for _, pr := range prs {
+			if pr.status == prCreated {
+				s.TargetURL = pr.url
+			}
+		}
+	}
+	return s
+}
@@ -0,0 +1,109 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	resultReleased     = "released"
+	resultBatched      = "batched"
+	resultDeployed     = "deployed"
+	resultBuildFailure = "build_failure"
+	resultError        = "error"
+	resultRolledBack   = "rolled_back"
+	resultIgnored      = "ignored"
+)
+
+// AppStatus is the result of the last event processed for the app
+type AppStatus struct {
+	App         string    `json:"app" firestore:"app"`
+	LastEventAt time.Time `json:"last_event_at,omitempty" firestore:"last_event_at"`
+	LastResult  string    `json:"last_result,omitempty" firestore:"last_result"`
+	// LastError is kept until the next error, the sensitive details are redacted
+	LastError   string    `json:"last_error,omitempty" firestore:"last_error"`
+	LastErrorAt time.Time `json:"last_error_at,omitempty" firestore:"last_error_at"`
+}
+
+// recordStatus saves the result of the event, failing to save it doesn't fail the event
+func (f *Flow) recordStatus(ctx context.Context, app *Application, result string, err error) {
+	if f.DryRun {
+		return
+	}
+
+	s, getErr := f.store.GetAppStatus(ctx, app.Name)
+	if getErr != nil {
+		fmt.Fprintf(os.Stderr, "Error getting the status of %s: %s\n", app.Name, getErr)
+		return
+	}
+	if s == nil {
+		s = &AppStatus{App: app.Name}
+	}
+
+	s.LastEventAt = time.Now()
+	s.LastResult = result
+	if err != nil {
+		s.LastError = f.redact(err.Error())
+		s.LastErrorAt = s.LastEventAt
+	}
+
+	if err := f.store.SetAppStatus(ctx, *s); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving the status of %s: %s\n", app.Name, err)
+	}
+}
+
+// releaseResult summarizes the PRs of the event, any failed env makes it an error
+func releaseResult(prs PullRequests) (string, error) {
+	var errs []string
+	result := resultError
+	for _, pr := range prs {
+		if pr.err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", pr.env, pr.err))
+		}
+		if pr.rolledBack != "" {
+			result = resultRolledBack
+		}
+	}
+	if len(errs) > 0 {
+		return result, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return resultReleased, nil
+}
+
+// Statuses returns the status of every configured app, in the order of the config
+func (f *Flow) Statuses(ctx context.Context) ([]AppStatus, error) {
+	var statuses []AppStatus
+	for _, app := range currentConfig().ApplicationList {
+		s, err := f.store.GetAppStatus(ctx, app.Name)
+		if err != nil {
+			return nil, err
+		}
+		if s == nil {
+			s = &AppStatus{App: app.Name}
+		}
+		statuses = append(statuses, *s)
+	}
+	return statuses, nil
+}
+
+// StatusHandler serves the status of every app as JSON
+func (f *Flow) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		statuses, err := f.Statuses(r.Context())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error getting the statuses: %s\n", err)
+			http.Error(w, "could not get the statuses", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(statuses); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing the statuses: %s\n", err)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/sakajunquality/flow/slackbot"
+)
+
+// updateStatusMessage edits the status message of the app with the last version of each env,
+// posting it when it's missing, see Application.StatusChannel
+func (f *Flow) updateStatusMessage(ctx context.Context, app *Application) {
+	if app.StatusChannel == "" || f.DryRun {
+		return
+	}
+
+	var text string
+	for _, m := range app.targets() {
+		version, err := f.store.GetLastRelease(ctx, app.Name, m.target())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error getting the last release of %s %s: %s\n", app.Name, m.target(), err)
+			return
+		}
+		if version == "" {
+			version = "not released yet"
+		}
+		text += fmt.Sprintf("`%s` %s\n", m.target(), version)
+	}
+
+	refs, err := f.store.GetStatusMessage(ctx, app.Name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error getting the status message of %s: %s\n", app.Name, err)
+		return
+	}
+
+	d := slackbot.MessageDetail{
+		IsSuccess: true,
+		AppName:   app.Name,
+		Body:      text,
+		Status:    fmt.Sprintf("updated at %s", f.now().Format("2006-01-02 15:04 MST")),
+	}
+	updated, err := f.notifiers().upsert(ctx, refs, app.StatusChannel, d)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error updating the status message of %s: %s\n", app.Name, err)
+	}
+
+	if err := f.store.SetStatusMessage(ctx, app.Name, updated); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving the status message of %s: %s\n", app.Name, err)
+	}
+}
+
+// bootstrapStatusMessages posts the status messages which are missing, and brings the others
+// up to date with the releases made while Flow wasn't running
+func (f *Flow) bootstrapStatusMessages(ctx context.Context) {
+	c := currentConfig()
+	for i := range c.ApplicationList {
+		f.updateStatusMessage(ctx, &c.ApplicationList[i])
+	}
+}
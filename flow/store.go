@@ -0,0 +1,307 @@
+package flow
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sakajunquality/flow/slackbot"
+)
+
+// Store keeps the deployment state shared between Flow instances
+type Store interface {
+	// Claim takes the key for this instance, it returns false when the key was already claimed.
+	// The claim is pending until it's completed, a pending claim older than the ttl is stale,
+	// e.g. of an instance which stopped meanwhile, and is claimed again (0 never expires it).
+	Claim(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	// CompleteClaim keeps the claim for good once its work is done
+	CompleteClaim(ctx context.Context, key string) error
+	// Unclaim frees the key so the work can be retried
+	Unclaim(ctx context.Context, key string) error
+
+	SetLastRelease(ctx context.Context, app, env, version string, releasedAt time.Time) error
+	// GetLastRelease returns an empty version when nothing was released yet
+	GetLastRelease(ctx context.Context, app, env string) (string, error)
+	// GetLastReleaseAt returns the zero time when nothing was released yet
+	GetLastReleaseAt(ctx context.Context, app, env string) (time.Time, error)
+	// Releases returns the releases saved by SetLastRelease from since until until, oldest first
+	Releases(ctx context.Context, since, until time.Time) ([]ReleaseRecord, error)
+
+	// SetPin pins the env at the version, an empty version clears the pin
+	SetPin(ctx context.Context, app, env, version string) error
+	GetPin(ctx context.Context, app, env string) (string, error)
+
+	// SetStatusMessage saves the references of the status message of the app, see Application.StatusChannel
+	SetStatusMessage(ctx context.Context, app string, refs []slackbot.MessageRef) error
+	// GetStatusMessage returns nil when the status message of the app wasn't posted yet
+	GetStatusMessage(ctx context.Context, app string) ([]slackbot.MessageRef, error)
+
+	SetAppStatus(ctx context.Context, status AppStatus) error
+	// GetAppStatus returns nil when no event of the app was processed yet
+	GetAppStatus(ctx context.Context, app string) (*AppStatus, error)
+
+	// MarkBuildProcessed records the Cloud Build ID until the ttl has passed
+	MarkBuildProcessed(ctx context.Context, buildID string, ttl time.Duration) error
+	IsBuildProcessed(ctx context.Context, buildID string) (bool, error)
+
+	// AddAttempt records the failed attempt of the build and returns the errors of all its attempts
+	AddAttempt(ctx context.Context, buildID, errorMessage string) ([]string, error)
+	// ClearAttempts forgets the attempts of the build
+	ClearAttempts(ctx context.Context, buildID string) error
+
+	// AcquireLease takes the key for the holder until it's released or the ttl has passed, it returns
+	// false while another holder has it. The holder extends its lease by acquiring it again.
+	AcquireLease(ctx context.Context, key, holder string, ttl time.Duration) (bool, error)
+	// ReleaseLease frees the key unless another holder has taken it since
+	ReleaseLease(ctx context.Context, key, holder string) error
+}
+
+// ReleaseRecord is a release saved by SetLastRelease
+type ReleaseRecord struct {
+	App        string
+	Env        string
+	Version    string
+	ReleasedAt time.Time
+}
+
+// releaseHistoryRetention keeps the releases of the memory store for a weekly digest
+const releaseHistoryRetention = 8 * 24 * time.Hour
+
+// memoryClaim is a claim of the memory store, see Store.Claim
+type memoryClaim struct {
+	claimedAt time.Time
+	pending   bool
+}
+
+type memoryLease struct {
+	holder    string
+	expiresAt time.Time
+}
+
+type memoryStore struct {
+	mu       sync.Mutex
+	claims   map[string]memoryClaim
+	releases map[string]string
+	// releasedAt are the times of the last releases
+	releasedAt map[string]time.Time
+	// history are the releases within releaseHistoryRetention, oldest first
+	history  []ReleaseRecord
+	pins     map[string]string
+	statuses map[string]AppStatus
+	// statusMessages are the references of the status messages of the apps
+	statusMessages map[string][]slackbot.MessageRef
+	// builds are the expiry of the processed builds
+	builds map[string]time.Time
+	// attempts are the errors of the failed attempts of the builds
+	attempts map[string][]string
+	// leases are the held leases by key
+	leases map[string]memoryLease
+}
+
+// NewMemoryStore returns a Store which is only safe for a single instance
+func NewMemoryStore() Store {
+	return &memoryStore{
+		claims:         map[string]memoryClaim{},
+		releases:       map[string]string{},
+		releasedAt:     map[string]time.Time{},
+		pins:           map[string]string{},
+		statuses:       map[string]AppStatus{},
+		statusMessages: map[string][]slackbot.MessageRef{},
+		builds:         map[string]time.Time{},
+		attempts:       map[string][]string{},
+		leases:         map[string]memoryLease{},
+	}
+}
+
+func (s *memoryStore) Claim(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if c, ok := s.claims[key]; ok && !c.stale(now, ttl) {
+		return false, nil
+	}
+	s.claims[key] = memoryClaim{claimedAt: now, pending: true}
+	return true, nil
+}
+
+func (s *memoryStore) CompleteClaim(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c, ok := s.claims[key]; ok {
+		c.pending = false
+		s.claims[key] = c
+	}
+	return nil
+}
+
+// stale tells whether the claim is pending for longer than the ttl
+func (c memoryClaim) stale(now time.Time, ttl time.Duration) bool {
+	return c.pending && ttl > 0 && now.Sub(c.claimedAt) >= ttl
+}
+
+func (s *memoryStore) Unclaim(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.claims, key)
+	return nil
+}
+
+func (s *memoryStore) SetLastRelease(ctx context.Context, app, env, version string, releasedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.releases[app+"/"+env] = version
+	s.releasedAt[app+"/"+env] = releasedAt
+
+	history := s.history[:0]
+	for _, r := range s.history {
+		if releasedAt.Sub(r.ReleasedAt) < releaseHistoryRetention {
+			history = append(history, r)
+		}
+	}
+	s.history = append(history, ReleaseRecord{App: app, Env: env, Version: version, ReleasedAt: releasedAt})
+	return nil
+}
+
+func (s *memoryStore) GetLastRelease(ctx context.Context, app, env string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.releases[app+"/"+env], nil
+}
+
+func (s *memoryStore) GetLastReleaseAt(ctx context.Context, app, env string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.releasedAt[app+"/"+env], nil
+}
+
+func (s *memoryStore) Releases(ctx context.Context, since, until time.Time) ([]ReleaseRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var records []ReleaseRecord
+	for _, r := range s.history {
+		if !r.ReleasedAt.Before(since) && r.ReleasedAt.Before(until) {
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
+
+func (s *memoryStore) SetPin(ctx context.Context, app, env, version string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if version == "" {
+		delete(s.pins, app+"/"+env)
+		return nil
+	}
+	s.pins[app+"/"+env] = version
+	return nil
+}
+
+func (s *memoryStore) GetPin(ctx context.Context, app, env string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.pins[app+"/"+env], nil
+}
+
+func (s *memoryStore) SetStatusMessage(ctx context.Context, app string, refs []slackbot.MessageRef) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.statusMessages[app] = append([]slackbot.MessageRef(nil), refs...)
+	return nil
+}
+
+func (s *memoryStore) GetStatusMessage(ctx context.Context, app string) ([]slackbot.MessageRef, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]slackbot.MessageRef(nil), s.statusMessages[app]...), nil
+}
+
+func (s *memoryStore) SetAppStatus(ctx context.Context, status AppStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.statuses[status.App] = status
+	return nil
+}
+
+func (s *memoryStore) GetAppStatus(ctx context.Context, app string) (*AppStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status, ok := s.statuses[app]
+	if !ok {
+		return nil, nil
+	}
+	return &status, nil
+}
+
+func (s *memoryStore) MarkBuildProcessed(ctx context.Context, buildID string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, expiry := range s.builds {
+		if now.After(expiry) {
+			delete(s.builds, id)
+		}
+	}
+	s.builds[buildID] = now.Add(ttl)
+	return nil
+}
+
+func (s *memoryStore) IsBuildProcessed(ctx context.Context, buildID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiry, ok := s.builds[buildID]
+	return ok && time.Now().Before(expiry), nil
+}
+
+func (s *memoryStore) AddAttempt(ctx context.Context, buildID, errorMessage string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attempts[buildID] = append(s.attempts[buildID], errorMessage)
+	return append([]string(nil), s.attempts[buildID]...), nil
+}
+
+func (s *memoryStore) ClearAttempts(ctx context.Context, buildID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, buildID)
+	return nil
+}
+
+func (s *memoryStore) AcquireLease(ctx context.Context, key, holder string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if l, ok := s.leases[key]; ok && l.holder != holder && now.Before(l.expiresAt) {
+		return false, nil
+	}
+	s.leases[key] = memoryLease{holder: holder, expiresAt: now.Add(ttl)}
+	return true, nil
+}
+
+func (s *memoryStore) ReleaseLease(ctx context.Context, key, holder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.leases[key].holder == holder {
+		delete(s.leases, key)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testStore runs the claims, the leases and the releases against the store, the keys are prefixed
+// so that a persistent store can be tested again
+func testStore(t *testing.T, s Store, prefix string) {
+	ctx := context.Background()
+	ttl := 50 * time.Millisecond
+
+	claims := []struct {
+		name string
+		do   func(key string) (bool, error)
+		want bool
+	}{
+		{"first claim", func(key string) (bool, error) { return s.Claim(ctx, key, 0) }, true},
+		{"claimed", func(key string) (bool, error) { return s.Claim(ctx, key, 0) }, false},
+		{"unclaimed", func(key string) (bool, error) {
+			if err := s.Unclaim(ctx, key); err != nil {
+				return false, err
+			}
+			return s.Claim(ctx, key, ttl)
+		}, true},
+		{"pending within the ttl", func(key string) (bool, error) { return s.Claim(ctx, key, ttl) }, false},
+		{"stale pending", func(key string) (bool, error) {
+			time.Sleep(2 * ttl)
+			return s.Claim(ctx, key, ttl)
+		}, true},
+		{"completed", func(key string) (bool, error) {
+			if err := s.CompleteClaim(ctx, key); err != nil {
+				return false, err
+			}
+			time.Sleep(2 * ttl)
+			return s.Claim(ctx, key, ttl)
+		}, false},
+	}
+	key := prefix + "app/prod/v1.0.0"
+	for _, tt := range claims {
+		got, err := tt.do(key)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: claimed %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	leases := []struct {
+		name string
+		do   func(key string) (bool, error)
+		want bool
+	}{
+		{"first lease", func(key string) (bool, error) { return s.AcquireLease(ctx, key, "a", ttl) }, true},
+		{"held", func(key string) (bool, error) { return s.AcquireLease(ctx, key, "b", ttl) }, false},
+		{"renewed", func(key string) (bool, error) { return s.AcquireLease(ctx, key, "a", ttl) }, true},
+		{"released by another holder", func(key string) (bool, error) {
+			if err := s.ReleaseLease(ctx, key, "b"); err != nil {
+				return false, err
+			}
+			return s.AcquireLease(ctx, key, "b", ttl)
+		}, false},
+		{"expired", func(key string) (bool, error) {
+			time.Sleep(2 * ttl)
+			return s.AcquireLease(ctx, key, "b", ttl)
+		}, true},
+		{"released by the expired holder", func(key string) (bool, error) {
+			if err := s.ReleaseLease(ctx, key, "a"); err != nil {
+				return false, err
+			}
+			return s.AcquireLease(ctx, key, "a", ttl)
+		}, false},
+		{"released", func(key string) (bool, error) {
+			if err := s.ReleaseLease(ctx, key, "b"); err != nil {
+				return false, err
+			}
+			return s.AcquireLease(ctx, key, "a", ttl)
+		}, true},
+	}
+	key = prefix + "lease/app/app"
+	for _, tt := range leases {
+		got, err := tt.do(key)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: acquired %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	app := prefix + "app"
+	at := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	releases := []ReleaseRecord{
+		{App: app, Env: "dev", Version: "v1.0.0", ReleasedAt: at},
+		{App: app, Env: "prod", Version: "v1.0.0", ReleasedAt: at.Add(time.Minute)},
+		{App: app, Env: "dev", Version: "v1.1.0", ReleasedAt: at.Add(2 * time.Minute)},
+	}
+	for _, r := range releases {
+		if err := s.SetLastRelease(ctx, r.App, r.Env, r.Version, r.ReleasedAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	last := []struct {
+		env     string
+		version string
+		at      time.Time
+	}{
+		{"dev", "v1.1.0", at.Add(2 * time.Minute)},
+		{"prod", "v1.0.0", at.Add(time.Minute)},
+		{"staging", "", time.Time{}},
+	}
+	for _, tt := range last {
+		version, err := s.GetLastRelease(ctx, app, tt.env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		releasedAt, err := s.GetLastReleaseAt(ctx, app, tt.env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version != tt.version || !releasedAt.Equal(tt.at) {
+			t.Errorf("last release of %s = %s at %s, want %s at %s", tt.env, version, releasedAt, tt.version, tt.at)
+		}
+	}
+
+	records, err := s.Releases(ctx, at, at.Add(2*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []ReleaseRecord
+	for _, r := range records {
+		if r.App == app {
+			r.ReleasedAt = r.ReleasedAt.In(at.Location())
+			got = append(got, r)
+		}
+	}
+	if !reflect.DeepEqual(got, releases[:2]) {
+		t.Errorf("releases = %+v, want %+v", got, releases[:2])
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore(), "")
+}
+
+// TestFirestoreStore runs against the emulator, e.g. gcloud beta emulators firestore start --host-port=localhost:8081
+func TestFirestoreStore(t *testing.T) {
+	if os.Getenv("FIRESTORE_EMULATOR_HOST") == "" {
+		t.Skip("FIRESTORE_EMULATOR_HOST is not set")
+	}
+
+	s, err := NewFirestoreStore(context.Background(), "flow-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s, fmt.Sprintf("%d/", time.Now().UnixNano()))
+}
@@ -3,62 +3,134 @@ package flow
 import (
 	"context"
 	"fmt"
-	"log"
 	"os"
-	"sync"
 
 	"cloud.google.com/go/pubsub"
-	"github.com/sakajunquality/cloud-pubsub-events/cloudbuildevent"
 )
 
-var (
-	mu     sync.Mutex
-	killCh chan bool
-)
+// subscribe receives events until receiveCtx is canceled by Stop. The events are processed
+// on processCtx so that Stop can let them finish instead of aborting them right away.
+func (f *Flow) subscribe(receiveCtx, processCtx context.Context, errCh chan error) {
+	defer close(f.stopped)
 
-func (f *Flow) subscribe(ctx context.Context, errCh chan error) {
-	killCh := make(chan bool, 2)
+	s := currentConfig().Subscriber
+	subscription.ReceiveSettings.MaxOutstandingMessages = s.MaxOutstandingMessages
+	subscription.ReceiveSettings.NumGoroutines = s.NumGoroutines
 
-	for {
-		select {
-		case <-ctx.Done():
-			errCh <- ctx.Err()
-		default:
+	// Receive returns once all the callbacks have returned
+	err := subscription.Receive(receiveCtx, func(_ context.Context, msg *pubsub.Message) {
+		e, err := ParseEvent(msg.Data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: could not decode message data: %#v", msg)
+			msg.Ack()
+			return
 		}
 
-		if len(killCh) > 0 {
-			break
+		if !f.handleEvent(receiveCtx, processCtx, e, msg) {
+			msg.Nack()
+			return
 		}
 
-		err := subscription.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
-			e, err := cloudbuildevent.ParseMessage(msg.Data)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error: could not decode message data: %#v", msg)
-				msg.Ack()
-				return
-			}
+		// The batched releases of the event are only kept in memory, it's acked once they're released
+		select {
+		case <-f.batcher.released(e.ID):
+		case <-processCtx.Done():
+		}
+		if processCtx.Err() != nil {
+			fmt.Fprintf(os.Stderr, "Error: the batched releases were aborted by shutdown, nacking event %s\n", e.ID)
+			msg.Nack()
+			return
+		}
+		msg.Ack()
+	})
 
-			fmt.Fprintf(os.Stdout, "Processing event: %#v\n", e)
+	errCh <- err
+}
 
-			mu.Lock()
-			defer mu.Unlock()
+// handleEvent processes the event in the order of its apps, false means it's to be redelivered
+func (f *Flow) handleEvent(receiveCtx, processCtx context.Context, e Event, msg *pubsub.Message) bool {
+	defer lock(f.eventApps(processCtx, e)...)()
 
-			if err := f.process(ctx, e); err != nil {
-				fmt.Fprintf(os.Stderr, "Error: cloud not process event: %s\n", err)
+	// Stopped while waiting for the other events, leave it to the next instance
+	if receiveCtx.Err() != nil {
+		return false
+	}
 
-				msg.Ack()
-				return
-			}
-			msg.Ack()
-		})
+	fmt.Fprintf(os.Stdout, "Processing event: %#v\n", e)
 
-		if err != nil {
-			log.Fatal(err)
-		}
+	prs, err := f.process(processCtx, e)
+	if f.JSONResults && err == nil {
+		printResult(f.newEventResult(e, prs))
+	}
+
+	// Aborted by the shutdown deadline, redeliver it
+	if processCtx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "Error: processing was aborted by shutdown, nacking event %s\n", e.ID)
+		return false
+	}
+
+	// The results are published once, the redelivered events are published by their last attempt
+	if retryable(err) && f.giveUp(processCtx, e, msg, err) {
+		f.publishResult(processCtx, e, prs, err)
+		return true
+	}
+	if retryable(err) {
+		fmt.Fprintf(os.Stderr, "Error: cloud not process event, nacking it: %s\n", err)
+		return false
+	}
+	f.clearAttempts(processCtx, e)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: cloud not process event: %s\n", err)
+	}
+	f.publishResult(processCtx, e, prs, err)
+	return true
+}
+
+// eventApps are the apps the event is ordered by, the events of unknown apps are ordered together
+func (f *Flow) eventApps(ctx context.Context, e Event) []string {
+	apps, err := f.resolver.Resolve(ctx, e)
+	if err != nil || len(apps) == 0 {
+		return []string{""}
+	}
+
+	var names []string
+	for _, app := range apps {
+		names = append(names, app.Name)
 	}
-	errCh <- nil
+	return names
 }
 
+// Stop stops receiving events and waits for the events being processed until ctx is done,
+// then aborts them so that they are redelivered. The pending batches are released right away,
+// before the deadline can abort them, and the audit log is written.
 func (f *Flow) Stop(ctx context.Context) {
-	killCh <- true
+	if f.cancelReceive == nil {
+		return
+	}
+	f.cancelReceive()
+
+	// The events of the batches are waiting for them to be acked
+	flushed := make(chan struct{})
+	go func() {
+		f.batcher.flushAll()
+		close(flushed)
+	}()
+
+	select {
+	case <-f.stopped:
+	case <-ctx.Done():
+		f.cancelProcess()
+		<-f.stopped
+	}
+
+	<-flushed
+	if f.resultTopic != nil {
+		// Waits for the results being published
+		f.resultTopic.Stop()
+	}
+	if f.auditLog != nil {
+		f.auditLog.close()
+	}
+	// Stops the background work of the events, e.g. the PRs polled for their post_merge hooks
+	f.cancelProcess()
 }
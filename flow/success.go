@@ -0,0 +1,77 @@
+package flow
+
+import (
+	"fmt"
+	"os"
+)
+
+// Statuses of the builds and the steps which BuildSuccess tells apart
+const (
+	buildStatusSuccess  = "SUCCESS"
+	buildStatusFailure  = "FAILURE"
+	buildStatusTimeout  = "TIMEOUT"
+	buildStatusInternal = "INTERNAL_ERROR"
+)
+
+// succeeded tells whether the build counts as a success: the required steps must succeed, and a
+// failed build still succeeds when some steps failed and all of them are optional. The steps which
+// didn't run, e.g. the ones cancelled by the failure, don't count.
+func (s BuildSuccess) succeeded(e Event) bool {
+	ok := e.IsSuuccess()
+	if !ok && e.Status == buildStatusFailure && len(s.OptionalSteps) > 0 {
+		failed := 0
+		optional := 0
+		for _, step := range e.Steps {
+			if !stepFailed(step.Status) {
+				continue
+			}
+			failed++
+			if s.optional(step.ID) {
+				optional++
+			}
+		}
+		ok = failed > 0 && failed == optional
+	}
+
+	for _, id := range s.RequiredSteps {
+		if status := stepStatus(e, id); status != buildStatusSuccess {
+			fmt.Fprintf(os.Stdout, "The required step %s of the build %s is %q\n", id, e.ID, status)
+			ok = false
+		}
+	}
+	return ok
+}
+
+func (s BuildSuccess) optional(id string) bool {
+	for _, optional := range s.OptionalSteps {
+		if optional == id {
+			return true
+		}
+	}
+	return false
+}
+
+func stepFailed(status string) bool {
+	return status == buildStatusFailure || status == buildStatusTimeout || status == buildStatusInternal
+}
+
+// stepStatus is the status of the step, empty when the build has no such step
+func stepStatus(e Event, id string) string {
+	for _, step := range e.Steps {
+		if step.ID == id {
+			return step.Status
+		}
+	}
+	return ""
+}
+
+// classifyApp applies the success criteria of the app to the state of the finished builds
+func (a *Application) classifyApp(e Event, state State) State {
+	if a.BuildSuccess == nil || (state != StateSuccess && state != StateFailure) {
+		return state
+	}
+	if a.BuildSuccess.succeeded(e) {
+		return StateSuccess
+	}
+	return StateFailure
+}
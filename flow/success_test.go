@@ -0,0 +1,62 @@
+package flow
+
+import "testing"
+
+// stepsEvent is a finished build of the status with the steps as id:status
+func stepsEvent(status string, steps ...[2]string) Event {
+	e := Event{}
+	e.Status = status
+	for _, s := range steps {
+		step := BuildStep{ID: s[0]}
+		step.Status = s[1]
+		e.Steps = append(e.Steps, step)
+	}
+	return e
+}
+
+func TestBuildSuccessSucceeded(t *testing.T) {
+	s := BuildSuccess{RequiredSteps: []string{"migrate"}, OptionalSteps: []string{"lint", "e2e"}}
+
+	tests := []struct {
+		name  string
+		event Event
+		want  bool
+	}{
+		{"all succeeded", stepsEvent("SUCCESS", [2]string{"migrate", "SUCCESS"}, [2]string{"lint", "SUCCESS"}), true},
+		{"required failed in a successful build", stepsEvent("SUCCESS", [2]string{"migrate", "FAILURE"}, [2]string{"lint", "SUCCESS"}), false},
+		{"required missing", stepsEvent("SUCCESS", [2]string{"lint", "SUCCESS"}), false},
+		{"optional failed", stepsEvent("FAILURE", [2]string{"migrate", "SUCCESS"}, [2]string{"lint", "FAILURE"}), true},
+		{"optional timed out", stepsEvent("FAILURE", [2]string{"migrate", "SUCCESS"}, [2]string{"e2e", "TIMEOUT"}), true},
+		{"optional failed and the rest cancelled", stepsEvent("FAILURE", [2]string{"migrate", "SUCCESS"}, [2]string{"lint", "FAILURE"}, [2]string{"build", "CANCELLED"}), true},
+		{"optional and another failed", stepsEvent("FAILURE", [2]string{"migrate", "SUCCESS"}, [2]string{"lint", "FAILURE"}, [2]string{"build", "FAILURE"}), false},
+		{"no step failed", stepsEvent("FAILURE", [2]string{"migrate", "SUCCESS"}, [2]string{"lint", "SUCCESS"}), false},
+		{"optional failed and required failed", stepsEvent("FAILURE", [2]string{"migrate", "FAILURE"}, [2]string{"lint", "FAILURE"}), false},
+		{"timed out build", stepsEvent("TIMEOUT", [2]string{"migrate", "SUCCESS"}, [2]string{"lint", "FAILURE"}), false},
+	}
+	for _, tt := range tests {
+		if got := s.succeeded(tt.event); got != tt.want {
+			t.Errorf("%s: succeeded = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyApp(t *testing.T) {
+	optional := &Application{BuildSuccess: &BuildSuccess{OptionalSteps: []string{"lint"}}}
+	failed := stepsEvent("FAILURE", [2]string{"lint", "FAILURE"})
+
+	tests := []struct {
+		name  string
+		app   *Application
+		state State
+		want  State
+	}{
+		{"without build_success", &Application{}, StateFailure, StateFailure},
+		{"optional step failed", optional, StateFailure, StateSuccess},
+		{"not finished", optional, StateIgnore, StateIgnore},
+	}
+	for _, tt := range tests {
+		if got := tt.app.classifyApp(failed, tt.state); got != tt.want {
+			t.Errorf("%s: classifyApp = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
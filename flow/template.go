@@ -0,0 +1,195 @@
+package flow
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/sakajunquality/flow/gitbot"
+)
+
+// prBodyData is what the PRBody templates of the config, the apps and the manifests render from
+type prBodyData struct {
+	App           string
+	Env           string
+	Version       string
+	Substitutions map[string]string
+}
+
+// imageRefData is what Application.ImageRefTemplate renders from
+type imageRefData struct {
+	Image  string
+	Tag    string
+	Digest string
+}
+
+// bootstrapData is what Bootstrap.Block renders from
+type bootstrapData struct {
+	App     string
+	Env     string
+	Version string
+	Image   string
+}
+
+// filePathData is what the file paths of the manifests render from
+type filePathData struct {
+	App string
+	Env string
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=zero").Parse(text)
+}
+
+func renderTemplate(name, text string, data interface{}) (string, error) {
+	tmpl, err := parseTemplate(name, text)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// prBodySeparator delimits the sections of the PR body
+const prBodySeparator = "\n\n---\n\n"
+
+// prBodySections renders the PRBody of the config, the app and the manifest in this order,
+// the empty ones are left out
+func prBodySections(a Application, m Manifest, data prBodyData) (string, error) {
+	var sections []string
+	for _, text := range []string{currentConfig().PRBody, a.PRBody, m.PRBody} {
+		if text == "" {
+			continue
+		}
+		section, err := renderTemplate("pr_body", text, data)
+		if err != nil {
+			return "", err
+		}
+		if section = strings.TrimSpace(section); section != "" {
+			sections = append(sections, section)
+		}
+	}
+	return strings.Join(sections, prBodySeparator), nil
+}
+
+// files renders the file paths of the manifest, which fall back to the ones of the app
+func (m Manifest) files(a Application) ([]string, error) {
+	return m.allowedFiles(a, currentConfig().allowedFiles())
+}
+
+// allowedFiles renders the file paths of the manifest, refusing the ones not matching allowed
+func (m Manifest) allowedFiles(a Application, allowed []string) ([]string, error) {
+	files := m.Files
+	if len(files) == 0 {
+		files = a.Files
+	}
+
+	var paths []string
+	for _, f := range files {
+		p, err := renderTemplate("files", f, filePathData{App: a.Name, Env: m.Env})
+		if err != nil {
+			return nil, err
+		}
+		if err := validateFilePath(p); err != nil {
+			return nil, err
+		}
+		if !fileAllowed(allowed, p) {
+			return nil, fmt.Errorf("%s of %s %s does not match allowed_files %s, refusing to edit it", p, a.Name, m.Env, strings.Join(allowed, ", "))
+		}
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
+// markerFile renders the path and the content of the marker file of the manifest
+func (a Application) markerFile(m Manifest, version string, substitutions map[string]string) (string, string, error) {
+	p, err := renderTemplate("marker", a.Marker.Path, filePathData{App: a.Name, Env: m.Env})
+	if err != nil {
+		return "", "", err
+	}
+	if err := validateFilePath(p); err != nil {
+		return "", "", err
+	}
+	if allowed := currentConfig().allowedFiles(); !fileAllowed(allowed, p) {
+		return "", "", fmt.Errorf("marker %s of %s %s does not match allowed_files %s, refusing to write it", p, a.Name, m.Env, strings.Join(allowed, ", "))
+	}
+
+	content, err := renderTemplate("marker", a.Marker.Content, prBodyData{
+		App:           a.Name,
+		Env:           m.Env,
+		Version:       version,
+		Substitutions: substitutions,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return p, content, nil
+}
+
+// imageRef renders the reference written to the manifests, which defaults to
+// image:tag, or image@digest when pinned by digest
+func (a Application) imageRef(tag, digest string, byDigest bool) (string, error) {
+	if a.ImageRefTemplate == "" {
+		if byDigest {
+			return a.ImageName + "@" + digest, nil
+		}
+		return a.ImageName + ":" + tag, nil
+	}
+
+	ref, err := renderTemplate("image_ref_template", a.ImageRefTemplate, imageRefData{
+		Image:  a.ImageName,
+		Tag:    tag,
+		Digest: digest,
+	})
+	if err != nil {
+		return "", err
+	}
+	if ref == "" {
+		return "", fmt.Errorf("image_ref_template of %s rendered an empty reference", a.Name)
+	}
+	return ref, nil
+}
+
+// bootstrapUpdater inserts the rendered block of the manifest
+func bootstrapUpdater(version, imageRef string, a Application, m Manifest) (gitbot.Updater, error) {
+	block, err := renderTemplate("bootstrap", m.Bootstrap.Block, bootstrapData{
+		App:     a.Name,
+		Env:     m.Env,
+		Version: version,
+		Image:   imageRef,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return gitbot.NewInsertUpdater(m.Bootstrap.After, block)
+}
+
+// fileAllowed matches the path and its base name against the allowed_files
+func fileAllowed(allowed []string, p string) bool {
+	for _, pattern := range allowed {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(p)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// validateFilePath accepts only clean paths relative to the root of the repository
+func validateFilePath(p string) error {
+	if p == "" || path.IsAbs(p) || path.Clean(p) != p || p == ".." || strings.HasPrefix(p, "../") {
+		return fmt.Errorf("%q is not a clean path relative to the repository", p)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package flow
+
+import "testing"
+
+func TestFileAllowed(t *testing.T) {
+	tests := []struct {
+		allowed []string
+		path    string
+		want    bool
+	}{
+		{defaultAllowedFiles, "dev/deployment.yaml", true},
+		{defaultAllowedFiles, "dev/deployment.yml", true},
+		{defaultAllowedFiles, "README.md", false},
+		{defaultAllowedFiles, "dev/README.md", false},
+		{defaultAllowedFiles, "dev/deployment.yaml.md", false},
+		{[]string{"overlays/*/*.yaml"}, "overlays/dev/kustomization.yaml", true},
+		{[]string{"overlays/*/*.yaml"}, "overlays/dev/NOTES.md", false},
+		{[]string{"*.yaml", "*.md"}, "dev/README.md", true},
+		{nil, "dev/deployment.yaml", false},
+	}
+	for _, tt := range tests {
+		if got := fileAllowed(tt.allowed, tt.path); got != tt.want {
+			t.Errorf("fileAllowed(%q, %q) = %v, want %v", tt.allowed, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestAllowedFiles(t *testing.T) {
+	app := Application{Name: "app", Files: []string{"{{ .Env }}/deployment.yaml"}}
+
+	tests := []struct {
+		name    string
+		files   []string
+		allowed []string
+		want    []string
+		wantErr bool
+	}{
+		{"app files", nil, defaultAllowedFiles, []string{"dev/deployment.yaml"}, false},
+		{"manifest files", []string{"{{ .Env }}/service.yml"}, defaultAllowedFiles, []string{"dev/service.yml"}, false},
+		{"markdown", []string{"{{ .Env }}/deployment.yaml", "{{ .Env }}/README.md"}, defaultAllowedFiles, nil, true},
+		{"markdown allowed", []string{"{{ .Env }}/README.md"}, []string{"*.md"}, []string{"dev/README.md"}, false},
+		{"unclean", []string{"../{{ .Env }}/deployment.yaml"}, defaultAllowedFiles, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := Manifest{Env: "dev", Files: tt.files}.allowedFiles(app, tt.allowed)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+			}
+		}
+	}
+}
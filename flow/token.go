@@ -0,0 +1,150 @@
+package flow
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2/google"
+)
+
+const defaultTokenRefresh = 5 * time.Minute
+
+// TokenProvider returns the current token, which may be rotated while Flow runs
+type TokenProvider interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticToken never changes
+type StaticToken string
+
+func (t StaticToken) Token(ctx context.Context) (string, error) {
+	return string(t), nil
+}
+
+// FileToken reads the token from the file, e.g. a mounted Kubernetes secret
+type FileToken string
+
+func (t FileToken) Token(ctx context.Context) (string, error) {
+	b, err := ioutil.ReadFile(string(t))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// SecretManagerToken reads the secret version like projects/p/secrets/s/versions/latest
+// with the default credentials
+type SecretManagerToken string
+
+func (t SecretManagerToken) Token(ctx context.Context) (string, error) {
+	client, err := google.DefaultClient(ctx, "https://www.googleapis.com/auth/cloud-platform")
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := client.Get(fmt.Sprintf("https://secretmanager.googleapis.com/v1/%s:access", string(t)))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("secret manager responded %s", resp.Status)
+	}
+
+	var secret struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(secret.Payload.Data)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// refreshingToken caches the token of the provider for the interval. When the refresh fails
+// the last known-good token keeps being used.
+type refreshingToken struct {
+	provider  TokenProvider
+	interval  time.Duration
+	mu        sync.Mutex
+	token     string
+	fetchedAt time.Time
+}
+
+func newRefreshingToken(p TokenProvider, interval time.Duration) *refreshingToken {
+	return &refreshingToken{provider: p, interval: interval}
+}
+
+func (t *refreshingToken) Token(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.token != "" && time.Since(t.fetchedAt) < t.interval {
+		return t.token, nil
+	}
+
+	token, err := t.provider.Token(ctx)
+	if err == nil && token == "" {
+		err = errors.New("the token is empty")
+	}
+	if err != nil {
+		if t.token == "" {
+			return "", err
+		}
+		fmt.Fprintf(os.Stderr, "Error refreshing the token, using the last one: %s\n", err)
+		// Retried on the next interval instead of on every call
+		t.fetchedAt = time.Now()
+		return t.token, nil
+	}
+
+	t.token = token
+	t.fetchedAt = time.Now()
+	return t.token, nil
+}
+
+// cached returns the last token without refreshing it
+func (t *refreshingToken) cached() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.token
+}
+
+// githubTokenProvider reads FLOW_GITHUB_TOKEN, FLOW_GITHUB_TOKEN_FILE or FLOW_GITHUB_TOKEN_SECRET,
+// nil when none of them is set
+func githubTokenProvider() TokenProvider {
+	if token := os.Getenv("FLOW_GITHUB_TOKEN"); token != "" {
+		return StaticToken(token)
+	}
+	if path := os.Getenv("FLOW_GITHUB_TOKEN_FILE"); path != "" {
+		return FileToken(path)
+	}
+	if name := os.Getenv("FLOW_GITHUB_TOKEN_SECRET"); name != "" {
+		return SecretManagerToken(name)
+	}
+	return nil
+}
+
+// token returns the current GitHub token, an empty one fails the calls to GitHub with unauthorized
+func (f *Flow) token(ctx context.Context) string {
+	token, err := f.githubToken.Token(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error getting the GitHub token: %s\n", err)
+	}
+	return token
+}
@@ -0,0 +1,160 @@
+package flow
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// tagCharacters are the characters allowed in a Docker tag
+var tagCharacters = regexp.MustCompile(`^[A-Za-z0-9_.-]*$`)
+
+// VersionTransform strips a prefix and a suffix from the image tag
+type VersionTransform struct {
+	TrimPrefix string `yaml:"trim_prefix"`
+	TrimSuffix string `yaml:"trim_suffix"`
+}
+
+func (t VersionTransform) apply(tag string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(tag, t.TrimPrefix), t.TrimSuffix)
+}
+
+// validate rejects what could never match a tag
+func (t VersionTransform) validate() error {
+	for _, s := range []string{t.TrimPrefix, t.TrimSuffix} {
+		if !tagCharacters.MatchString(s) {
+			return fmt.Errorf("%q can't be part of a tag", s)
+		}
+	}
+	return nil
+}
+
+// transformVersion applies the transform of the app, falling back to the global one
+func (a *Application) transformVersion(tag string) string {
+	if a.VersionTransform != nil {
+		return a.VersionTransform.apply(tag)
+	}
+	return currentConfig().VersionTransform.apply(tag)
+}
+
+// Sources of the tag the version is extracted from, see Application.VersionSource
+const (
+	versionSourceImage      = "image"
+	versionSourceTag        = "tag"
+	versionSourceImageOrTag = "image_or_tag"
+)
+
+// sourceTag returns the tag the version is extracted from and whether it's the tag of an image
+func (a *Application) sourceTag(e Event) (string, bool, error) {
+	switch a.VersionSource {
+	case versionSourceTag:
+		tag, err := eventTag(e)
+		return tag, false, err
+	case versionSourceImageOrTag:
+		if tag, err := getVersionFromImage(e.Images); err == nil {
+			return tag, true, nil
+		}
+		tag, err := eventTag(e)
+		return tag, false, err
+	}
+
+	tag, err := getVersionFromImage(e.Images)
+	return tag, true, err
+}
+
+// versionFromImage tells whether the versions of the app only come from the images
+func (a *Application) versionFromImage() bool {
+	return a.VersionSource == "" || a.VersionSource == versionSourceImage
+}
+
+func (a *Application) versionSourceName() string {
+	switch a.VersionSource {
+	case versionSourceTag:
+		return "tag"
+	case versionSourceImageOrTag:
+		return "image or tag"
+	}
+	return "image"
+}
+
+func eventTag(e Event) (string, error) {
+	if e.TagName == nil || *e.TagName == "" {
+		return "", errors.New("the build has no tag")
+	}
+	return *e.TagName, nil
+}
+
+// versionGroup is the named capture group of Application.VersionPattern
+const versionGroup = "version"
+
+func validateVersionPattern(pattern string) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	for _, name := range re.SubexpNames() {
+		if name == versionGroup {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s has no (?P<%s>...) group", pattern, versionGroup)
+}
+
+// extractVersion takes the version group of the VersionPattern of the app from the tag
+// and transforms it, tags are used as is without a pattern
+func (a *Application) extractVersion(tag string) (string, error) {
+	if a.VersionPattern == "" {
+		return a.transformVersion(tag), nil
+	}
+
+	// validated by Config.validate
+	re := regexp.MustCompile(a.VersionPattern)
+	match := re.FindStringSubmatch(tag)
+	if match == nil {
+		return "", fmt.Errorf("%s does not match the version_pattern %s", tag, a.VersionPattern)
+	}
+
+	var version string
+	for i, name := range re.SubexpNames() {
+		if name == versionGroup {
+			version = match[i]
+		}
+	}
+	return a.transformVersion(version), nil
+}
+
+// versionValidationSemver accepts semantic versions with an optional v prefix and build metadata,
+// the version including the metadata is written to the manifests as is
+const versionValidationSemver = "semver"
+
+var semverPattern = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)` +
+	`(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?` +
+	`(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
+
+func validateVersionValidation(validation string) error {
+	if validation == versionValidationSemver {
+		return nil
+	}
+	_, err := regexp.Compile(validation)
+	return err
+}
+
+// validateVersion checks the version against the VersionValidation of the app,
+// every version is valid without it
+func (a *Application) validateVersion(version string) error {
+	switch a.VersionValidation {
+	case "":
+		return nil
+	case versionValidationSemver:
+		if !semverPattern.MatchString(version) {
+			return fmt.Errorf("%q is not a semantic version", version)
+		}
+	default:
+		// validated by Config.validate
+		if !regexp.MustCompile(a.VersionValidation).MatchString(version) {
+			return fmt.Errorf("%q does not match the version_validation %s", version, a.VersionValidation)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package flow
+
+import "testing"
+
+func TestValidateVersionSemver(t *testing.T) {
+	tests := []struct {
+		version string
+		wantErr bool
+	}{
+		{"1.4.0", false},
+		{"v1.4.0", false},
+		{"1.4.0-rc.1", false},
+		{"1.4.0+build.27", false},
+		{"v1.4.0-rc.1+build.27.sha-5114f85", false},
+		{"1.4.0+", true},
+		{"1.4.0+build..27", true},
+		{"1.4.0+build_27", true},
+		{"1.4", true},
+		{"01.4.0", true},
+	}
+	a := &Application{VersionValidation: versionValidationSemver}
+	for _, tt := range tests {
+		if err := a.validateVersion(tt.version); (err != nil) != tt.wantErr {
+			t.Errorf("validateVersion(%q) = %v, want error %v", tt.version, err, tt.wantErr)
+		}
+	}
+}
+
+func TestExtractVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		app     Application
+		tag     string
+		want    string
+		wantErr bool
+	}{
+		{"as is", Application{}, "v1.4.0+build.27", "v1.4.0+build.27", false},
+		{"pattern keeps the metadata", Application{VersionPattern: `^release-(?P<version>.+)$`}, "release-1.4.0+build.27", "1.4.0+build.27", false},
+		{"transform keeps the metadata", Application{VersionTransform: &VersionTransform{TrimPrefix: "v"}}, "v1.4.0+build.27", "1.4.0+build.27", false},
+		{"pattern not matched", Application{VersionPattern: `^release-(?P<version>.+)$`}, "v1.4.0+build.27", "", true},
+	}
+	setConfig(&Config{})
+	for _, tt := range tests {
+		got, err := tt.app.extractVersion(tt.tag)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: extracted %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
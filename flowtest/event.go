@@ -0,0 +1,102 @@
+// Package flowtest provides fakes to test the event handling of Flow without Pub/Sub, GitHub or Slack
+package flowtest
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/sakajunquality/flow/flow"
+)
+
+// Statuses of Cloud Build
+const (
+	StatusQueued  = "QUEUED"
+	StatusWorking = "WORKING"
+	StatusSuccess = "SUCCESS"
+	StatusFailure = "FAILURE"
+)
+
+// EventBuilder builds the Cloud Build event of a trigger, a successful finished build by default
+type EventBuilder struct {
+	e flow.Event
+}
+
+func NewEvent(triggerID string) *EventBuilder {
+	b := &EventBuilder{}
+	b.e.ID = "build-" + triggerID
+	b.e.ProjectID = "project"
+	b.e.LogURL = "https://console.cloud.google.com/cloud-build/builds/" + b.e.ID
+	b.e.TriggerID = &triggerID
+	return b.Success()
+}
+
+func (b *EventBuilder) ID(id string) *EventBuilder {
+	b.e.ID = id
+	return b
+}
+
+func (b *EventBuilder) Success() *EventBuilder {
+	return b.finished(StatusSuccess)
+}
+
+func (b *EventBuilder) Failure() *EventBuilder {
+	return b.finished(StatusFailure)
+}
+
+// Working is a build which hasn't finished yet
+func (b *EventBuilder) Working() *EventBuilder {
+	b.e.Status = StatusWorking
+	b.e.FinishTime = nil
+	return b
+}
+
+func (b *EventBuilder) finished(status string) *EventBuilder {
+	now := time.Now()
+	b.e.Status = status
+	b.e.StartTime = &now
+	b.e.FinishTime = &now
+	return b
+}
+
+// Images are pushed by the build, like gcr.io/project/app:v1.0.0
+func (b *EventBuilder) Images(images ...string) *EventBuilder {
+	b.e.Images = images
+	return b
+}
+
+// Digest is the digest the image (including the tag) was pushed with
+func (b *EventBuilder) Digest(image, digest string) *EventBuilder {
+	b.e.Results.Images = append(b.e.Results.Images, flow.BuiltImage{Name: image, Digest: digest})
+	return b
+}
+
+func (b *EventBuilder) Tag(tag string) *EventBuilder {
+	b.e.TagName = &tag
+	return b
+}
+
+func (b *EventBuilder) Branch(branch string) *EventBuilder {
+	b.e.BranchName = &branch
+	return b
+}
+
+func (b *EventBuilder) Substitution(key, value string) *EventBuilder {
+	if b.e.Substitutions == nil {
+		b.e.Substitutions = map[string]string{}
+	}
+	b.e.Substitutions[key] = value
+	return b
+}
+
+func (b *EventBuilder) Build() flow.Event {
+	return b.e
+}
+
+// JSON is the message Pub/Sub delivers, see flow.ParseEvent
+func (b *EventBuilder) JSON() []byte {
+	data, err := json.Marshal(b.e)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
@@ -0,0 +1,57 @@
+package flowtest
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sakajunquality/flow/flow"
+)
+
+func TestEventBuilder(t *testing.T) {
+	tests := []struct {
+		name     string
+		builder  *EventBuilder
+		status   string
+		finished bool
+		success  bool
+	}{
+		{"success", NewEvent("trigger"), StatusSuccess, true, true},
+		{"failure", NewEvent("trigger").Failure(), StatusFailure, true, false},
+		{"working", NewEvent("trigger").Working(), StatusWorking, false, false},
+	}
+	for _, tt := range tests {
+		e := tt.builder.Build()
+		if e.Status != tt.status || e.IsFinished() != tt.finished || e.IsSuuccess() != tt.success {
+			t.Errorf("%s: status %s, finished %v, success %v", tt.name, e.Status, e.IsFinished(), e.IsSuuccess())
+		}
+		if e.TriggerID == nil || *e.TriggerID != "trigger" || e.ID != "build-trigger" {
+			t.Errorf("%s: built %+v", tt.name, e)
+		}
+	}
+}
+
+func TestEventBuilderJSON(t *testing.T) {
+	b := NewEvent("trigger").
+		ID("build-1").
+		Images("gcr.io/project/app:v1.0.0").
+		Digest("gcr.io/project/app:v1.0.0", "sha256:0000").
+		Tag("v1.0.0").
+		Branch("main").
+		Substitution("_ENV", "prod")
+
+	e, err := flow.ParseEvent(b.JSON())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := b.Build()
+	if e.ID != want.ID || *e.TagName != "v1.0.0" || *e.BranchName != "main" ||
+		!reflect.DeepEqual(e.Images, want.Images) ||
+		!reflect.DeepEqual(e.Results, want.Results) ||
+		!reflect.DeepEqual(e.Substitutions, want.Substitutions) {
+		t.Errorf("parsed %+v, want %+v", e, want)
+	}
+	if !e.FinishTime.Equal(*want.FinishTime) {
+		t.Errorf("finished at %s, want %s", e.FinishTime, want.FinishTime)
+	}
+}
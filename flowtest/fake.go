@@ -0,0 +1,118 @@
+package flowtest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/sakajunquality/flow/flow"
+	"github.com/sakajunquality/flow/gitbot"
+	"github.com/sakajunquality/flow/slackbot"
+)
+
+// Message is a message notified to the Notifier
+type Message struct {
+	Channel string
+	Detail  slackbot.MessageDetail
+}
+
+// Notifier records the messages instead of notifying them
+type Notifier struct {
+	mu       sync.Mutex
+	Messages []Message
+}
+
+func (n *Notifier) Notify(ctx context.Context, channel string, d slackbot.MessageDetail) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.Messages = append(n.Messages, Message{Channel: channel, Detail: d})
+	return nil
+}
+
+// Release is a PR opened on the Releaser
+type Release struct {
+	Repo       string
+	BaseBranch string
+	Branch     string
+	Title      string
+	// Files are the contents after the release, by path
+	Files map[string]string
+	URL   string
+}
+
+// Releaser is a fake manifest repository, the files are read from Contents
+// and the releases are recorded instead of opening PRs
+type Releaser struct {
+	mu sync.Mutex
+	// Contents are the files of the base branches by repo/path, like owner/name/overlays/dev/deployment.yaml
+	Contents map[string]string
+	// Err fails every release when set
+	Err      error
+	Releases []Release
+}
+
+func (r *Releaser) GetContent(ctx context.Context, repo *gitbot.Repo, token, filePath string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	content, ok := r.Contents[repo.FullName()+"/"+filePath]
+	if !ok {
+		return "", fmt.Errorf("%s not found in %s", filePath, repo.FullName())
+	}
+	return content, nil
+}
+
+func (r *Releaser) Create(ctx context.Context, release *gitbot.Release, token string) (*gitbot.Result, error) {
+	if r.Err != nil {
+		return nil, r.Err
+	}
+
+	changes, err := release.PreviewFrom(func(filePath string) (string, error) {
+		return r.GetContent(ctx, &release.Repo, token, filePath)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	files := map[string]string{}
+	for _, c := range changes {
+		files[c.Path] = c.After
+	}
+
+	number := len(r.Releases) + 1
+	url := fmt.Sprintf("https://github.com/%s/pull/%d", release.Repo.FullName(), number)
+	r.Releases = append(r.Releases, Release{
+		Repo:       release.Repo.FullName(),
+		BaseBranch: release.Repo.BaseBranch(),
+		Branch:     release.Branch(),
+		Title:      release.Title(),
+		Files:      files,
+		URL:        url,
+	})
+
+	return &gitbot.Result{URL: url, Number: number}, nil
+}
+
+// New returns a Flow releasing to the fake Releaser and notifying the fake Notifier,
+// process events with Flow.ProcessOnce
+func New(c *flow.Config, contents map[string]string, opts ...flow.Option) (*flow.Flow, *Releaser, *Notifier, error) {
+	releaser := &Releaser{Contents: contents}
+	notifier := &Notifier{}
+
+	opts = append([]flow.Option{
+		flow.WithEnv("test", "project", "slack-token"),
+		flow.WithGitHubToken(flow.StaticToken("github-token"), 0),
+		flow.WithReleaser(releaser),
+		flow.WithNotifier(notifier),
+	}, opts...)
+
+	f, err := flow.New(c, opts...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return f, releaser, notifier, nil
+}
@@ -0,0 +1,51 @@
+package flowtest
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestReleaserErr(t *testing.T) {
+	f, releaser, notifier, err := New(newConfig(), newContents())
+	if err != nil {
+		t.Fatal(err)
+	}
+	releaser.Err = errors.New("github is down")
+
+	result, err := f.ProcessOnce(context.Background(), NewEvent("trigger").Images("gcr.io/project/app:v1.0.0").Build(), ioutil.Discard)
+	if err == nil {
+		t.Error("processed the failed releases")
+	}
+	if result == nil || len(result.Apps) != 1 || len(result.Apps[0].Envs) != 2 {
+		t.Fatalf("result %+v, want both envs", result)
+	}
+	for _, env := range result.Apps[0].Envs {
+		if env.Status != "failed" || env.Error != "github is down" {
+			t.Errorf("%s: %+v, want failed by the releaser", env.Env, env)
+		}
+	}
+
+	if len(notifier.Messages) != 1 || !strings.Contains(notifier.Messages[0].Detail.PrURL, "*Failed*") {
+		t.Errorf("messages %+v, want the failed envs", notifier.Messages)
+	}
+}
+
+func TestReleaserContents(t *testing.T) {
+	c := newConfig()
+	c.ApplicationList[0].Manifests[1].Files = []string{"prod/missing.yaml"}
+	f, releaser, _, err := New(c, newContents())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, _ := f.ProcessOnce(context.Background(), NewEvent("trigger").Images("gcr.io/project/app:v1.0.0").Build(), ioutil.Discard)
+	if len(releaser.Releases) != 1 || releaser.Releases[0].Files["dev/deployment.yaml"] == "" {
+		t.Errorf("released %+v, want dev only", releaser.Releases)
+	}
+	if result == nil || result.Apps[0].Envs[1].Status != "failed" {
+		t.Errorf("result %+v, want prod failed by the missing file", result)
+	}
+}
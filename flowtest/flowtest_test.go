@@ -0,0 +1,712 @@
+package flowtest
+
+import (
+	"context"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sakajunquality/flow/flow"
+)
+
+const deployment = `apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: gcr.io/project/app:v0.9.0
+`
+
+// newConfig is an app releasing gcr.io/project/app to the dev and prod envs of owner/manifests
+func newConfig() *flow.Config {
+	return &flow.Config{
+		SlackNotifiyChannel: "#global",
+		ApplicationList: []flow.Application{{
+			Name:               "app",
+			TriggerID:          "trigger",
+			ImageName:          "gcr.io/project/app",
+			SourceOwner:        "owner",
+			SourceName:         "app",
+			ManifestOwner:      "owner",
+			ManifestName:       "manifests",
+			ManifestBaseBranch: "main",
+			Manifests: []flow.Manifest{
+				{Env: "dev", Files: []string{"dev/deployment.yaml"}},
+				{Env: "prod", Files: []string{"prod/deployment.yaml"}},
+			},
+		}},
+	}
+}
+
+// newContents are the deployments of the envs of newConfig
+func newContents() map[string]string {
+	return map[string]string{
+		"owner/manifests/dev/deployment.yaml":  deployment,
+		"owner/manifests/prod/deployment.yaml": deployment,
+	}
+}
+
+func process(t *testing.T, c *flow.Config, e flow.Event) (*flow.EventResult, *Releaser, *Notifier, error) {
+	t.Helper()
+
+	f, releaser, notifier, err := New(c, newContents())
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := f.ProcessOnce(context.Background(), e, ioutil.Discard)
+	return result, releaser, notifier, err
+}
+
+func TestFailureChannel(t *testing.T) {
+	tests := []struct {
+		name    string
+		app     string
+		prod    string
+		event   flow.Event
+		channel string
+	}{
+		{
+			name:    "build failure to the global channel",
+			event:   NewEvent("trigger").Failure().Build(),
+			channel: "#global",
+		},
+		{
+			name:    "build failure to the app channel",
+			app:     "#app",
+			prod:    "#prod",
+			event:   NewEvent("trigger").Failure().Build(),
+			channel: "#app",
+		},
+		{
+			name:    "invalid version of an env to its channel",
+			app:     "#app",
+			prod:    "#prod",
+			event:   NewEvent("trigger").Images("gcr.io/project/app:v1.0.0").Build(),
+			channel: "#prod",
+		},
+	}
+	for _, tt := range tests {
+		c := newConfig()
+		app := &c.ApplicationList[0]
+		app.SlackChannel = tt.app
+		app.Manifests[1].SlackChannel = tt.prod
+		// Only the prod env keeps the v of the tag, which the version_pattern refuses
+		app.Manifests[0].TagPrefix = "v"
+		app.VersionPattern = `^(?P<version>\d+\.\d+\.\d+)$`
+
+		_, _, notifier, _ := process(t, c, tt.event)
+		var failures []Message
+		for _, m := range notifier.Messages {
+			if !m.Detail.IsSuccess {
+				failures = append(failures, m)
+			}
+		}
+		if len(failures) != 1 || failures[0].Channel != tt.channel {
+			t.Errorf("%s: failures %+v, want one to %s", tt.name, failures, tt.channel)
+		}
+	}
+}
+
+func TestProcessOnceFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(*flow.Application)
+		event  flow.Event
+		failed bool
+		envs   []flow.EnvResult
+	}{
+		{
+			name:  "released",
+			event: NewEvent("trigger").Images("gcr.io/project/app:v1.0.0").Build(),
+			envs: []flow.EnvResult{
+				{Env: "dev", Version: "v1.0.0", Status: "created", PRURL: "https://github.com/owner/manifests/pull/1"},
+				{Env: "prod", Version: "v1.0.0", Status: "created", PRURL: "https://github.com/owner/manifests/pull/2"},
+			},
+		},
+		{
+			name:   "build failure",
+			event:  NewEvent("trigger").Failure().Build(),
+			failed: true,
+			envs:   []flow.EnvResult{{Status: "failed", Error: "build FAILURE"}},
+		},
+		{
+			name:   "no images",
+			event:  NewEvent("trigger").Build(),
+			failed: true,
+		},
+		{
+			name:   "invalid version",
+			config: func(a *flow.Application) { a.VersionPattern = `^(?P<version>\d+\.\d+\.\d+)$` },
+			event:  NewEvent("trigger").Images("gcr.io/project/app:v1.0.0").Build(),
+			failed: true,
+		},
+		{
+			name:   "max_prs_per_event",
+			config: func(a *flow.Application) { a.MaxPRsPerEvent = 1 },
+			event:  NewEvent("trigger").Images("gcr.io/project/app:v1.0.0").Build(),
+			failed: true,
+			envs:   []flow.EnvResult{{Status: "failed", Error: "2 releases exceed max_prs_per_event 1, none was created"}},
+		},
+	}
+	for _, tt := range tests {
+		c := newConfig()
+		if tt.config != nil {
+			tt.config(&c.ApplicationList[0])
+		}
+
+		result, releaser, _, err := process(t, c, tt.event)
+		if (err != nil) != tt.failed {
+			t.Errorf("%s: err = %v, want failed %v", tt.name, err, tt.failed)
+			continue
+		}
+		if result == nil || len(result.Apps) != 1 {
+			t.Errorf("%s: result %+v, want the result of the app", tt.name, result)
+			continue
+		}
+		if tt.failed && len(releaser.Releases) != 0 {
+			t.Errorf("%s: released %+v", tt.name, releaser.Releases)
+		}
+		if tt.envs != nil && !reflect.DeepEqual(result.Apps[0].Envs, tt.envs) {
+			t.Errorf("%s: envs %+v, want %+v", tt.name, result.Apps[0].Envs, tt.envs)
+		}
+	}
+}
+
+func TestPRModeSingle(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   func(*flow.Application)
+		files    [][]string
+		envs     []flow.EnvResult
+		clusters []string
+	}{
+		{
+			name:  "one PR for every env",
+			files: [][]string{{"dev/deployment.yaml", "prod/deployment.yaml"}},
+			envs: []flow.EnvResult{
+				{Env: "dev, prod", Version: "v1.0.0", Status: "created", PRURL: "https://github.com/owner/manifests/pull/1"},
+			},
+			clusters: []string{"dev, prod → asia/dev, asia/prod"},
+		},
+		{
+			name:   "force_dry_run env apart",
+			config: func(a *flow.Application) { a.Manifests[1].ForceDryRun = true },
+			files:  [][]string{{"dev/deployment.yaml"}},
+			envs: []flow.EnvResult{
+				{Env: "prod", Version: "v1.0.0", Status: "skipped", Reason: "dry-run by force_dry_run, v1.0.0 was not released"},
+				{Env: "dev", Version: "v1.0.0", Status: "created", PRURL: "https://github.com/owner/manifests/pull/1"},
+			},
+			clusters: []string{"prod → asia/prod", "dev → asia/dev"},
+		},
+	}
+	for _, tt := range tests {
+		c := newConfig()
+		app := &c.ApplicationList[0]
+		app.PRMode = "single"
+		app.Manifests[0].Region, app.Manifests[0].Cluster = "asia", "dev"
+		app.Manifests[1].Region, app.Manifests[1].Cluster = "asia", "prod"
+		if tt.config != nil {
+			tt.config(app)
+		}
+
+		result, releaser, notifier, err := process(t, c, NewEvent("trigger").Images("gcr.io/project/app:v1.0.0").Build())
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+
+		var files [][]string
+		for _, r := range releaser.Releases {
+			var paths []string
+			for path := range r.Files {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			files = append(files, paths)
+		}
+		if !reflect.DeepEqual(files, tt.files) {
+			t.Errorf("%s: released %q, want %q", tt.name, files, tt.files)
+		}
+		if !reflect.DeepEqual(result.Apps[0].Envs, tt.envs) {
+			t.Errorf("%s: envs %+v, want %+v", tt.name, result.Apps[0].Envs, tt.envs)
+		}
+		if len(notifier.Messages) != 1 || !reflect.DeepEqual(notifier.Messages[0].Detail.Clusters, tt.clusters) {
+			t.Errorf("%s: messages %+v, want the clusters %q", tt.name, notifier.Messages, tt.clusters)
+		}
+	}
+}
+
+func TestDeployOnly(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   flow.Event
+		success bool
+		branch  string
+		tag     string
+	}{
+		{"branch deploy", NewEvent("trigger").Branch("main").Build(), true, "main", ""},
+		{"tag deploy", NewEvent("trigger").Tag("v1.0.0").Build(), true, "", "v1.0.0"},
+		{"failed deploy", NewEvent("trigger").Branch("main").Failure().Build(), false, "main", ""},
+	}
+	for _, tt := range tests {
+		c := newConfig()
+		c.ApplicationList[0].DeployOnly = true
+
+		_, releaser, notifier, _ := process(t, c, tt.event)
+		if len(releaser.Releases) != 0 {
+			t.Errorf("%s: released %+v", tt.name, releaser.Releases)
+		}
+		if len(notifier.Messages) != 1 {
+			t.Errorf("%s: messages %+v, want one", tt.name, notifier.Messages)
+			continue
+		}
+
+		d := notifier.Messages[0].Detail
+		var branch, tag string
+		if d.BranchName != nil {
+			branch = *d.BranchName
+		}
+		if d.TagName != nil {
+			tag = *d.TagName
+		}
+		if d.IsSuccess != tt.success || d.IsPrNotify || branch != tt.branch || tag != tt.tag {
+			t.Errorf("%s: message %+v, want success %v of the branch %q and the tag %q", tt.name, d, tt.success, tt.branch, tt.tag)
+		}
+	}
+}
+
+func TestTagPrefix(t *testing.T) {
+	c := newConfig()
+	app := &c.ApplicationList[0]
+	app.Manifests[0].TagPrefix = "staging-"
+	app.Manifests[1].TagPrefix = "prod-"
+
+	tests := []struct {
+		name   string
+		images []string
+		want   map[string]string
+	}{
+		{
+			name:   "tags of both envs",
+			images: []string{"gcr.io/project/app:staging-1.4.0", "gcr.io/project/app:prod-1.4.0"},
+			want: map[string]string{
+				"dev/deployment.yaml":  "image: gcr.io/project/app:1.4.0",
+				"prod/deployment.yaml": "image: gcr.io/project/app:1.4.0",
+			},
+		},
+		{
+			name:   "tag of prod only",
+			images: []string{"gcr.io/project/app:prod-1.5.0"},
+			want: map[string]string{
+				"prod/deployment.yaml": "image: gcr.io/project/app:1.5.0",
+			},
+		},
+	}
+	for _, tt := range tests {
+		_, releaser, _, err := process(t, c, NewEvent("trigger").Images(tt.images...).Build())
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+
+		got := map[string]string{}
+		for _, r := range releaser.Releases {
+			for path, content := range r.Files {
+				got[path] = imageLine(content)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: released %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// imageLine is the first image of the manifest
+func imageLine(content string) string {
+	for _, line := range strings.Split(content, "\n") {
+		if line = strings.TrimSpace(line); strings.HasPrefix(line, "image:") {
+			return line
+		}
+	}
+	return ""
+}
+
+func TestPinByDigest(t *testing.T) {
+	const digest = "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+	tests := []struct {
+		name     string
+		strategy string
+		event    flow.Event
+		want     string
+		err      string
+	}{
+		{
+			name:  "regex",
+			event: NewEvent("trigger").Images("gcr.io/project/app:v1.0.0").Digest("gcr.io/project/app:v1.0.0", digest).Build(),
+			want:  "image: gcr.io/project/app@" + digest,
+		},
+		{
+			name:     "yaml",
+			strategy: "yaml",
+			event:    NewEvent("trigger").Images("gcr.io/project/app:v1.0.0").Digest("gcr.io/project/app:v1.0.0", digest).Build(),
+			want:     "image: gcr.io/project/app@" + digest,
+		},
+		{
+			name:  "digest of another tag",
+			event: NewEvent("trigger").Images("gcr.io/project/app:v1.0.0").Digest("gcr.io/project/app:latest", digest).Build(),
+			err:   "No digest of gcr.io/project/app:v1.0.0 was pushed by the build",
+		},
+	}
+	for _, tt := range tests {
+		c := newConfig()
+		app := &c.ApplicationList[0]
+		app.Manifests = app.Manifests[1:]
+		app.Manifests[0].PinBy = "digest"
+		app.Manifests[0].UpdateStrategy = tt.strategy
+
+		result, releaser, _, err := process(t, c, tt.event)
+		if tt.err != "" {
+			if err == nil || len(result.Apps) != 1 || !strings.Contains(result.Apps[0].Envs[0].Error, tt.err) {
+				t.Errorf("%s: result %+v, %v, want the error %q", tt.name, result, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+
+		if len(releaser.Releases) != 1 {
+			t.Errorf("%s: released %+v", tt.name, releaser.Releases)
+			continue
+		}
+		r := releaser.Releases[0]
+		if got := imageLine(r.Files["prod/deployment.yaml"]); got != tt.want {
+			t.Errorf("%s: wrote %q, want %q", tt.name, got, tt.want)
+		}
+		// The tag still names the release
+		if r.Title != "prod v1.0.0 Release" {
+			t.Errorf("%s: title %q", tt.name, r.Title)
+		}
+	}
+}
+
+func TestBuildDedup(t *testing.T) {
+	tests := []struct {
+		name     string
+		ttl      time.Duration
+		event    flow.Event
+		releases int
+		messages int
+	}{
+		{"redelivered release", time.Hour, NewEvent("trigger").Images("gcr.io/project/app:v1.0.0").Build(), 2, 1},
+		{"redelivered failure", time.Hour, NewEvent("trigger").Failure().Build(), 0, 1},
+		// Without the dedup, the redelivered failures are notified again
+		{"without dedup", 0, NewEvent("trigger").Failure().Build(), 0, 2},
+	}
+	for _, tt := range tests {
+		c := newConfig()
+		c.BuildDedupTTL = tt.ttl
+		f, releaser, notifier, err := New(c, newContents())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 2; i++ {
+			f.ProcessOnce(context.Background(), tt.event, ioutil.Discard)
+		}
+		if len(releaser.Releases) != tt.releases || len(notifier.Messages) != tt.messages {
+			t.Errorf("%s: %d releases and %d messages, want %d and %d", tt.name, len(releaser.Releases), len(notifier.Messages), tt.releases, tt.messages)
+		}
+	}
+}
+
+func TestBuildDedupOtherBuild(t *testing.T) {
+	c := newConfig()
+	c.BuildDedupTTL = time.Hour
+	f, _, notifier, err := New(c, newContents())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"build-1", "build-2"} {
+		f.ProcessOnce(context.Background(), NewEvent("trigger").ID(id).Failure().Build(), ioutil.Discard)
+	}
+	if len(notifier.Messages) != 2 {
+		t.Errorf("notified %d messages of two builds, want 2", len(notifier.Messages))
+	}
+}
+
+func TestReleaseStatuses(t *testing.T) {
+	c := newConfig()
+	app := &c.ApplicationList[0]
+	app.Manifests = []flow.Manifest{
+		{Env: "dev", Files: []string{"dev/deployment.yaml"}},
+		{Env: "qa", Files: []string{"qa/deployment.yaml"}, Filters: flow.Filters{ExcludePrefixes: []string{"v1."}}},
+		{Env: "staging", Files: []string{"staging/deployment.yaml"}, PinnedVersion: "v0.9.0"},
+		{Env: "canary", Files: []string{"canary/deployment.yaml"}},
+		{Env: "prod", Files: []string{"prod/missing.yaml"}},
+	}
+	contents := newContents()
+	for _, env := range []string{"qa", "staging"} {
+		contents["owner/manifests/"+env+"/deployment.yaml"] = deployment
+	}
+	contents["owner/manifests/canary/deployment.yaml"] = strings.Replace(deployment, "v0.9.0", "v1.0.0", 1)
+
+	f, _, notifier, err := New(c, contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, _ := f.ProcessOnce(context.Background(), NewEvent("trigger").Images("gcr.io/project/app:v1.0.0").Build(), ioutil.Discard)
+
+	statuses := map[string]string{}
+	for _, env := range result.Apps[0].Envs {
+		statuses[env.Env] = env.Status
+	}
+	want := map[string]string{"dev": "created", "qa": "filtered", "staging": "skipped", "canary": "unchanged", "prod": "failed"}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("statuses %v, want %v", statuses, want)
+	}
+
+	if len(notifier.Messages) != 1 {
+		t.Fatalf("messages %+v, want one", notifier.Messages)
+	}
+	text := notifier.Messages[0].Detail.PrURL
+	sections := []struct {
+		title string
+		env   string
+	}{
+		{"*Created*", "`dev`"},
+		{"*Failed*", "`prod`"},
+		{"*Unchanged*", "`canary`"},
+		{"*Skipped*", "`staging`"},
+		{"*Filtered*", "`qa`"},
+	}
+	last := -1
+	for _, s := range sections {
+		i := strings.Index(text, s.title)
+		if i <= last || !strings.Contains(text[i:], s.env) {
+			t.Errorf("%s with %s is out of order in\n%s", s.title, s.env, text)
+		}
+		last = i
+	}
+}
+
+func TestNoImages(t *testing.T) {
+	tests := []struct {
+		noImages string
+		failed   bool
+		messages int
+	}{
+		{"", true, 1},
+		{"fail", true, 1},
+		{"ignore", false, 0},
+	}
+	for _, tt := range tests {
+		c := newConfig()
+		c.ApplicationList[0].NoImages = tt.noImages
+
+		_, releaser, notifier, err := process(t, c, NewEvent("trigger").Build())
+		if (err != nil) != tt.failed || len(notifier.Messages) != tt.messages || len(releaser.Releases) != 0 {
+			t.Errorf("no_images %q: err %v with %d messages and %d releases, want failed %v with %d messages",
+				tt.noImages, err, len(notifier.Messages), len(releaser.Releases), tt.failed, tt.messages)
+		}
+		for _, m := range notifier.Messages {
+			if m.Detail.IsSuccess {
+				t.Errorf("no_images %q: notified %+v, want a failure", tt.noImages, m.Detail)
+			}
+		}
+	}
+
+	c := newConfig()
+	c.ApplicationList[0].NoImages = "neutral"
+	if _, _, _, err := New(c, newContents()); err == nil {
+		t.Error("accepted an unknown no_images")
+	}
+}
+
+func TestBuildMetadata(t *testing.T) {
+	c := newConfig()
+	app := &c.ApplicationList[0]
+	app.VersionSource = "tag"
+	app.VersionValidation = "semver"
+	app.Manifests[1].Filters.ExcludePrefixes = []string{"v1.3."}
+
+	tests := []struct {
+		name string
+		tag  string
+		want map[string]string
+	}{
+		{
+			name: "metadata written verbatim",
+			tag:  "v1.4.0+build.27",
+			want: map[string]string{
+				"dev/deployment.yaml":  "image: gcr.io/project/app:v1.4.0+build.27",
+				"prod/deployment.yaml": "image: gcr.io/project/app:v1.4.0+build.27",
+			},
+		},
+		{
+			name: "metadata of an excluded version",
+			tag:  "v1.3.2+build.31",
+			want: map[string]string{
+				"dev/deployment.yaml": "image: gcr.io/project/app:v1.3.2+build.31",
+			},
+		},
+	}
+	for _, tt := range tests {
+		_, releaser, _, err := process(t, c, NewEvent("trigger").Tag(tt.tag).Build())
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+
+		got := map[string]string{}
+		for _, r := range releaser.Releases {
+			for path, content := range r.Files {
+				got[path] = imageLine(content)
+			}
+			if !strings.Contains(r.Title, tt.tag) {
+				t.Errorf("%s: released %q, want the title with %q", tt.name, r.Title, tt.tag)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: released %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReplace(t *testing.T) {
+	const initContainer = `apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: migrate
+        image: gcr.io/project/app:v0.9.0
+      containers:
+      - name: app
+        image: gcr.io/project/app:v0.9.0
+`
+	tests := []struct {
+		name    string
+		replace string
+		want    []string
+	}{
+		{"all by default", "", []string{"image: gcr.io/project/app:v1.0.0", "image: gcr.io/project/app:v1.0.0"}},
+		{"all", "all", []string{"image: gcr.io/project/app:v1.0.0", "image: gcr.io/project/app:v1.0.0"}},
+		{"first", "first", []string{"image: gcr.io/project/app:v1.0.0", "image: gcr.io/project/app:v0.9.0"}},
+	}
+	for _, tt := range tests {
+		c := newConfig()
+		app := &c.ApplicationList[0]
+		app.Manifests = app.Manifests[:1]
+		app.Manifests[0].Replace = tt.replace
+
+		f, releaser, _, err := New(c, map[string]string{"owner/manifests/dev/deployment.yaml": initContainer})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.ProcessOnce(context.Background(), NewEvent("trigger").Images("gcr.io/project/app:v1.0.0").Build(), ioutil.Discard); err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if len(releaser.Releases) != 1 {
+			t.Errorf("%s: %d releases, want one", tt.name, len(releaser.Releases))
+			continue
+		}
+
+		var got []string
+		for _, line := range strings.Split(releaser.Releases[0].Files["dev/deployment.yaml"], "\n") {
+			if line = strings.TrimSpace(line); strings.HasPrefix(line, "image:") {
+				got = append(got, line)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: released %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestImageMatch(t *testing.T) {
+	const mixed = `apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: gcr.io/project/app:v0.9.0
+      - name: mirror
+        image: project/app:v0.9.0
+      - name: local
+        image: "app:v0.9.0"
+      - name: worker
+        image: gcr.io/project/app-worker:v0.9.0
+      - name: other
+        image: myapp:v0.9.0
+`
+	tests := []struct {
+		name  string
+		match string
+		want  []string
+	}{
+		{
+			name:  "full by default",
+			match: "",
+			want: []string{
+				"image: gcr.io/project/app:v1.0.0",
+				"image: project/app:v0.9.0",
+				`image: "app:v0.9.0"`,
+				"image: gcr.io/project/app-worker:v0.9.0",
+				"image: myapp:v0.9.0",
+			},
+		},
+		{
+			name:  "short",
+			match: "short",
+			want: []string{
+				"image: gcr.io/project/app:v1.0.0",
+				"image: project/app:v1.0.0",
+				`image: "app:v1.0.0"`,
+				"image: gcr.io/project/app-worker:v0.9.0",
+				"image: myapp:v0.9.0",
+			},
+		},
+	}
+	for _, tt := range tests {
+		c := newConfig()
+		app := &c.ApplicationList[0]
+		app.ImageMatch = tt.match
+		app.Manifests = app.Manifests[:1]
+
+		f, releaser, _, err := New(c, map[string]string{"owner/manifests/dev/deployment.yaml": mixed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.ProcessOnce(context.Background(), NewEvent("trigger").Images("gcr.io/project/app:v1.0.0").Build(), ioutil.Discard); err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if len(releaser.Releases) != 1 {
+			t.Errorf("%s: %d releases, want one", tt.name, len(releaser.Releases))
+			continue
+		}
+
+		var got []string
+		for _, line := range strings.Split(releaser.Releases[0].Files["dev/deployment.yaml"], "\n") {
+			if line = strings.TrimSpace(line); strings.HasPrefix(line, "image:") {
+				got = append(got, line)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: released %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package gitbot
+
+import (
+	"strings"
+
+	"github.com/google/go-github/v18/github"
+)
+
+// AmendOpenPR pushes the release onto the open PR of Flow whose branch starts with the prefix,
+// updating its title and body, instead of opening another PR
+func (r *Release) AmendOpenPR(branchPrefix string) {
+	r.PullRequest.amendPrefix = branchPrefix
+}
+
+// findAmendablePR returns the open PR of Flow on the base branch whose branch starts with amendPrefix
+func (r *Release) findAmendablePR() (*github.PullRequest, error) {
+	if r.amendPrefix == "" || r.label == "" {
+		return nil, nil
+	}
+
+	opt := &github.PullRequestListOptions{
+		State: "open",
+		Base:  r.baseBranch,
+	}
+	prs, _, err := r.client.PullRequests.List(r.ctx, r.sourceOwner, r.sourceRepo, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pr := range prs {
+		if hasLabel(pr, r.label) && strings.HasPrefix(pr.GetHead().GetRef(), r.amendPrefix) {
+			return pr, nil
+		}
+	}
+	return nil, nil
+}
+
+// amend adds a commit of the changes on top of the branch of the PR and updates its title and body
+func (r *Release) amend(pr *github.PullRequest) (*Result, error) {
+	branch := pr.GetHead().GetRef()
+
+	ref, _, err := r.client.Git.GetRef(r.ctx, r.sourceOwner, r.sourceRepo, "refs/heads/"+branch)
+	if err != nil {
+		return nil, r.wrap(StepAmend, branch, "", err)
+	}
+
+	entries := []github.TreeEntry{}
+	for _, c := range r.sortedChanges() {
+		content, err := r.getChangedContent(c, branch)
+		if err != nil {
+			return nil, r.wrap(StepUpdateFile, branch, c.filePath, err)
+		}
+		entries = append(entries, github.TreeEntry{Path: github.String(c.filePath), Type: github.String("blob"), Content: github.String(content), Mode: github.String("100644")})
+	}
+
+	tree, _, err := r.client.Git.CreateTree(r.ctx, r.sourceOwner, r.sourceRepo, *ref.Object.SHA, entries)
+	if err != nil {
+		return nil, r.wrap(StepAmend, branch, "", err)
+	}
+
+	author := r.commitAuthor()
+	parent := github.Commit{SHA: ref.Object.SHA}
+	commit := &github.Commit{Author: author, Committer: author, Message: &r.commitMessage, Tree: tree, Parents: []github.Commit{parent}}
+	newCommit, _, err := r.client.Git.CreateCommit(r.ctx, r.sourceOwner, r.sourceRepo, commit)
+	if err != nil {
+		return nil, r.wrap(StepAmend, branch, "", err)
+	}
+
+	// Not forced, so a concurrent push to the branch fails the amend instead of being lost
+	ref.Object.SHA = newCommit.SHA
+	if _, _, err := r.client.Git.UpdateRef(r.ctx, r.sourceOwner, r.sourceRepo, ref, false); err != nil {
+		return nil, r.wrap(StepAmend, branch, "", err)
+	}
+
+	edit := &github.PullRequest{Title: github.String(r.prTitle), Body: github.String(r.prBody)}
+	if _, _, err := r.client.PullRequests.Edit(r.ctx, r.sourceOwner, r.sourceRepo, pr.GetNumber(), edit); err != nil {
+		return nil, r.wrap(StepAmend, branch, "", err)
+	}
+
+	return &Result{URL: pr.GetHTMLURL(), Number: pr.GetNumber(), Amended: true}, nil
+}
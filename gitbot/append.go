@@ -0,0 +1,52 @@
+package gitbot
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v18/github"
+)
+
+// AppendFile adds the lines to the end of the file on the base branch with a single commit,
+// creating the file when it's missing. It fails with ErrConflict when the file was changed
+// by someone else meanwhile, so the caller can simply retry.
+func (r *Repo) AppendFile(ctx context.Context, token, filePath string, lines []string, message, authorName, authorEmail string) error {
+	c := r.newClient(ctx, token)
+
+	var content string
+	var sha *string
+	f, _, _, err := c.Repositories.GetContents(ctx, r.sourceOwner, r.sourceRepo, filePath, &github.RepositoryContentGetOptions{Ref: r.baseBranch})
+	if err := r.wrap(StepGetFile, r.baseBranch, filePath, err); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	// The file is created with the first lines when it's not found
+	if f != nil {
+		if content, err = f.GetContent(); err != nil {
+			return r.wrap(StepGetFile, r.baseBranch, filePath, err)
+		}
+		sha = f.SHA
+	}
+
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	content += strings.Join(lines, "\n") + "\n"
+
+	date := time.Now()
+	opt := &github.RepositoryContentFileOptions{
+		Message: github.String(message),
+		Content: []byte(content),
+		SHA:     sha,
+		Branch:  github.String(r.baseBranch),
+		Author:  &github.CommitAuthor{Date: &date, Name: github.String(authorName), Email: github.String(authorEmail)},
+	}
+
+	if sha == nil {
+		_, _, err = c.Repositories.CreateFile(ctx, r.sourceOwner, r.sourceRepo, filePath, opt)
+	} else {
+		_, _, err = c.Repositories.UpdateFile(ctx, r.sourceOwner, r.sourceRepo, filePath, opt)
+	}
+	return r.wrap(StepCommit, r.baseBranch, filePath, err)
+}
@@ -0,0 +1,28 @@
+package gitbot
+
+import (
+	"context"
+
+	"github.com/google/go-github/v18/github"
+)
+
+// ClosePullRequest comments why the PR is closed, closes it and deletes its branch
+func (r *Repo) ClosePullRequest(ctx context.Context, token string, number int, comment string) error {
+	c := r.newClient(ctx, token)
+
+	if comment != "" {
+		_, _, err := c.Issues.CreateComment(ctx, r.sourceOwner, r.sourceRepo, number, &github.IssueComment{Body: github.String(comment)})
+		if err != nil {
+			return r.wrap(StepClosePR, "", "", err)
+		}
+	}
+
+	pr, _, err := c.PullRequests.Edit(ctx, r.sourceOwner, r.sourceRepo, number, &github.PullRequest{State: github.String("closed")})
+	if err != nil {
+		return r.wrap(StepClosePR, "", "", err)
+	}
+
+	branch := pr.GetHead().GetRef()
+	_, err = c.Git.DeleteRef(ctx, r.sourceOwner, r.sourceRepo, "heads/"+branch)
+	return r.wrap(StepClosePR, branch, "", err)
+}
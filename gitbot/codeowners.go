@@ -0,0 +1,111 @@
+package gitbot
+
+import (
+	"regexp"
+	"strings"
+)
+
+// CodeOwnersPaths are where GitHub looks for the CODEOWNERS, in this order
+var CodeOwnersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// CodeOwners are the rules of a CODEOWNERS file, the last matching rule of a path wins
+type CodeOwners []codeOwnersRule
+
+type codeOwnersRule struct {
+	re     *regexp.Regexp
+	owners []string
+}
+
+// ParseCodeOwners parses the CODEOWNERS, the invalid patterns are skipped like GitHub does
+func ParseCodeOwners(content string) CodeOwners {
+	var rules CodeOwners
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		re, err := codeOwnersRegexp(fields[0])
+		if err != nil {
+			continue
+		}
+		rules = append(rules, codeOwnersRule{re: re, owners: fields[1:]})
+	}
+	return rules
+}
+
+// Owners returns the owners of the paths, in the order of the paths and without duplicates
+func (c CodeOwners) Owners(paths []string) []string {
+	var owners []string
+	seen := map[string]bool{}
+	for _, p := range paths {
+		for _, owner := range c.ownersOf(p) {
+			if !seen[owner] {
+				seen[owner] = true
+				owners = append(owners, owner)
+			}
+		}
+	}
+	return owners
+}
+
+func (c CodeOwners) ownersOf(p string) []string {
+	for i := len(c) - 1; i >= 0; i-- {
+		if c[i].re.MatchString(p) {
+			return c[i].owners
+		}
+	}
+	return nil
+}
+
+// SplitOwners splits the owners into the users and the team slugs to request reviews from,
+// the owners by email can't be requested and are returned apart
+func SplitOwners(owners []string) (users, teams, others []string) {
+	for _, owner := range owners {
+		name := strings.TrimPrefix(owner, "@")
+		switch {
+		case name == owner:
+			others = append(others, owner)
+		case strings.Contains(name, "/"):
+			teams = append(teams, name[strings.Index(name, "/")+1:])
+		default:
+			users = append(users, name)
+		}
+	}
+	return users, teams, others
+}
+
+// codeOwnersRegexp follows the gitignore rules CODEOWNERS uses: a pattern with a slash is relative
+// to the root, the others match at any depth, and a directory matches everything under it
+func codeOwnersRegexp(pattern string) (*regexp.Regexp, error) {
+	pattern = strings.TrimSuffix(pattern, "/")
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	var b strings.Builder
+	b.WriteString("^")
+	if !anchored {
+		b.WriteString("(.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			b.WriteString("[^/]*")
+		case pattern[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	b.WriteString("(/.*)?$")
+	return regexp.Compile(b.String())
+}
@@ -1,65 +1,70 @@
 package gitbot
 
 import (
-	"regexp"
-	"time"
+	"context"
+	"errors"
+	"fmt"
+	"os"
 
 	"github.com/google/go-github/v18/github"
 )
 
-func (r *Release) getRef() (ref *github.Reference, err error) {
-	if ref, _, err = client.Git.GetRef(r.ctx, r.sourceOwner, r.sourceRepo, "refs/heads/"+r.commitBranch); err == nil {
+func (r *Release) getBaseRef() (*github.Reference, error) {
+	ref, _, err := r.client.Git.GetRef(r.ctx, r.sourceOwner, r.sourceRepo, "refs/heads/"+r.baseBranch)
+	return ref, err
+}
+
+func (r *Release) getRef(baseRef *github.Reference) (ref *github.Reference, err error) {
+	if ref, _, err = r.client.Git.GetRef(r.ctx, r.sourceOwner, r.sourceRepo, "refs/heads/"+r.commitBranch); err == nil {
 		return ref, nil
 	}
 
-	var baseRef *github.Reference
-	if baseRef, _, err = client.Git.GetRef(r.ctx, r.sourceOwner, r.sourceRepo, "refs/heads/"+r.baseBranch); err != nil {
-		return nil, err
-	}
 	newRef := &github.Reference{Ref: github.String("refs/heads/" + r.commitBranch), Object: &github.GitObject{SHA: baseRef.Object.SHA}}
-	ref, _, err = client.Git.CreateRef(r.ctx, r.sourceOwner, r.sourceRepo, newRef)
+	ref, _, err = r.client.Git.CreateRef(r.ctx, r.sourceOwner, r.sourceRepo, newRef)
 	return ref, err
 }
 
-func (r *Release) getTree(ref *github.Reference) (tree *github.Tree, err error) {
+// getTree puts all the changed files into a single tree on top of the base branch
+func (r *Release) getTree(baseRef *github.Reference) (tree *github.Tree, err error) {
 	entries := []github.TreeEntry{}
 
 	// Load each file into the tree.
-	for _, c := range r.Changes {
+	for _, c := range r.sortedChanges() {
 		content, err := r.getChangedContent(c, r.Repo.baseBranch)
 		if err != nil {
-			return nil, err
+			return nil, r.wrap(StepUpdateFile, r.baseBranch, c.filePath, err)
 		}
 
 		entries = append(entries, github.TreeEntry{Path: github.String(c.filePath), Type: github.String("blob"), Content: github.String(content), Mode: github.String("100644")})
 	}
 
-	tree, _, err = client.Git.CreateTree(r.ctx, r.sourceOwner, r.sourceRepo, *ref.Object.SHA, entries)
-	return tree, err
+	tree, _, err = r.client.Git.CreateTree(r.ctx, r.sourceOwner, r.sourceRepo, *baseRef.Object.SHA, entries)
+	return tree, r.wrap(StepCommit, r.commitBranch, "", err)
 }
 
-func (r *Release) pushCommit(ref *github.Reference, tree *github.Tree) (err error) {
-	parent, _, err := client.Repositories.GetCommit(r.ctx, r.sourceOwner, r.sourceRepo, *ref.Object.SHA)
+// pushCommit points the release branch to a single commit on top of the base branch,
+// so a branch left by a previous attempt doesn't pile up commits in the PR
+func (r *Release) pushCommit(ref, baseRef *github.Reference, tree *github.Tree) (err error) {
+	parent, _, err := r.client.Repositories.GetCommit(r.ctx, r.sourceOwner, r.sourceRepo, *baseRef.Object.SHA)
 	if err != nil {
 		return err
 	}
 
 	parent.Commit.SHA = parent.SHA
 
-	date := time.Now()
-	author := &github.CommitAuthor{Date: &date, Name: &r.authorName, Email: &r.authorEmail}
-	commit := &github.Commit{Author: author, Message: &r.commitMessage, Tree: tree, Parents: []github.Commit{*parent.Commit}}
-	newCommit, _, err := client.Git.CreateCommit(r.ctx, r.sourceOwner, r.sourceRepo, commit)
+	author := r.commitAuthor()
+	commit := &github.Commit{Author: author, Committer: author, Message: &r.commitMessage, Tree: tree, Parents: []github.Commit{*parent.Commit}}
+	newCommit, _, err := r.client.Git.CreateCommit(r.ctx, r.sourceOwner, r.sourceRepo, commit)
 	if err != nil {
 		return err
 	}
 
 	ref.Object.SHA = newCommit.SHA
-	_, _, err = client.Git.UpdateRef(r.ctx, r.sourceOwner, r.sourceRepo, ref, false)
+	_, _, err = r.client.Git.UpdateRef(r.ctx, r.sourceOwner, r.sourceRepo, ref, true)
 	return err
 }
 
-func (r *Release) createPR() (*string, error) {
+func (r *Release) createPR() (*github.PullRequest, error) {
 	newPR := &github.NewPullRequest{
 		Title:               github.String(r.prTitle),
 		Head:                github.String(r.commitBranch),
@@ -68,30 +73,107 @@ func (r *Release) createPR() (*string, error) {
 		MaintainerCanModify: github.Bool(true),
 	}
 
-	pr, _, err := client.PullRequests.Create(r.ctx, r.sourceOwner, r.sourceRepo, newPR)
+	pr, _, err := r.client.PullRequests.Create(r.ctx, r.sourceOwner, r.sourceRepo, newPR)
+	return pr, err
+}
+
+func (r *Release) addLabel(pr *github.PullRequest) error {
+	if r.label == "" {
+		return nil
+	}
+
+	_, _, err := r.client.Issues.AddLabelsToIssue(r.ctx, r.sourceOwner, r.sourceRepo, pr.GetNumber(), []string{r.label})
+	return err
+}
+
+// findOpenPR returns the open PR of the release branch when it carries the label of Flow
+func (r *Release) findOpenPR() (*github.PullRequest, error) {
+	if r.label == "" {
+		return nil, nil
+	}
+
+	opt := &github.PullRequestListOptions{
+		State: "open",
+		Head:  r.sourceOwner + ":" + r.commitBranch,
+		Base:  r.baseBranch,
+	}
+	prs, _, err := r.client.PullRequests.List(r.ctx, r.sourceOwner, r.sourceRepo, opt)
 	if err != nil {
 		return nil, err
 	}
 
-	return github.String(pr.GetHTMLURL()), nil
+	for _, pr := range prs {
+		if hasLabel(pr, r.label) {
+			return pr, nil
+		}
+	}
+	return nil, nil
 }
 
-func (r *Release) getChangedContent(c Change, baseBranch string) (string, error) {
-	opt := &github.RepositoryContentGetOptions{
-		Ref: baseBranch,
+func hasLabel(pr *github.PullRequest, label string) bool {
+	for _, l := range pr.Labels {
+		if l.GetName() == label {
+			return true
+		}
 	}
+	return false
+}
 
-	f, _, _, err := client.Repositories.GetContents(r.ctx, r.sourceOwner, r.sourceRepo, c.filePath, opt)
+// createTag points the tag to the commit, an existing tag is kept unless moveTag
+func (r *Release) createTag(sha string) error {
+	if r.tag == "" {
+		return nil
+	}
+
+	ref := &github.Reference{Ref: github.String("refs/tags/" + r.tag), Object: &github.GitObject{SHA: github.String(sha)}}
+	_, _, err := r.client.Git.CreateRef(r.ctx, r.sourceOwner, r.sourceRepo, ref)
+	if err == nil || !errors.Is(r.wrap(StepTag, r.tag, "", err), ErrConflict) {
+		return r.wrap(StepTag, r.tag, "", err)
+	}
+
+	if !r.moveTag {
+		fmt.Fprintf(os.Stdout, "Tag %s already exists, keeping it\n", r.tag)
+		return nil
+	}
+	_, _, err = r.client.Git.UpdateRef(r.ctx, r.sourceOwner, r.sourceRepo, ref, true)
+	return r.wrap(StepTag, r.tag, "", err)
+}
+
+func (r *Release) requestReviewers(pr *github.PullRequest) error {
+	if len(r.reviewers) == 0 && len(r.teamReviewers) == 0 {
+		return nil
+	}
+
+	reviewers := github.ReviewersRequest{
+		Reviewers:     r.reviewers,
+		TeamReviewers: r.teamReviewers,
+	}
 
+	_, _, err := r.client.PullRequests.RequestReviewers(r.ctx, r.sourceOwner, r.sourceRepo, pr.GetNumber(), reviewers)
+	return err
+}
+
+func (r *Release) getChangedContent(c Change, baseBranch string) (string, error) {
+	original, err := getContent(r.ctx, r.client, r.Repo, c.filePath, baseBranch)
+	if c.create && isNotFound(err) {
+		original, err = "", nil
+	}
 	if err != nil {
 		return "", err
 	}
 
-	original, err := f.GetContent()
+	return c.apply(original)
+}
+
+func getContent(ctx context.Context, c *github.Client, repo Repo, filePath, ref string) (string, error) {
+	opt := &github.RepositoryContentGetOptions{
+		Ref: ref,
+	}
+
+	f, _, _, err := c.Repositories.GetContents(ctx, repo.sourceOwner, repo.sourceRepo, filePath, opt)
 	if err != nil {
 		return "", err
 	}
 
-	re := regexp.MustCompile(c.regexText)
-	return re.ReplaceAllString(original, c.changedText), nil
+	return f.GetContent()
 }
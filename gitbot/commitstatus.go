@@ -0,0 +1,59 @@
+package gitbot
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/go-github/v18/github"
+)
+
+// CommitStatus is the outcome of the release of a commit of the source repository
+type CommitStatus struct {
+	// Context is the name of the status or of the check run
+	Context string
+	// State is success, failure or error (pending of the statuses, neutral of the check runs)
+	State       string
+	Description string
+	// Summary is the markdown of the check run, e.g. the links to the PRs
+	Summary   string
+	TargetURL string
+	Branch    string
+}
+
+// SetCommitStatus creates a commit status on the commit
+func (r *Repo) SetCommitStatus(ctx context.Context, token, sha string, s CommitStatus) error {
+	c := r.newClient(ctx, token)
+
+	_, _, err := c.Repositories.CreateStatus(ctx, r.sourceOwner, r.sourceRepo, sha, &github.RepoStatus{
+		State:       github.String(s.State),
+		Context:     github.String(s.Context),
+		Description: github.String(s.Description),
+		TargetURL:   github.String(s.TargetURL),
+	})
+	return r.wrap(StepStatus, s.Branch, "", err)
+}
+
+// CreateCheckRun creates a completed check run on the commit, which GitHub only allows to GitHub Apps
+func (r *Repo) CreateCheckRun(ctx context.Context, token, sha string, s CommitStatus) error {
+	c := r.newClient(ctx, token)
+
+	conclusion := s.State
+	if conclusion == "error" {
+		conclusion = "failure"
+	}
+	now := github.Timestamp{Time: time.Now()}
+	_, _, err := c.Checks.CreateCheckRun(ctx, r.sourceOwner, r.sourceRepo, github.CreateCheckRunOptions{
+		Name:        s.Context,
+		HeadBranch:  s.Branch,
+		HeadSHA:     sha,
+		DetailsURL:  github.String(s.TargetURL),
+		Status:      github.String("completed"),
+		Conclusion:  github.String(conclusion),
+		CompletedAt: &now,
+		Output: &github.CheckRunOutput{
+			Title:   github.String(s.Description),
+			Summary: github.String(s.Summary),
+		},
+	})
+	return r.wrap(StepStatus, s.Branch, "", err)
+}
@@ -0,0 +1,96 @@
+package gitbot
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/v18/github"
+)
+
+// Step is the step of a release
+type Step string
+
+const (
+	StepFindPR      Step = "find pull request"
+	StepBranch      Step = "create branch"
+	StepGetFile     Step = "get file"
+	StepUpdateFile  Step = "update file"
+	StepCommit      Step = "commit"
+	StepPullRequest Step = "open pull request"
+	StepClosePR     Step = "close pull request"
+	StepTag         Step = "tag"
+	StepAmend       Step = "amend pull request"
+	StepGetUser     Step = "get user"
+	StepOpenIssue   Step = "open issue"
+	StepGetRelease  Step = "get release"
+	StepStatus      Step = "post commit status"
+)
+
+// Errors classifying the GitHub response, use errors.Is
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+)
+
+// Error is the failure of a step of a release
+type Error struct {
+	Step   Step
+	Repo   string
+	Branch string
+	File   string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s failed on %s", e.Step, e.Repo)
+	if e.Branch != "" {
+		msg += fmt.Sprintf(" branch %s", e.Branch)
+	}
+	if e.File != "" {
+		msg += fmt.Sprintf(" file %s", e.File)
+	}
+	return fmt.Sprintf("%s: %s", msg, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is classifies the error by the HTTP status GitHub responded with
+func (e *Error) Is(target error) bool {
+	var resp *github.ErrorResponse
+	if !errors.As(e.Err, &resp) || resp.Response == nil {
+		return false
+	}
+
+	switch resp.Response.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return target == ErrUnauthorized
+	case http.StatusNotFound:
+		return target == ErrNotFound
+	case http.StatusConflict, http.StatusUnprocessableEntity:
+		return target == ErrConflict
+	}
+	return false
+}
+
+// isNotFound tells whether GitHub responded the error with 404
+func isNotFound(err error) bool {
+	var resp *github.ErrorResponse
+	return errors.As(err, &resp) && resp.Response != nil && resp.Response.StatusCode == http.StatusNotFound
+}
+
+func (r *Repo) wrap(step Step, branch, file string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{
+		Step:   step,
+		Repo:   r.sourceOwner + "/" + r.sourceRepo,
+		Branch: branch,
+		File:   file,
+		Err:    err,
+	}
+}
@@ -0,0 +1,142 @@
+package gitbot
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/v18/github"
+)
+
+// fakeGitHub serves the API of a single repository owner/manifests with the base branch main
+type fakeGitHub struct {
+	server *httptest.Server
+
+	mu sync.Mutex
+	// files are the contents of the base branch by path
+	files map[string]string
+	// trees and commits are the requests to create them, in order
+	trees   [][]github.TreeEntry
+	commits []fakeCommit
+
+	// block holds the requests to the paths starting with it until they're cancelled,
+	// received is closed on the first of them
+	block    string
+	received chan struct{}
+	once     sync.Once
+	closed   chan struct{}
+}
+
+// fakeCommit is the request to create a commit
+type fakeCommit struct {
+	Message   string               `json:"message"`
+	Tree      string               `json:"tree"`
+	Parents   []string             `json:"parents"`
+	Author    *github.CommitAuthor `json:"author"`
+	Committer *github.CommitAuthor `json:"committer"`
+}
+
+func newFakeGitHub(files map[string]string) *fakeGitHub {
+	g := &fakeGitHub{files: files, received: make(chan struct{}), closed: make(chan struct{})}
+	g.server = httptest.NewServer(http.HandlerFunc(g.serve))
+	return g
+}
+
+func (g *fakeGitHub) Close() {
+	close(g.closed)
+	g.server.Close()
+}
+
+// repo is the repository of the fake, whose requests are sent to the fake
+func (g *fakeGitHub) repo() *Repo {
+	u, _ := url.Parse(g.server.URL)
+	repo := NewRepo("owner", "manifests", "main")
+	repo.SetHTTPClient(&http.Client{Transport: rewriteHost{u}})
+	return repo
+}
+
+// rewriteHost sends the requests to api.github.com to the fake
+type rewriteHost struct {
+	u *url.URL
+}
+
+func (rt rewriteHost) RoundTrip(r *http.Request) (*http.Response, error) {
+	r.URL.Scheme = rt.u.Scheme
+	r.URL.Host = rt.u.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func (g *fakeGitHub) serve(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/repos/owner/manifests")
+
+	if g.block != "" && strings.HasPrefix(path, g.block) {
+		g.once.Do(func() { close(g.received) })
+		select {
+		case <-r.Context().Done():
+		case <-g.closed:
+		}
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodGet && path == "/pulls":
+		writeJSON(w, []github.PullRequest{})
+	case r.Method == http.MethodGet && path == "/git/refs/heads/main":
+		writeJSON(w, github.Reference{Ref: github.String("refs/heads/main"), Object: &github.GitObject{SHA: github.String("base")}})
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/git/refs/"):
+		http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+	case r.Method == http.MethodPost && path == "/git/refs":
+		var ref struct {
+			Ref string `json:"ref"`
+			SHA string `json:"sha"`
+		}
+		json.NewDecoder(r.Body).Decode(&ref)
+		writeJSON(w, github.Reference{Ref: github.String(ref.Ref), Object: &github.GitObject{SHA: github.String(ref.SHA)}})
+	case r.Method == http.MethodPatch && strings.HasPrefix(path, "/git/refs/"):
+		writeJSON(w, github.Reference{Ref: github.String("refs/" + strings.TrimPrefix(path, "/git/refs/"))})
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/contents/"):
+		content, ok := g.files[strings.TrimPrefix(path, "/contents/")]
+		if !ok {
+			http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+			return
+		}
+		writeJSON(w, github.RepositoryContent{
+			Type:     github.String("file"),
+			Encoding: github.String("base64"),
+			Content:  github.String(base64.StdEncoding.EncodeToString([]byte(content))),
+		})
+	case r.Method == http.MethodPost && path == "/git/trees":
+		var tree struct {
+			Tree []github.TreeEntry `json:"tree"`
+		}
+		json.NewDecoder(r.Body).Decode(&tree)
+		g.trees = append(g.trees, tree.Tree)
+		writeJSON(w, github.Tree{SHA: github.String(fmt.Sprintf("tree%d", len(g.trees)))})
+	case r.Method == http.MethodGet && path == "/commits/base":
+		writeJSON(w, github.RepositoryCommit{SHA: github.String("base"), Commit: &github.Commit{Message: github.String("base")}})
+	case r.Method == http.MethodPost && path == "/git/commits":
+		var commit fakeCommit
+		json.NewDecoder(r.Body).Decode(&commit)
+		g.commits = append(g.commits, commit)
+		writeJSON(w, github.Commit{SHA: github.String(fmt.Sprintf("commit%d", len(g.commits)))})
+	case r.Method == http.MethodPost && path == "/pulls":
+		writeJSON(w, github.PullRequest{Number: github.Int(1), HTMLURL: github.String("https://github.com/owner/manifests/pull/1")})
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/labels"):
+		writeJSON(w, []github.Label{})
+	default:
+		http.Error(w, fmt.Sprintf(`{"message":"unexpected %s %s"}`, r.Method, path), http.StatusNotImplemented)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,22 @@
+package gitbot
+
+import (
+	"context"
+
+	"github.com/google/go-github/v18/github"
+)
+
+// OpenIssue opens an issue with the labels and returns its URL
+func (r *Repo) OpenIssue(ctx context.Context, token, title, body string, labels []string) (string, error) {
+	c := r.newClient(ctx, token)
+
+	issue, _, err := c.Issues.Create(ctx, r.sourceOwner, r.sourceRepo, &github.IssueRequest{
+		Title:  github.String(title),
+		Body:   github.String(body),
+		Labels: &labels,
+	})
+	if err != nil {
+		return "", r.wrap(StepOpenIssue, "", "", err)
+	}
+	return issue.GetHTMLURL(), nil
+}
@@ -0,0 +1,218 @@
+package gitbot
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v18/github"
+)
+
+const checksPollInterval = 5 * time.Second
+
+// MergeState is the outcome of the auto-merge of a release PR
+type MergeState string
+
+const (
+	// MergeMerged means the PR was merged right away
+	MergeMerged MergeState = "merged"
+	// MergeQueued means branch protection blocked the merge for now,
+	// and GitHub's native auto-merge merges the PR once it's satisfied
+	MergeQueued MergeState = "queued for auto-merge"
+	// MergeFailed means the PR was left open, see Result.MergeError
+	MergeFailed MergeState = "not merged"
+)
+
+const enableAutoMergeMutation = `mutation($id: ID!, $headline: String, $body: String) {
+  enablePullRequestAutoMerge(input: {pullRequestId: $id, commitHeadline: $headline, commitBody: $body}) { clientMutationId }
+}`
+
+type AutoMerge struct {
+	autoMerge      bool
+	requiredChecks []string
+	checksTimeout  time.Duration
+	// commitTitle and commitBody are of the merge commit, GitHub's default when empty
+	commitTitle string
+	commitBody  string
+}
+
+// EnableAutoMerge merges the PR right after it's opened.
+// requiredChecks must be required by the base branch protection, and when checksTimeout
+// is set the merge waits until all of them have been reported on the PR head.
+func (r *Release) EnableAutoMerge(requiredChecks []string, checksTimeout time.Duration) {
+	r.AutoMerge = AutoMerge{
+		autoMerge:      true,
+		requiredChecks: requiredChecks,
+		checksTimeout:  checksTimeout,
+	}
+}
+
+// SetMergeCommit sets the title and the body of the commit of the auto-merge, both when merging
+// right away and when GitHub's native auto-merge merges it later
+func (r *Release) SetMergeCommit(title, body string) {
+	r.AutoMerge.commitTitle = title
+	r.AutoMerge.commitBody = body
+}
+
+func (r *Release) merge(pr *github.PullRequest) (MergeState, error) {
+	required, err := r.getRequiredChecks()
+	if err != nil {
+		return MergeFailed, err
+	}
+
+	sha := pr.GetHead().GetSHA()
+	if r.checksTimeout > 0 {
+		if err := r.waitForChecks(sha, required); err != nil {
+			return MergeFailed, err
+		}
+	}
+
+	opt := &github.PullRequestOptions{SHA: sha, CommitTitle: r.commitTitle}
+	_, _, err = r.client.PullRequests.Merge(r.ctx, r.sourceOwner, r.sourceRepo, pr.GetNumber(), r.commitBody, opt)
+	if err == nil {
+		return MergeMerged, nil
+	}
+
+	// Branch protection rejects the merge until the checks pass and the reviews are met,
+	// so leave it to GitHub's native auto-merge
+	if !isMergeBlocked(err) {
+		return MergeFailed, err
+	}
+	if err := r.enableNativeAutoMerge(pr); err != nil {
+		return MergeFailed, fmt.Errorf("merge is blocked and auto-merge could not be enabled: %s", err)
+	}
+	return MergeQueued, nil
+}
+
+func isMergeBlocked(err error) bool {
+	var resp *github.ErrorResponse
+	return errors.As(err, &resp) && resp.Response != nil && resp.Response.StatusCode == http.StatusMethodNotAllowed
+}
+
+// enableNativeAutoMerge is only available through the GraphQL API
+func (r *Release) enableNativeAutoMerge(pr *github.PullRequest) error {
+	body := map[string]interface{}{
+		"query": enableAutoMergeMutation,
+		"variables": map[string]interface{}{
+			"id":       pr.GetNodeID(),
+			"headline": nullable(r.commitTitle),
+			"body":     nullable(r.commitBody),
+		},
+	}
+
+	req, err := r.client.NewRequest("POST", "graphql", body)
+	if err != nil {
+		return err
+	}
+
+	var resp struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if _, err := r.client.Do(r.ctx, req, &resp); err != nil {
+		return err
+	}
+
+	if len(resp.Errors) > 0 {
+		var msgs []string
+		for _, e := range resp.Errors {
+			msgs = append(msgs, e.Message)
+		}
+		return errors.New(strings.Join(msgs, ", "))
+	}
+	return nil
+}
+
+// getRequiredChecks makes sure the base branch can't be merged unprotected
+func (r *Release) getRequiredChecks() ([]string, error) {
+	checks, _, err := r.client.Repositories.GetRequiredStatusChecks(r.ctx, r.sourceOwner, r.sourceRepo, r.baseBranch)
+	if err != nil {
+		return nil, fmt.Errorf("could not get required status checks of %s: %s", r.baseBranch, err)
+	}
+
+	if len(checks.Contexts) == 0 {
+		return nil, fmt.Errorf("%s has no required status checks", r.baseBranch)
+	}
+
+	for _, check := range r.requiredChecks {
+		if !contains(checks.Contexts, check) {
+			return nil, fmt.Errorf("%s is not a required status check of %s", check, r.baseBranch)
+		}
+	}
+
+	return checks.Contexts, nil
+}
+
+func (r *Release) waitForChecks(sha string, checks []string) error {
+	deadline := time.Now().Add(r.checksTimeout)
+
+	for {
+		reported, err := r.getReportedChecks(sha)
+		if err != nil {
+			return err
+		}
+
+		var missing []string
+		for _, check := range checks {
+			if !contains(reported, check) {
+				missing = append(missing, check)
+			}
+		}
+		if len(missing) == 0 {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("status checks were not reported: %s", strings.Join(missing, ", "))
+		}
+
+		select {
+		case <-r.ctx.Done():
+			return r.ctx.Err()
+		case <-time.After(checksPollInterval):
+		}
+	}
+}
+
+// getReportedChecks lists both commit statuses and check runs in any state
+func (r *Release) getReportedChecks(sha string) ([]string, error) {
+	var reported []string
+
+	status, _, err := r.client.Repositories.GetCombinedStatus(r.ctx, r.sourceOwner, r.sourceRepo, sha, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range status.Statuses {
+		reported = append(reported, s.GetContext())
+	}
+
+	runs, _, err := r.client.Checks.ListCheckRunsForRef(r.ctx, r.sourceOwner, r.sourceRepo, sha, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, run := range runs.CheckRuns {
+		reported = append(reported, run.GetName())
+	}
+
+	return reported, nil
+}
+
+// nullable leaves the empty GraphQL variables to GitHub's default
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
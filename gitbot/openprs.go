@@ -0,0 +1,20 @@
+package gitbot
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v18/github"
+)
+
+// CountOpenPRs counts the open PRs of the repository with the label, with a single search
+func (r *Repo) CountOpenPRs(ctx context.Context, token, label string) (int, error) {
+	c := r.newClient(ctx, token)
+
+	q := fmt.Sprintf("repo:%s is:pr is:open label:%q", r.FullName(), label)
+	result, _, err := c.Search.Issues(ctx, q, &github.SearchOptions{ListOptions: github.ListOptions{PerPage: 1}})
+	if err != nil {
+		return 0, r.wrap(StepFindPR, "", "", err)
+	}
+	return result.GetTotal(), nil
+}
@@ -0,0 +1,31 @@
+package gitbot
+
+import (
+	"context"
+)
+
+// PRState is the state of a PR, merged and closed (without being merged) are final
+type PRState string
+
+const (
+	PROpen   PRState = "open"
+	PRMerged PRState = "merged"
+	PRClosed PRState = "closed"
+)
+
+// GetPRState returns the state of the PR
+func (r *Repo) GetPRState(ctx context.Context, token string, number int) (PRState, error) {
+	c := r.newClient(ctx, token)
+
+	pr, _, err := c.PullRequests.Get(ctx, r.sourceOwner, r.sourceRepo, number)
+	if err != nil {
+		return "", r.wrap(StepFindPR, "", "", err)
+	}
+	switch {
+	case pr.GetMerged():
+		return PRMerged, nil
+	case pr.GetState() == "closed":
+		return PRClosed, nil
+	}
+	return PROpen, nil
+}
@@ -4,23 +4,44 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"time"
 
 	"github.com/google/go-github/v18/github"
 	"golang.org/x/oauth2"
 )
 
 type Release struct {
-	ctx context.Context
+	ctx    context.Context
+	client *github.Client
 	Repo
 	Author
 	PullRequest
+	AutoMerge
 	Changes []Change
 }
 
+// Result is the outcome of a release
+type Result struct {
+	URL    string
+	Number int
+	// Merge is empty unless auto-merge is enabled
+	Merge MergeState
+	// MergeError is why an auto-merge PR was left open
+	MergeError error
+	// Amended is set when an open PR was updated in place instead of opening one
+	Amended bool
+	// Reopened is set when a closed PR of the branch was reopened instead of opening one
+	Reopened bool
+}
+
 type Repo struct {
 	sourceOwner string
 	sourceRepo  string
 	baseBranch  string
+	httpClient  *http.Client
 }
 
 type PullRequest struct {
@@ -28,20 +49,39 @@ type PullRequest struct {
 	commitMessage string
 	prTitle       string
 	prBody        string
+	reviewers     []string
+	teamReviewers []string
+	label         string
+	// tag marks the release commit, moveTag moves an existing tag instead of keeping it
+	tag     string
+	moveTag bool
+	// amendPrefix is the branch prefix of the open PRs amended instead of opening another one
+	amendPrefix string
+	// reopenWithin is how recently the closed PRs of the branch are reopened
+	reopenWithin time.Duration
 }
 
 type Author struct {
 	authorName  string
 	authorEmail string
+	// date is of the author and the committer, the time of the commit when zero
+	date time.Time
 }
 
 type Change struct {
-	filePath    string
-	regexText   string
-	changedText string
+	filePath string
+	updater  Updater
+	// create reads the file as empty when it's missing instead of failing
+	create bool
 }
 
-var client *github.Client
+// FileChange is the content of a file before and after the release
+type FileChange struct {
+	Path    string
+	Before  string
+	After   string
+	Changed bool
+}
 
 func NewRepo(sourceOwner, sourceRepo, baseBranch string) *Repo {
 	return &Repo{
@@ -67,43 +107,263 @@ func NewRelease(repo Repo, appName, appEnv, appVersion, prBody string) *Release
 	}
 }
 
+// SetPullRequest replaces the branch, the subject and the body of the PR, e.g. for combined releases
+func (r *Release) SetPullRequest(branch, subject, prBody string) {
+	r.PullRequest.commitBranch = branch
+	r.PullRequest.commitMessage = subject
+	r.PullRequest.prTitle = subject
+	r.PullRequest.prBody = prBody
+}
+
+// Combine adds the changes of the other release, which must be of the same repository and base branch
+func (r *Release) Combine(other *Release) {
+	r.Changes = append(r.Changes, other.Changes...)
+}
+
 func (r *Release) AddAuthor(authorName, authorEmail string) {
 	r.Author.authorName = authorName
 	r.Author.authorEmail = authorEmail
 }
 
+// SetCommitDate dates the commit of the release instead of the time of the commit, e.g. the build
+func (r *Release) SetCommitDate(date time.Time) {
+	r.Author.date = date
+}
+
+// commitAuthor is the author of the release commit, who is also the committer
+func (a Author) commitAuthor() *github.CommitAuthor {
+	date := a.date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	return &github.CommitAuthor{Date: &date, Name: github.String(a.authorName), Email: github.String(a.authorEmail)}
+}
+
+func (r *Release) AddReviewers(reviewers, teamReviewers []string) {
+	r.PullRequest.reviewers = reviewers
+	r.PullRequest.teamReviewers = teamReviewers
+}
+
 func (r *Release) AddChanges(filePath, regexText, changedText string) {
+	r.AddUpdate(filePath, NewRegexUpdater(regexText, changedText))
+}
+
+// AddLabel marks the PR as created by Flow, the label is created by GitHub when missing
+func (r *Release) AddLabel(label string) {
+	r.PullRequest.label = label
+}
+
+// AddTag creates a lightweight tag on the release commit once the PR is opened
+func (r *Release) AddTag(tag string, move bool) {
+	r.PullRequest.tag = tag
+	r.PullRequest.moveTag = move
+}
+
+// AddFile writes the whole content of the file, which is created when missing
+func (r *Release) AddFile(filePath, content string) {
 	r.Changes = append(r.Changes, Change{
-		filePath:    filePath,
-		regexText:   regexText,
-		changedText: changedText,
+		filePath: filePath,
+		updater:  contentUpdater(content),
+		create:   true,
 	})
 }
 
-func (r *Release) Create(ctx context.Context, token string) (*string, error) {
-	r.ctx = ctx
+// AddUpdate changes the file with the update strategy of the Updater
+func (r *Release) AddUpdate(filePath string, u Updater) {
+	r.Changes = append(r.Changes, Change{
+		filePath: filePath,
+		updater:  u,
+	})
+}
+
+// FullName is the owner/name of the repository
+func (r Repo) FullName() string {
+	return r.sourceOwner + "/" + r.sourceRepo
+}
+
+// BaseBranch is the branch the PRs are opened against
+func (r Repo) BaseBranch() string {
+	return r.baseBranch
+}
+
+// Branch is the branch the PR is opened from
+func (r *Release) Branch() string {
+	return r.commitBranch
+}
+
+// Paths are the files changed by the release, sorted
+func (r *Release) Paths() []string {
+	var paths []string
+	for _, c := range r.sortedChanges() {
+		paths = append(paths, c.filePath)
+	}
+	return paths
+}
+
+// Title is the title of the PR
+func (r *Release) Title() string {
+	return r.prTitle
+}
+
+// SetHTTPClient sets the client the authenticated GitHub client is built on
+func (r *Repo) SetHTTPClient(c *http.Client) {
+	r.httpClient = c
+}
+
+// GetContent returns the content of the file on the base branch
+func (r *Repo) GetContent(ctx context.Context, token, filePath string) (string, error) {
+	content, err := getContent(ctx, r.newClient(ctx, token), *r, filePath, r.baseBranch)
+	return content, r.wrap(StepGetFile, r.baseBranch, filePath, err)
+}
+
+func (r *Repo) newClient(ctx context.Context, token string) *github.Client {
+	if r.httpClient != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, r.httpClient)
+	}
 	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
 	tc := oauth2.NewClient(ctx, ts)
-	client = github.NewClient(tc)
+	return github.NewClient(tc)
+}
 
-	fmt.Printf("%#v", r)
+// sortedChanges merges the changes of the same file in the order they were added and sorts
+// them by the path, so that the commits and the previews are the same on every run
+func (r *Release) sortedChanges() []Change {
+	var changes []Change
+	index := map[string]int{}
+	for _, c := range r.Changes {
+		if i, ok := index[c.filePath]; ok {
+			changes[i].updater = chainUpdater{changes[i].updater, c.updater}
+			changes[i].create = changes[i].create || c.create
+			continue
+		}
+		index[c.filePath] = len(changes)
+		changes = append(changes, c)
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].filePath < changes[j].filePath
+	})
+	return changes
+}
+
+func (c Change) apply(content string) (string, error) {
+	return c.updater.Update(content)
+}
+
+// Preview computes the changes from the base branch without writing anything
+func (r *Release) Preview(ctx context.Context, token string) ([]FileChange, error) {
+	c := r.newClient(ctx, token)
+	return r.PreviewFrom(func(filePath string) (string, error) {
+		return getContent(ctx, c, r.Repo, filePath, r.baseBranch)
+	})
+}
+
+// PreviewFrom computes the changes from the contents returned by get, e.g. of a fake repository
+func (r *Release) PreviewFrom(get func(filePath string) (string, error)) ([]FileChange, error) {
+	var changes []FileChange
+	for _, change := range r.sortedChanges() {
+		before, err := get(change.filePath)
+		if change.create && isNotFound(err) {
+			before, err = "", nil
+		}
+		if err != nil {
+			return nil, r.wrap(StepGetFile, r.baseBranch, change.filePath, err)
+		}
+
+		after, err := change.apply(before)
+		if err != nil {
+			return nil, r.wrap(StepUpdateFile, r.baseBranch, change.filePath, err)
+		}
 
-	ref, err := r.getRef()
+		changes = append(changes, FileChange{
+			Path:    change.filePath,
+			Before:  before,
+			After:   after,
+			Changed: before != after,
+		})
+	}
+
+	return changes, nil
+}
+
+// Create opens the PR of the release. Every request to GitHub is made with ctx, so cancelling it or
+// its deadline aborts the request in flight, and the error matches context.Canceled or
+// context.DeadlineExceeded with errors.Is. A release cancelled before the PR is opened may leave
+// the branch behind, which the next attempt resets.
+func (r *Release) Create(ctx context.Context, token string) (*Result, error) {
+	r.ctx = ctx
+	r.client = r.newClient(ctx, token)
+
+	// The same release is already open, e.g. when the event was redelivered
+	existing, err := r.findOpenPR()
 	if err != nil {
-		return nil, err
+		return nil, r.wrap(StepFindPR, r.commitBranch, "", err)
+	}
+	if existing != nil {
+		return &Result{URL: existing.GetHTMLURL(), Number: existing.GetNumber()}, nil
+	}
+
+	// An open PR of an older version is updated in place
+	amendable, err := r.findAmendablePR()
+	if err != nil {
+		return nil, r.wrap(StepFindPR, r.commitBranch, "", err)
+	}
+	if amendable != nil {
+		return r.amend(amendable)
+	}
+
+	baseRef, err := r.getBaseRef()
+	if err != nil {
+		return nil, r.wrap(StepBranch, r.baseBranch, "", err)
+	}
+
+	ref, err := r.getRef(baseRef)
+	if err != nil {
+		return nil, r.wrap(StepBranch, r.commitBranch, "", err)
 	}
 	if ref == nil {
-		return nil, errors.New("git reference was nil ")
+		return nil, r.wrap(StepBranch, r.commitBranch, "", errors.New("git reference was nil "))
 	}
 
-	tree, err := r.getTree(ref)
+	// getTree wraps the errors of each file
+	tree, err := r.getTree(baseRef)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := r.pushCommit(ref, tree); err != nil {
-		return nil, err
+	if err := r.pushCommit(ref, baseRef, tree); err != nil {
+		return nil, r.wrap(StepCommit, r.commitBranch, "", err)
+	}
+
+	pr, reopened, err := r.openPR()
+	if err != nil {
+		return nil, r.wrap(StepPullRequest, r.commitBranch, "", err)
+	}
+
+	result := &Result{URL: pr.GetHTMLURL(), Number: pr.GetNumber(), Reopened: reopened}
+
+	// The PR is already open, the rest is skipped to return promptly once the context is done
+	if err := ctx.Err(); err != nil {
+		if r.autoMerge {
+			result.Merge, result.MergeError = MergeFailed, err
+		}
+		return result, nil
+	}
+
+	// Failing to label the PR or to request reviewers is not fatal
+	if err := r.addLabel(pr); err != nil {
+		fmt.Fprintf(os.Stderr, "Error labeling %s: %s\n", pr.GetHTMLURL(), err)
+	}
+	if err := r.requestReviewers(pr); err != nil {
+		fmt.Fprintf(os.Stderr, "Error requesting reviewers for %s: %s\n", pr.GetHTMLURL(), err)
+	}
+	if err := r.createTag(*ref.Object.SHA); err != nil {
+		fmt.Fprintf(os.Stderr, "Error tagging %s: %s\n", pr.GetHTMLURL(), err)
+	}
+
+	if r.autoMerge {
+		result.Merge, result.MergeError = r.merge(pr)
 	}
 
-	return r.createPR()
+	return result, nil
 }
@@ -0,0 +1,236 @@
+package gitbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v18/github"
+)
+
+// newTestRelease updates the image of the files of the fake
+func newTestRelease(g *fakeGitHub, paths ...string) *Release {
+	r := NewRelease(*g.repo(), "app", "prod", "v1.1.0", "")
+	r.AddAuthor("flow", "flow@example.com")
+	for _, path := range paths {
+		r.AddUpdate(path, NewYAMLImageUpdater("gcr.io/project/app", "v1.1.0"))
+	}
+	return r
+}
+
+// testFiles are the deployments of n envs
+func testFiles(n int) (map[string]string, []string) {
+	files := map[string]string{}
+	var paths []string
+	for i := 0; i < n; i++ {
+		path := fmt.Sprintf("env%d/deployment.yaml", i)
+		files[path] = "image: gcr.io/project/app:v1.0.0\n"
+		paths = append(paths, path)
+	}
+	return files, paths
+}
+
+func TestCreateSingleCommit(t *testing.T) {
+	for _, n := range []int{1, 2, 5} {
+		files, paths := testFiles(n)
+		g := newFakeGitHub(files)
+
+		result, err := newTestRelease(g, paths...).Create(context.Background(), "token")
+		g.Close()
+		if err != nil {
+			t.Errorf("%d files: %s", n, err)
+			continue
+		}
+		if result.URL != "https://github.com/owner/manifests/pull/1" {
+			t.Errorf("%d files: opened %+v", n, result)
+		}
+		if len(g.commits) != 1 || len(g.trees) != 1 {
+			t.Errorf("%d files: %d commits of %d trees, want one", n, len(g.commits), len(g.trees))
+			continue
+		}
+		if len(g.trees[0]) != n {
+			t.Errorf("%d files: the commit has %d files", n, len(g.trees[0]))
+		}
+		if c := g.commits[0]; c.Tree != "tree1" || len(c.Parents) != 1 || c.Parents[0] != "base" {
+			t.Errorf("%d files: commit %+v, want tree1 on top of base", n, c)
+		}
+		for _, e := range g.trees[0] {
+			if e.GetContent() != "image: gcr.io/project/app:v1.1.0\n" {
+				t.Errorf("%d files: %s is %q", n, e.GetPath(), e.GetContent())
+			}
+		}
+	}
+}
+
+// reversed are the paths in the opposite order
+func reversed(paths []string) []string {
+	var r []string
+	for i := len(paths) - 1; i >= 0; i-- {
+		r = append(r, paths[i])
+	}
+	return r
+}
+
+func TestSortedChanges(t *testing.T) {
+	files, paths := testFiles(5)
+	get := func(filePath string) (string, error) { return files[filePath], nil }
+
+	tests := []struct {
+		name  string
+		paths []string
+	}{
+		{"added in order", paths},
+		{"added in reverse", reversed(paths)},
+		{"added twice", append(reversed(paths), paths[2], paths[0])},
+	}
+	for _, tt := range tests {
+		r := NewRelease(*NewRepo("owner", "manifests", "main"), "app", "prod", "v1.1.0", "")
+		for _, path := range tt.paths {
+			r.AddUpdate(path, NewYAMLImageUpdater("gcr.io/project/app", "v1.1.0"))
+		}
+		if got := r.Paths(); !reflect.DeepEqual(got, paths) {
+			t.Errorf("%s: paths %q, want %q", tt.name, got, paths)
+		}
+		changes, err := r.PreviewFrom(get)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		var previewed []string
+		for _, c := range changes {
+			previewed = append(previewed, c.Path)
+			if c.After != "image: gcr.io/project/app:v1.1.0\n" {
+				t.Errorf("%s: previewed %s as %q", tt.name, c.Path, c.After)
+			}
+		}
+		if !reflect.DeepEqual(previewed, paths) {
+			t.Errorf("%s: previewed %q, want %q", tt.name, previewed, paths)
+		}
+	}
+}
+
+func TestCreateSortedTree(t *testing.T) {
+	files, paths := testFiles(5)
+
+	var trees [][]string
+	for _, order := range [][]string{paths, reversed(paths)} {
+		g := newFakeGitHub(files)
+		_, err := newTestRelease(g, order...).Create(context.Background(), "token")
+		g.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(g.trees) != 1 {
+			t.Fatalf("created %d trees, want one", len(g.trees))
+		}
+
+		var tree []string
+		for _, e := range g.trees[0] {
+			tree = append(tree, e.GetPath()+" "+e.GetContent())
+		}
+		if !sort.StringsAreSorted(tree) {
+			t.Errorf("tree of %q is not sorted: %q", order, tree)
+		}
+		trees = append(trees, tree)
+	}
+	if !reflect.DeepEqual(trees[0], trees[1]) {
+		t.Errorf("trees differ by the order of the changes: %q and %q", trees[0], trees[1])
+	}
+}
+
+func TestCommitDate(t *testing.T) {
+	build := time.Date(2019, 3, 14, 9, 26, 53, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		date time.Time
+	}{
+		{"date of the build", build},
+		{"now by default", time.Time{}},
+	}
+	for _, tt := range tests {
+		files, paths := testFiles(1)
+		g := newFakeGitHub(files)
+		r := newTestRelease(g, paths...)
+		if !tt.date.IsZero() {
+			r.SetCommitDate(tt.date)
+		}
+
+		start := time.Now().Add(-time.Second)
+		_, err := r.Create(context.Background(), "token")
+		end := time.Now().Add(time.Second)
+		g.Close()
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if len(g.commits) != 1 {
+			t.Errorf("%s: %d commits, want one", tt.name, len(g.commits))
+			continue
+		}
+
+		c := g.commits[0]
+		for role, a := range map[string]*github.CommitAuthor{"author": c.Author, "committer": c.Committer} {
+			if a == nil || a.Date == nil {
+				t.Errorf("%s: the %s has no date", tt.name, role)
+				continue
+			}
+			if a.GetName() != "flow" || a.GetEmail() != "flow@example.com" {
+				t.Errorf("%s: the %s is %s <%s>", tt.name, role, a.GetName(), a.GetEmail())
+			}
+			if tt.date.IsZero() {
+				if a.Date.Before(start) || a.Date.After(end) {
+					t.Errorf("%s: the %s is dated %s, want now", tt.name, role, a.Date)
+				}
+			} else if !a.Date.Equal(tt.date) {
+				t.Errorf("%s: the %s is dated %s, want %s", tt.name, role, a.Date, tt.date)
+			}
+		}
+	}
+}
+
+func TestCreateCancelled(t *testing.T) {
+	tests := []struct {
+		name  string
+		block string
+		step  Step
+	}{
+		{"creating the branch", "/git/refs", StepBranch},
+		{"creating the tree", "/git/trees", StepCommit},
+		{"creating the commit", "/git/commits", StepCommit},
+		{"opening the PR", "/pulls", StepPullRequest},
+	}
+	for _, tt := range tests {
+		files, paths := testFiles(2)
+		g := newFakeGitHub(files)
+		g.block = tt.block
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-g.received
+			cancel()
+		}()
+
+		start := time.Now()
+		_, err := newTestRelease(g, paths...).Create(ctx, "token")
+		elapsed := time.Since(start)
+		cancel()
+		g.Close()
+
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: created with %v, want context.Canceled", tt.name, err)
+			continue
+		}
+		var gerr *Error
+		if !errors.As(err, &gerr) || gerr.Step != tt.step {
+			t.Errorf("%s: failed with %v, want the step %s", tt.name, err, tt.step)
+		}
+		if elapsed > 5*time.Second {
+			t.Errorf("%s: returned after %s", tt.name, elapsed)
+		}
+	}
+}
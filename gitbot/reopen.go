@@ -0,0 +1,73 @@
+package gitbot
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/go-github/v18/github"
+)
+
+// ReopenClosedPR reopens the PR of Flow of the same branch which was closed without being merged
+// within the duration, instead of opening another PR
+func (r *Release) ReopenClosedPR(within time.Duration) {
+	r.PullRequest.reopenWithin = within
+}
+
+// findClosedPR returns the unmerged PR of Flow of the branch closed within reopenWithin
+func (r *Release) findClosedPR() (*github.PullRequest, error) {
+	if r.reopenWithin <= 0 || r.label == "" {
+		return nil, nil
+	}
+
+	opt := &github.PullRequestListOptions{
+		State:     "closed",
+		Head:      r.sourceOwner + ":" + r.commitBranch,
+		Base:      r.baseBranch,
+		Sort:      "updated",
+		Direction: "desc",
+	}
+	prs, _, err := r.client.PullRequests.List(r.ctx, r.sourceOwner, r.sourceRepo, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pr := range prs {
+		if pr.MergedAt != nil || !hasLabel(pr, r.label) {
+			continue
+		}
+		if time.Since(pr.GetClosedAt()) <= r.reopenWithin {
+			return pr, nil
+		}
+	}
+	return nil, nil
+}
+
+// reopen reopens the closed PR with the title and the body of the release, the branch is already pushed
+func (r *Release) reopen(pr *github.PullRequest) (*github.PullRequest, error) {
+	reopened, _, err := r.client.PullRequests.Edit(r.ctx, r.sourceOwner, r.sourceRepo, pr.GetNumber(), &github.PullRequest{
+		State: github.String("open"),
+		Title: github.String(r.prTitle),
+		Body:  github.String(r.prBody),
+	})
+	return reopened, err
+}
+
+// openPR reopens the closed PR of the branch when there is one, or opens a new one. GitHub refuses
+// to reopen some PRs, e.g. of the branches which were recreated, which are opened anew.
+func (r *Release) openPR() (*github.PullRequest, bool, error) {
+	closed, err := r.findClosedPR()
+	if err != nil {
+		return nil, false, err
+	}
+	if closed != nil {
+		pr, err := r.reopen(closed)
+		if err == nil {
+			return pr, true, nil
+		}
+		fmt.Fprintf(os.Stderr, "Error reopening %s, opening a new PR: %s\n", closed.GetHTMLURL(), err)
+	}
+
+	pr, err := r.createPR()
+	return pr, false, err
+}
@@ -0,0 +1,40 @@
+package gitbot
+
+import (
+	"context"
+	"errors"
+)
+
+// SourceRelease is the GitHub release of a tag
+type SourceRelease struct {
+	Name       string
+	Body       string
+	Draft      bool
+	Prerelease bool
+}
+
+// ReleaseExists tells whether the repository has a GitHub release of the tag
+func (r *Repo) ReleaseExists(ctx context.Context, token, tag string) (bool, error) {
+	release, err := r.GetRelease(ctx, token, tag)
+	return release != nil, err
+}
+
+// GetRelease returns the GitHub release of the tag, nil when there is none
+func (r *Repo) GetRelease(ctx context.Context, token, tag string) (*SourceRelease, error) {
+	c := r.newClient(ctx, token)
+
+	release, _, err := c.Repositories.GetReleaseByTag(ctx, r.sourceOwner, r.sourceRepo, tag)
+	if err != nil {
+		err = r.wrap(StepGetRelease, "", "", err)
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &SourceRelease{
+		Name:       release.GetName(),
+		Body:       release.GetBody(),
+		Draft:      release.GetDraft(),
+		Prerelease: release.GetPrerelease(),
+	}, nil
+}
@@ -0,0 +1,167 @@
+package gitbot
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Updater rewrites the content of a file for a release
+type Updater interface {
+	Update(content string) (string, error)
+}
+
+type regexUpdater struct {
+	regexText   string
+	changedText string
+	first       bool
+}
+
+// NewRegexUpdater replaces the matches of the pattern, expanding $1 etc. of the text
+func NewRegexUpdater(regexText, changedText string) Updater {
+	return regexUpdater{regexText: regexText, changedText: changedText}
+}
+
+func (u regexUpdater) Update(content string) (string, error) {
+	re, err := regexp.Compile(u.regexText)
+	if err != nil {
+		return "", err
+	}
+	return replace(re, content, u.changedText, u.first), nil
+}
+
+func (u regexUpdater) firstOnly() Updater {
+	u.first = true
+	return u
+}
+
+// FirstMatchOnly makes the updater replace only the first match of each file instead of all of them,
+// the updaters which don't replace matches are returned as they are
+func FirstMatchOnly(u Updater) Updater {
+	if f, ok := u.(interface{ firstOnly() Updater }); ok {
+		return f.firstOnly()
+	}
+	return u
+}
+
+// replace replaces every match of the pattern, or the first one
+func replace(re *regexp.Regexp, content, replacement string, first bool) string {
+	if !first {
+		return re.ReplaceAllString(content, replacement)
+	}
+
+	loc := re.FindStringSubmatchIndex(content)
+	if loc == nil {
+		return content
+	}
+	replaced := re.ExpandString(nil, replacement, content, loc)
+	return content[:loc[0]] + string(replaced) + content[loc[1]:]
+}
+
+// contentUpdater replaces the whole content of the file
+type contentUpdater string
+
+func (u contentUpdater) Update(content string) (string, error) {
+	return string(u), nil
+}
+
+// chainUpdater applies the updaters in order
+type chainUpdater []Updater
+
+func (u chainUpdater) Update(content string) (string, error) {
+	for _, updater := range u {
+		var err error
+		if content, err = updater.Update(content); err != nil {
+			return "", err
+		}
+	}
+	return content, nil
+}
+
+// yamlImageUpdater rewrites the tag or the digest of the image values of `image` keys in place.
+// The document is never re-marshaled, so anchors, aliases, merge keys and
+// comments are kept byte for byte.
+type yamlImageUpdater struct {
+	re          *regexp.Regexp
+	replacement string
+	first       bool
+}
+
+func NewYAMLImageUpdater(image, tag string) Updater {
+	return NewYAMLImageRefUpdater(image, image+":"+tag)
+}
+
+// NewYAMLImageDigestUpdater pins the image by the digest (sha256:...)
+func NewYAMLImageDigestUpdater(image, digest string) Updater {
+	return NewYAMLImageRefUpdater(image, image+"@"+digest)
+}
+
+// NewYAMLImageRefUpdater replaces the image values of the image with the whole reference as is
+func NewYAMLImageRefUpdater(image, ref string) Updater {
+	re := regexp.MustCompile(fmt.Sprintf(
+		`(?m)^(\s*(?:-\s+)?image:\s+(?:&\S+\s+)?["']?)%s(?:[:@][^\s"'#]*)?(["']?(?:\s+#.*)?\s*)$`,
+		regexp.QuoteMeta(image),
+	))
+
+	return yamlImageUpdater{
+		re:          re,
+		replacement: "${1}" + strings.Replace(ref, "$", "$$", -1) + "${2}",
+	}
+}
+
+func (u yamlImageUpdater) Update(content string) (string, error) {
+	return replace(u.re, content, u.replacement, u.first), nil
+}
+
+func (u yamlImageUpdater) firstOnly() Updater {
+	u.first = true
+	return u
+}
+
+// insertUpdater inserts a block after the first line matching the pattern,
+// or at the end of the file when there is no pattern
+type insertUpdater struct {
+	after *regexp.Regexp
+	block string
+}
+
+// NewInsertUpdater inserts the block after the line matching after, which appends it when empty
+func NewInsertUpdater(after, block string) (Updater, error) {
+	u := insertUpdater{block: block}
+	if !strings.HasSuffix(u.block, "\n") {
+		u.block += "\n"
+	}
+	if after == "" {
+		return u, nil
+	}
+
+	re, err := regexp.Compile("(?m)" + after + ".*$")
+	if err != nil {
+		return nil, err
+	}
+	u.after = re
+	return u, nil
+}
+
+func (u insertUpdater) Update(content string) (string, error) {
+	if u.after == nil {
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		return content + u.block, nil
+	}
+
+	loc := u.after.FindStringIndex(content)
+	if loc == nil {
+		return "", fmt.Errorf("no line matches %s", u.after)
+	}
+
+	end := loc[1]
+	if end < len(content) {
+		end++ // the newline of the matched line
+	} else {
+		content += "\n"
+		end = len(content)
+	}
+	return content[:end] + u.block + content[end:], nil
+}
@@ -0,0 +1,180 @@
+package gitbot
+
+import "testing"
+
+const anchored = `# the defaults of the containers
+x-defaults: &defaults
+  imagePullPolicy: IfNotPresent
+  image: &image gcr.io/project/app:v1.0.0 # bumped by flow
+---
+apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    spec:
+      initContainers:
+      - <<: *defaults
+        name: migrate
+        image: "gcr.io/project/app:v1.0.0"
+      containers:
+      - <<: *defaults
+        name: app
+        image: *image
+      - name: worker
+        image: gcr.io/project/app-worker:v1.0.0
+      - name: sidecar
+        image: 'gcr.io/project/app@sha256:0000'
+`
+
+func TestYAMLImageUpdater(t *testing.T) {
+	tests := []struct {
+		name    string
+		updater Updater
+		want    string
+	}{
+		{
+			name:    "tag",
+			updater: NewYAMLImageUpdater("gcr.io/project/app", "v1.1.0"),
+			want: `# the defaults of the containers
+x-defaults: &defaults
+  imagePullPolicy: IfNotPresent
+  image: &image gcr.io/project/app:v1.1.0 # bumped by flow
+---
+apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    spec:
+      initContainers:
+      - <<: *defaults
+        name: migrate
+        image: "gcr.io/project/app:v1.1.0"
+      containers:
+      - <<: *defaults
+        name: app
+        image: *image
+      - name: worker
+        image: gcr.io/project/app-worker:v1.0.0
+      - name: sidecar
+        image: 'gcr.io/project/app:v1.1.0'
+`,
+		},
+		{
+			name:    "digest",
+			updater: NewYAMLImageDigestUpdater("gcr.io/project/app", "sha256:1111"),
+			want: `# the defaults of the containers
+x-defaults: &defaults
+  imagePullPolicy: IfNotPresent
+  image: &image gcr.io/project/app@sha256:1111 # bumped by flow
+---
+apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    spec:
+      initContainers:
+      - <<: *defaults
+        name: migrate
+        image: "gcr.io/project/app@sha256:1111"
+      containers:
+      - <<: *defaults
+        name: app
+        image: *image
+      - name: worker
+        image: gcr.io/project/app-worker:v1.0.0
+      - name: sidecar
+        image: 'gcr.io/project/app@sha256:1111'
+`,
+		},
+		{
+			name:    "first only",
+			updater: FirstMatchOnly(NewYAMLImageUpdater("gcr.io/project/app", "v1.1.0")),
+			want: `# the defaults of the containers
+x-defaults: &defaults
+  imagePullPolicy: IfNotPresent
+  image: &image gcr.io/project/app:v1.1.0 # bumped by flow
+---
+apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    spec:
+      initContainers:
+      - <<: *defaults
+        name: migrate
+        image: "gcr.io/project/app:v1.0.0"
+      containers:
+      - <<: *defaults
+        name: app
+        image: *image
+      - name: worker
+        image: gcr.io/project/app-worker:v1.0.0
+      - name: sidecar
+        image: 'gcr.io/project/app@sha256:0000'
+`,
+		},
+		{
+			name:    "another image",
+			updater: NewYAMLImageUpdater("gcr.io/project/other", "v1.1.0"),
+			want:    anchored,
+		},
+	}
+	for _, tt := range tests {
+		got, err := tt.updater.Update(anchored)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: updated\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRegexUpdater(t *testing.T) {
+	content := "image: gcr.io/project/app:v1.0.0\nimage: gcr.io/project/app:v1.0.0\n"
+
+	tests := []struct {
+		name    string
+		updater Updater
+		want    string
+	}{
+		{"all", NewRegexUpdater(`gcr.io/project/app:\S+`, "gcr.io/project/app:v1.1.0"), "image: gcr.io/project/app:v1.1.0\nimage: gcr.io/project/app:v1.1.0\n"},
+		{"first", FirstMatchOnly(NewRegexUpdater(`gcr.io/project/app:\S+`, "gcr.io/project/app:v1.1.0")), "image: gcr.io/project/app:v1.1.0\nimage: gcr.io/project/app:v1.0.0\n"},
+		{"expanded", NewRegexUpdater(`(gcr.io/project/app):\S+`, "${1}:v1.1.0"), "image: gcr.io/project/app:v1.1.0\nimage: gcr.io/project/app:v1.1.0\n"},
+	}
+	for _, tt := range tests {
+		got, err := tt.updater.Update(content)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: updated %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestInsertUpdater(t *testing.T) {
+	tests := []struct {
+		name    string
+		after   string
+		content string
+		want    string
+	}{
+		{"append", "", "a: 1", "a: 1\nimages: []\n"},
+		{"after the line", "^a:", "a: 1\nb: 2\n", "a: 1\nimages: []\nb: 2\n"},
+		{"after the last line", "^b:", "a: 1\nb: 2", "a: 1\nb: 2\nimages: []\n"},
+	}
+	for _, tt := range tests {
+		u, err := NewInsertUpdater(tt.after, "images: []")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := u.Update(tt.content)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: updated %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+
+	u, _ := NewInsertUpdater("^missing:", "images: []")
+	if _, err := u.Update("a: 1\n"); err == nil {
+		t.Error("inserted after a missing line")
+	}
+}
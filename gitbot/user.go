@@ -0,0 +1,30 @@
+package gitbot
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/go-github/v18/github"
+	"golang.org/x/oauth2"
+)
+
+// User is a GitHub account
+type User struct {
+	ID    int64
+	Login string
+}
+
+// AuthenticatedUser returns the account of the token
+func AuthenticatedUser(ctx context.Context, httpClient *http.Client, token string) (*User, error) {
+	if httpClient != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, httpClient)
+	}
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+	c := github.NewClient(oauth2.NewClient(ctx, ts))
+
+	u, _, err := c.Users.Get(ctx, "")
+	if err != nil {
+		return nil, &Error{Step: StepGetUser, Repo: "-", Err: err}
+	}
+	return &User{ID: u.GetID(), Login: u.GetLogin()}, nil
+}
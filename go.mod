@@ -1,5 +1,7 @@
 module github.com/sakajunquality/flow
 
+go 1.13
+
 require (
 	cloud.google.com/go v0.30.0
 	github.com/davecgh/go-spew v1.1.1 // indirect
@@ -17,8 +19,8 @@ require (
 	go.opencensus.io v0.17.0 // indirect
 	golang.org/x/net v0.0.0-20181017193950-04a2e542c03f // indirect
 	golang.org/x/oauth2 v0.0.0-20181017192945-9dcd33a902f4
-	google.golang.org/api v0.0.0-20181019000435-7fb5a8353b60 // indirect
+	google.golang.org/api v0.0.0-20181019000435-7fb5a8353b60
 	google.golang.org/genproto v0.0.0-20181016170114-94acd270e44e // indirect
-	google.golang.org/grpc v1.15.0 // indirect
+	google.golang.org/grpc v1.15.0
 	gopkg.in/yaml.v2 v2.2.1
 )
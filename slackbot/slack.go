@@ -1,7 +1,9 @@
 package slackbot
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
@@ -9,8 +11,10 @@ import (
 )
 
 type slackMessage struct {
-	apiKey  string
-	channel string
+	apiKey     string
+	channel    string
+	templates  *Templates
+	httpClient *http.Client
 	MessageDetail
 }
 
@@ -23,31 +27,92 @@ type MessageDetail struct {
 	PrURL        string
 	BranchName   *string
 	TagName      *string
-	Time         time.Duration
+	Time         time.Duration // how long the build ran, zero when unknown
+	QueueTime    time.Duration // how long the build waited to start, zero when unknown
 	ErrorMessage string
+	// LogTail is the end of the build log, shown as a code block
+	LogTail string
+	// Status is the progress of the release, e.g. deployed, shown on the edited messages
+	Status string
+	// Clusters are where the envs of the message run, e.g. "production → asia-northeast1/prod"
+	Clusters []string
+	// Body is the text of a message which isn't about a build, e.g. a digest, titled by AppName.
+	// The build fields are left out of it
+	Body string
 }
 
-func NewSlackMessage(apiKey, channel string, d MessageDetail) *slackMessage {
+// MessageRef identifies a posted message to update it
+type MessageRef struct {
+	// Channel is the ID of the channel, which chat.update requires instead of the name
+	Channel   string
+	Timestamp string
+	// Workspace is the named credential which posted the message, empty for the default one
+	Workspace string
+}
+
+func NewSlackMessage(apiKey, channel string, d MessageDetail, t *Templates) *slackMessage {
+	if t == nil {
+		t = defaultTemplates
+	}
+
 	return &slackMessage{
 		apiKey:        apiKey,
 		channel:       channel,
+		templates:     t,
 		MessageDetail: d,
 	}
 }
 
-func (s *slackMessage) Post() error {
-	api := slack.New(s.apiKey)
+// SetHTTPClient sets the client the Slack API is called with
+func (s *slackMessage) SetHTTPClient(c *http.Client) {
+	s.httpClient = c
+}
+
+// Post posts the message and returns the reference to update it, the cancellation of ctx aborts it
+func (s *slackMessage) Post(ctx context.Context) (MessageRef, error) {
+	channel, timestamp, err := s.api().PostMessageContext(ctx, s.channel, "", s.params())
+	return MessageRef{Channel: channel, Timestamp: timestamp}, err
+}
+
+// Update replaces the message of the reference with this one
+func (s *slackMessage) Update(ctx context.Context, ref MessageRef) error {
+	params := s.params()
+	_, _, _, err := s.api().SendMessageContext(ctx, ref.Channel,
+		slack.MsgOptionUpdate(ref.Timestamp),
+		slack.MsgOptionAttachments(params.Attachments...),
+		slack.MsgOptionAsUser(true),
+	)
+	return err
+}
+
+// Reply posts the text in the thread of the message of the reference
+func (s *slackMessage) Reply(ctx context.Context, ref MessageRef, text string) error {
+	params := slack.PostMessageParameters{
+		ThreadTimestamp: ref.Timestamp,
+		Markdown:        true,
+		AsUser:          true,
+	}
+	_, _, err := s.api().PostMessageContext(ctx, ref.Channel, text, params)
+	return err
+}
+
+func (s *slackMessage) api() *slack.Client {
+	if s.httpClient != nil {
+		return slack.New(s.apiKey, slack.OptionHTTPClient(s.httpClient))
+	}
+	return slack.New(s.apiKey)
+}
 
-	var title, color string
+func (s *slackMessage) params() slack.PostMessageParameters {
+	if s.Body != "" {
+		return s.bodyParams()
+	}
 
-	title = "Build"
+	title := s.templates.title(s.MessageDetail)
 
-	if s.IsSuccess {
-		color = colorSuccess
-		title += " Success"
-	} else {
+	color := colorSuccess
+	if !s.IsSuccess {
 		color = colorDanger
-		title += " Failure"
 	}
 
 	fields := []slack.AttachmentField{}
@@ -85,7 +150,27 @@ func (s *slackMessage) Post() error {
 	if s.PrURL != "" {
 		fields = append(fields, slack.AttachmentField{
 			Title: "Deploy Pull Request",
-			Value: fmt.Sprintf("Merge this PullRequest for Relase\n%s\n", s.PrURL),
+			Value: s.templates.prText(s.MessageDetail),
+			Short: false,
+		})
+	}
+
+	if s.Time > 0 {
+		value := s.Time.Round(time.Second).String()
+		if s.QueueTime > 0 {
+			value += fmt.Sprintf(" (queued %s)", s.QueueTime.Round(time.Second))
+		}
+		fields = append(fields, slack.AttachmentField{
+			Title: "Build Time",
+			Value: value,
+			Short: true,
+		})
+	}
+
+	if len(s.Clusters) > 0 {
+		fields = append(fields, slack.AttachmentField{
+			Title: "Clusters",
+			Value: strings.Join(s.Clusters, "\n"),
 			Short: false,
 		})
 	}
@@ -96,6 +181,22 @@ func (s *slackMessage) Post() error {
 		Short: false,
 	})
 
+	if s.LogTail != "" {
+		fields = append(fields, slack.AttachmentField{
+			Title: "Log Tail",
+			Value: fmt.Sprintf("```%s```", s.LogTail),
+			Short: false,
+		})
+	}
+
+	if s.Status != "" {
+		fields = append(fields, slack.AttachmentField{
+			Title: "Status",
+			Value: s.Status,
+			Short: true,
+		})
+	}
+
 	if s.ErrorMessage != "" {
 		fields = append(fields, slack.AttachmentField{
 			Title: "Errors",
@@ -104,7 +205,7 @@ func (s *slackMessage) Post() error {
 		})
 	}
 
-	params := slack.PostMessageParameters{
+	return slack.PostMessageParameters{
 		Attachments: []slack.Attachment{
 			slack.Attachment{
 				Color:  color,
@@ -116,8 +217,30 @@ func (s *slackMessage) Post() error {
 		LinkNames: 1,
 		AsUser:    true,
 	}
+}
 
-	// ignore channelID and timestamp
-	_, _, err := api.PostMessage(s.channel, "", params)
-	return err
+func (s *slackMessage) bodyParams() slack.PostMessageParameters {
+	fields := []slack.AttachmentField{}
+	if s.Status != "" {
+		fields = append(fields, slack.AttachmentField{
+			Title: "Status",
+			Value: s.Status,
+			Short: true,
+		})
+	}
+
+	return slack.PostMessageParameters{
+		Attachments: []slack.Attachment{
+			slack.Attachment{
+				Color:      colorSuccess,
+				Title:      s.AppName,
+				Text:       s.Body,
+				Fields:     fields,
+				MarkdownIn: []string{"text"},
+			},
+		},
+		Markdown:  true,
+		LinkNames: 1,
+		AsUser:    true,
+	}
 }
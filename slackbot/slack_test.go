@@ -0,0 +1,102 @@
+package slackbot
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rewriteHost sends the requests to slack.com to the server
+type rewriteHost struct {
+	u *url.URL
+}
+
+func (rt rewriteHost) RoundTrip(r *http.Request) (*http.Response, error) {
+	r.URL.Scheme = rt.u.Scheme
+	r.URL.Host = rt.u.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func newTestMessage(handler http.HandlerFunc) (*slackMessage, func()) {
+	server := httptest.NewServer(handler)
+	u, _ := url.Parse(server.URL)
+
+	msg := NewSlackMessage("xoxb-token", "#deploy", MessageDetail{IsSuccess: true, AppName: "app"}, nil)
+	msg.SetHTTPClient(&http.Client{Transport: rewriteHost{u}})
+	return msg, server.Close
+}
+
+func TestPost(t *testing.T) {
+	msg, done := newTestMessage(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat.postMessage" || r.FormValue("channel") != "#deploy" {
+			http.Error(w, "unexpected "+r.URL.String(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true,"channel":"C1","ts":"1500000000.000100"}`))
+	})
+	defer done()
+
+	ref, err := msg.Post(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ref.Channel != "C1" || ref.Timestamp != "1500000000.000100" {
+		t.Errorf("posted %+v", ref)
+	}
+}
+
+func TestPostCancelled(t *testing.T) {
+	received, release := make(chan struct{}), make(chan struct{})
+	msg, done := newTestMessage(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		<-release
+	})
+	defer done()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-received
+		cancel()
+	}()
+
+	start := time.Now()
+	_, err := msg.Post(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("posted with %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %s", elapsed)
+	}
+}
+
+func TestPostCancelledBefore(t *testing.T) {
+	msg, done := newTestMessage(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("requested with a cancelled context")
+	})
+	defer done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := msg.Post(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("posted with %v, want context.Canceled", err)
+	}
+}
+
+func TestParamsBody(t *testing.T) {
+	d := MessageDetail{IsSuccess: true, AppName: "Releases since 2020-01-01 00:00 UTC", Body: "*app*\n`dev` v1.0.0\n"}
+	params := NewSlackMessage("xoxb-token", "#deploy", d, nil).params()
+
+	a := params.Attachments[0]
+	if a.Title != d.AppName || a.Text != d.Body {
+		t.Errorf("posted %q %q, want %q %q", a.Title, a.Text, d.AppName, d.Body)
+	}
+	for _, f := range a.Fields {
+		t.Errorf("posted the field %s of a build", f.Title)
+	}
+}
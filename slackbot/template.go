@@ -0,0 +1,101 @@
+package slackbot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+const (
+	defaultSuccessTemplate = "Build Success"
+	defaultFailureTemplate = "Build Failure"
+	defaultDeployTemplate  = "Build Success"
+	defaultPRTemplate      = "Merge this PullRequest for Relase\n{{ .PrURL }}\n"
+)
+
+// Templates renders the wording of the messages from MessageDetail
+type Templates struct {
+	success *template.Template
+	failure *template.Template
+	deploy  *template.Template
+	pr      *template.Template
+}
+
+var defaultTemplates, _ = NewTemplates("", "", "", "")
+
+// NewTemplates parses the message templates, empty ones fall back to the defaults
+func NewTemplates(success, failure, deploy, pr string) (*Templates, error) {
+	t := &Templates{}
+	var err error
+
+	if t.success, err = parseTemplate("success", success, defaultSuccessTemplate); err != nil {
+		return nil, err
+	}
+	if t.failure, err = parseTemplate("failure", failure, defaultFailureTemplate); err != nil {
+		return nil, err
+	}
+	if t.deploy, err = parseTemplate("deploy", deploy, defaultDeployTemplate); err != nil {
+		return nil, err
+	}
+	if t.pr, err = parseTemplate("pr", pr, defaultPRTemplate); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func parseTemplate(name, text, defaultText string) (*template.Template, error) {
+	if text == "" {
+		text = defaultText
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %s", name, err)
+	}
+
+	// Render against a sample message so broken templates fail at load
+	sample := MessageDetail{AppName: "app", PrURL: "url", LogURL: "url", ErrorMessage: "error"}
+	if _, err := render(tmpl, sample); err != nil {
+		return nil, fmt.Errorf("invalid %s template: %s", name, err)
+	}
+
+	return tmpl, nil
+}
+
+func render(tmpl *template.Template, d MessageDetail) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, d); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(buf.String()) == "" {
+		return "", errors.New("template rendered an empty message")
+	}
+	return buf.String(), nil
+}
+
+func (t *Templates) title(d MessageDetail) string {
+	tmpl, fallback := t.success, defaultTemplates.success
+	switch {
+	case !d.IsSuccess:
+		tmpl, fallback = t.failure, defaultTemplates.failure
+	case !d.IsPrNotify:
+		tmpl, fallback = t.deploy, defaultTemplates.deploy
+	}
+	return t.execute(tmpl, fallback, d)
+}
+
+func (t *Templates) prText(d MessageDetail) string {
+	return t.execute(t.pr, defaultTemplates.pr, d)
+}
+
+// execute falls back to the default template when the custom one fails at runtime
+func (t *Templates) execute(tmpl, fallback *template.Template, d MessageDetail) string {
+	s, err := render(tmpl, d)
+	if err != nil {
+		s, _ = render(fallback, d)
+	}
+	return s
+}